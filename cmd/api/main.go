@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/NurulloMahmud/habits/config"
 	"github.com/NurulloMahmud/habits/internal/server"
@@ -0,0 +1,79 @@
+package access
+
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+	RoleViewer    = "viewer"
+)
+
+// Permission is an action a user can take inside a habit.
+type Permission int
+
+const (
+	ViewHabit Permission = iota
+	CheckIn
+	Invite
+	ManageRequests
+	ModeratePosts
+	RemoveMembers
+	ManageRoles
+	EditHabit
+	DeleteHabit
+	TransferOwnership
+	CreatePost
+	WatchHabit
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleOwner:     {ViewHabit, CheckIn, Invite, ManageRequests, ModeratePosts, RemoveMembers, ManageRoles, EditHabit, DeleteHabit, TransferOwnership, CreatePost, WatchHabit},
+	RoleModerator: {ViewHabit, CheckIn, Invite, ManageRequests, ModeratePosts, RemoveMembers, CreatePost, WatchHabit},
+	RoleMember:    {ViewHabit, CheckIn, Invite, CreatePost, WatchHabit},
+	RoleViewer:    {ViewHabit, WatchHabit},
+}
+
+// adminPermissions are granted to admins in any habit. Checking in, posting
+// and inviting act as a participant, so they always need a membership.
+var adminPermissions = []Permission{
+	ViewHabit, ManageRequests, ModeratePosts, RemoveMembers, ManageRoles, EditHabit, DeleteHabit, TransferOwnership, WatchHabit,
+}
+
+// Membership is a user's standing in a habit. Role is empty for non-members.
+type Membership struct {
+	HabitID       int64
+	UserID        int64
+	PrivacyStatus string
+	Role          string
+	// Archived is set for archived and deleted habits, which are treated as
+	// missing by Require.
+	Archived bool
+}
+
+func (m Membership) IsMember() bool {
+	return m.Role != ""
+}
+
+// Can reports whether the membership's role grants p.
+func (m Membership) Can(p Permission) bool {
+	for _, granted := range rolePermissions[m.Role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+func adminCan(p Permission) bool {
+	for _, granted := range adminPermissions {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole reports whether role is one of the known habit roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
@@ -0,0 +1,38 @@
+package access
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Repository interface {
+	getMembership(ctx context.Context, habitID, userID int64) (*Membership, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) getMembership(ctx context.Context, habitID, userID int64) (*Membership, error) {
+	m := Membership{HabitID: habitID, UserID: userID}
+
+	query := `
+	SELECT h.privacy_status, COALESCE(hm.role, ''), h.archived_at IS NOT NULL OR h.deleted_at IS NOT NULL
+	FROM habits h
+	LEFT JOIN habit_members hm ON hm.habit_id = h.id AND hm.user_id = $2
+	WHERE h.id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, habitID, userID).Scan(&m.PrivacyStatus, &m.Role, &m.Archived)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,98 @@
+package access
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NurulloMahmud/habits/config"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+var (
+	ErrNoHabit          = errors.New("No habit data found with given id")
+	ErrEmailNotVerified = errors.New("Verify your email address first")
+)
+
+var denied = map[Permission]error{
+	ViewHabit:         errors.New("Only members can view this private habit"),
+	CheckIn:           errors.New("Only habit members can check in"),
+	Invite:            errors.New("Only habit members can send invites"),
+	ManageRequests:    errors.New("Only the habit owner or a moderator can manage join requests"),
+	ModeratePosts:     errors.New("Only the habit owner or a moderator can moderate posts"),
+	RemoveMembers:     errors.New("Only the habit owner or a moderator can revoke memberships"),
+	ManageRoles:       errors.New("Only the habit owner can change member roles"),
+	EditHabit:         errors.New("Only the habit owner can edit this habit"),
+	DeleteHabit:       errors.New("You are not the owner of this habit"),
+	TransferOwnership: errors.New("Only the habit owner can transfer the ownership"),
+	CreatePost:        errors.New("Only habit members can post"),
+	WatchHabit:        errors.New("Only habit members can watch live habit updates"),
+}
+
+type Service struct {
+	repo               Repository
+	restrictUnverified bool
+}
+
+func NewService(repo Repository, cfg config.Config) Service {
+	return Service{
+		repo:               repo,
+		restrictUnverified: cfg.EmailVerification.RestrictUnverified,
+	}
+}
+
+// Membership loads the user's standing in the habit, nil if the habit does
+// not exist. Archived habits are returned as well.
+func (s *Service) Membership(ctx context.Context, habitID, userID int64) (*Membership, error) {
+	return s.repo.getMembership(ctx, habitID, userID)
+}
+
+// Require checks that the user is allowed to do p in the habit and returns
+// their membership. Admins may view and manage any habit but take part only
+// where they are members, and anyone can view a public habit.
+func (s *Service) Require(ctx context.Context, user cx.User, habitID int64, p Permission) (*Membership, error) {
+	m, err := s.repo.getMembership(ctx, habitID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.Archived {
+		return nil, ErrNoHabit
+	}
+
+	if !s.Allows(user, *m, p) {
+		return nil, denied[p]
+	}
+	return m, nil
+}
+
+// Allows applies the rules of Require to a membership loaded before, so one
+// lookup can answer for several permissions.
+func (s *Service) Allows(user cx.User, m Membership, p Permission) bool {
+	if m.Can(p) || (user.UserRole == "admin" && adminCan(p)) {
+		return true
+	}
+	return p == ViewHabit && m.PrivacyStatus == "public"
+}
+
+// RequireVerified checks that the user confirmed their email address, when
+// unverified users are restricted. It guards actions that reach other people,
+// such as public habits and invites.
+func (s *Service) RequireVerified(user cx.User) error {
+	if s.restrictUnverified && !user.EmailVerified && user.UserRole != "admin" {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// IsForbidden reports whether err is a permission error returned by Require
+// or RequireVerified.
+func IsForbidden(err error) bool {
+	if err == ErrEmailNotVerified {
+		return true
+	}
+	for _, e := range denied {
+		if err == e {
+			return true
+		}
+	}
+	return false
+}
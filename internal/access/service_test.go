@@ -0,0 +1,47 @@
+package access
+
+import (
+	"context"
+	"testing"
+
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+type memoryRepository map[int64]*Membership
+
+func (r memoryRepository) getMembership(ctx context.Context, habitID, userID int64) (*Membership, error) {
+	return r[userID], nil
+}
+
+func TestAdminsTakePartOnlyAsMembers(t *testing.T) {
+	repo := memoryRepository{
+		1: {HabitID: 10, UserID: 1, PrivacyStatus: "private"},
+		2: {HabitID: 10, UserID: 2, PrivacyStatus: "private", Role: RoleMember},
+	}
+	s := Service{repo: repo}
+
+	tests := []struct {
+		userID int64
+		p      Permission
+		want   bool
+	}{
+		{1, ViewHabit, true},
+		{1, ManageRequests, true},
+		{1, EditHabit, true},
+		{1, CheckIn, false},
+		{1, CreatePost, false},
+		{1, Invite, false},
+		{2, CheckIn, true},
+		{2, CreatePost, true},
+	}
+	for _, tt := range tests {
+		admin := cx.User{ID: tt.userID, UserRole: "admin"}
+		_, err := s.Require(context.Background(), admin, 10, tt.p)
+		if (err == nil) != tt.want {
+			t.Errorf("admin %d, permission %d: err = %v", tt.userID, tt.p, err)
+		}
+		if err != nil && err != denied[tt.p] {
+			t.Errorf("admin %d, permission %d: err = %v, want %v", tt.userID, tt.p, err, denied[tt.p])
+		}
+	}
+}
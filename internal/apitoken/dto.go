@@ -0,0 +1,49 @@
+package apitoken
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/auth"
+)
+
+type createTokenRequest struct {
+	Name      *string    `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r *createTokenRequest) validate(now time.Time) error {
+	if r.Name == nil || strings.TrimSpace(*r.Name) == "" {
+		return errors.New("name is required")
+	}
+	*r.Name = strings.TrimSpace(*r.Name)
+	if len(*r.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+
+	if len(r.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range r.Scopes {
+		if !auth.ValidScope(scope) {
+			return fmt.Errorf("unknown scope %q, valid scopes are %s", scope, strings.Join(auth.Scopes, ", "))
+		}
+	}
+	slices.Sort(r.Scopes)
+	r.Scopes = slices.Compact(r.Scopes)
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(now) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+// createdToken carries the plain token, it is only shown once.
+type createdToken struct {
+	*Token
+	Secret string `json:"token"`
+}
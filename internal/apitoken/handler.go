@@ -0,0 +1,82 @@
+package apitoken
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(time.Now().UTC()); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.create(r.Context(), *user, req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	data, err := h.service.list(r.Context(), *user)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := utils.ReadInt64Param(r, "tokenID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	if err = h.service.revoke(r.Context(), *user, tokenID); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "access token revoked"})
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errNoTokenFound, errTooManyTokens:
+		response.BadRequest(w, r, err, h.logger)
+	default:
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
@@ -0,0 +1,25 @@
+package apitoken
+
+import "time"
+
+// TokenPrefix starts every personal access token, so they are easy to tell
+// from JWTs and to spot when leaked.
+const TokenPrefix = "hbt_"
+
+// Token is a personal access token. Only the hash of the token is stored,
+// Prefix is its first characters.
+type Token struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *Token) expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,153 @@
+package apitoken
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type Repository interface {
+	create(ctx context.Context, t Token) (*Token, error)
+	get(ctx context.Context, id int64) (*Token, error)
+	getByHash(ctx context.Context, hash []byte) (*Token, error)
+	listByUser(ctx context.Context, userID int64) ([]*Token, error)
+	countByUser(ctx context.Context, userID int64) (int, error)
+	delete(ctx context.Context, id int64) error
+	markUsed(ctx context.Context, id int64) error
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const tokenColumns = `
+	id,
+	user_id,
+	name,
+	prefix,
+	token_hash,
+	scopes,
+	expires_at,
+	last_used_at,
+	created_at`
+
+func scanToken(row interface{ Scan(...any) error }, t *Token) error {
+	var scopes string
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		&t.Prefix,
+		&t.Hash,
+		&scopes,
+		&t.ExpiresAt,
+		&t.LastUsedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	t.Scopes = strings.Split(scopes, ",")
+	return nil
+}
+
+func (r *postgresRepository) create(ctx context.Context, t Token) (*Token, error) {
+	query := `
+	INSERT INTO personal_access_tokens (user_id, name, prefix, token_hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(
+		ctx, query,
+		t.UserID,
+		t.Name,
+		t.Prefix,
+		t.Hash,
+		strings.Join(t.Scopes, ","),
+		t.ExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (r *postgresRepository) get(ctx context.Context, id int64) (*Token, error) {
+	var t Token
+	query := `SELECT ` + tokenColumns + ` FROM personal_access_tokens WHERE id = $1`
+
+	err := scanToken(r.db.QueryRowContext(ctx, query, id), &t)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (r *postgresRepository) getByHash(ctx context.Context, hash []byte) (*Token, error) {
+	var t Token
+	query := `SELECT ` + tokenColumns + ` FROM personal_access_tokens WHERE token_hash = $1`
+
+	err := scanToken(r.db.QueryRowContext(ctx, query, hash), &t)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (r *postgresRepository) listByUser(ctx context.Context, userID int64) ([]*Token, error) {
+	query := `SELECT ` + tokenColumns + ` FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		var t Token
+		if err = scanToken(rows, &t); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &t)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (r *postgresRepository) countByUser(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = $1`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *postgresRepository) delete(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM personal_access_tokens WHERE id = $1`, id)
+	return err
+}
+
+// markUsed sets last_used_at at most once a minute, so scripts calling in a
+// loop don't write on every request.
+func (r *postgresRepository) markUsed(ctx context.Context, id int64) error {
+	query := `
+	UPDATE personal_access_tokens
+	SET last_used_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
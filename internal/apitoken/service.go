@@ -0,0 +1,92 @@
+package apitoken
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/auth"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+const maxTokens = 50
+
+var (
+	errNoTokenFound  = errors.New("No access token found with given id")
+	errTooManyTokens = errors.New("You can have at most 50 access tokens")
+)
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return Service{repo: repo}
+}
+
+func (s *Service) create(ctx context.Context, u cx.User, req createTokenRequest) (*createdToken, error) {
+	count, err := s.repo.countByUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxTokens {
+		return nil, errTooManyTokens
+	}
+
+	secret, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	plain := TokenPrefix + secret
+
+	token, err := s.repo.create(ctx, Token{
+		UserID:    u.ID,
+		Name:      *req.Name,
+		Prefix:    plain[:len(TokenPrefix)+8],
+		Hash:      auth.HashToken(plain),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &createdToken{Token: token, Secret: plain}, nil
+}
+
+func (s *Service) list(ctx context.Context, u cx.User) ([]*Token, error) {
+	return s.repo.listByUser(ctx, u.ID)
+}
+
+func (s *Service) revoke(ctx context.Context, u cx.User, id int64) error {
+	token, err := s.repo.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if token == nil || token.UserID != u.ID {
+		return errNoTokenFound
+	}
+	return s.repo.delete(ctx, id)
+}
+
+// Authenticate returns the personal access token the plain token belongs to,
+// or nil when it is unknown or expired.
+func (s *Service) Authenticate(ctx context.Context, plain string) (*Token, error) {
+	if !strings.HasPrefix(plain, TokenPrefix) {
+		return nil, nil
+	}
+
+	token, err := s.repo.getByHash(ctx, auth.HashToken(plain))
+	if err != nil || token == nil {
+		return nil, err
+	}
+	if token.expired(time.Now().UTC()) {
+		return nil, nil
+	}
+
+	if err = s.repo.markUsed(ctx, token.ID); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
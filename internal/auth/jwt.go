@@ -11,32 +11,30 @@ type TokenClaims struct {
 	ID       int64  `json:"id"`
 	Email    string `json:"email"`
 	UserRole string `json:"user_role"`
+	// SessionID ties the token to the login session it was issued for.
+	SessionID int64 `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(user TokenClaims, jwtSecret string) (string, error) {
+func GenerateAccessToken(user TokenClaims, keys *KeySet, ttl time.Duration) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"email": user.Email,
 		"id":    user.ID,
 		"role":  user.UserRole,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(ttl).Unix(),
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		return "", err
+	if user.SessionID != 0 {
+		claims["sid"] = user.SessionID
 	}
-	return tokenString, nil
+
+	return keys.Sign(claims)
 }
 
-func VerifyToken(tokenString, jwtSecret string) (*TokenClaims, error) {
+func VerifyToken(tokenString string, keys *KeySet) (*TokenClaims, error) {
 	claims := &TokenClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jwtSecret), nil
-	})
-
+	token, err := keys.Parse(tokenString, claims)
 	if err != nil {
 		return nil, err
 	}
@@ -47,3 +45,12 @@ func VerifyToken(tokenString, jwtSecret string) (*TokenClaims, error) {
 
 	return claims, nil
 }
+
+// IssuedBefore reports whether the token was issued before t. Tokens without
+// an issue time are treated as issued before anything.
+func (c *TokenClaims) IssuedBefore(t time.Time) bool {
+	if c.IssuedAt == nil {
+		return true
+	}
+	return c.IssuedAt.Time.Before(t.Truncate(time.Second))
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA key accepted for signing or verification.
+const minRSABits = 2048
+
+var (
+	errNoPEM          = errors.New("no PEM block found")
+	errKeyType        = errors.New("only Ed25519 and RSA keys are supported")
+	errRSAKeyTooSmall = errors.New("RSA keys must be at least 2048 bits")
+	errNotPrivateKey  = errors.New("signing key must be a private key")
+)
+
+// Key is a JWT key, identified by the RFC 7638 thumbprint of its public key.
+// Signer is only set for the key tokens are signed with.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	Public crypto.PublicKey
+	Signer crypto.Signer
+}
+
+// KeySet signs tokens with one key and verifies them with any of its keys, so
+// the previous keys keep working while a new one is rolled out.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// LoadKeySet reads the signing key and any extra verification keys from PEM
+// files. Verification keys may be public or private keys.
+func LoadKeySet(signingKeyFile string, verifyKeyFiles []string) (*KeySet, error) {
+	signing, err := loadKey(signingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", signingKeyFile, err)
+	}
+	if signing.Signer == nil {
+		return nil, fmt.Errorf("signing key %s: %w", signingKeyFile, errNotPrivateKey)
+	}
+
+	ks := &KeySet{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, file := range verifyKeyFiles {
+		key, err := loadKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("verification key %s: %w", file, err)
+		}
+		ks.keys[key.ID] = &Key{ID: key.ID, Method: key.Method, Public: key.Public}
+	}
+
+	return ks, nil
+}
+
+// NewEphemeralKeySet generates a throwaway Ed25519 key. Tokens signed with it
+// stop working on restart, it is meant for local development only.
+func NewEphemeralKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{signing: key, keys: map[string]*Key{key.ID: key}}, nil
+}
+
+// Sign signs the claims with the signing key and sets the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.Signer)
+}
+
+// Parse verifies a token against the key named by its kid header. Only the
+// asymmetric algorithms are accepted and the algorithm must match the key.
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, ks.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}),
+	)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS returns the public half of every key, for other services to verify
+// our tokens with.
+func (ks *KeySet) JWKS() []JWK {
+	result := make([]JWK, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		jwk := publicJWK(key.Public)
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+		result = append(result, jwk)
+	}
+
+	slices.SortFunc(result, func(a, b JWK) int { return strings.Compare(a.Kid, b.Kid) })
+	return result
+}
+
+func loadKey(file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errNoPEM
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(parsed)
+}
+
+func newKey(parsed any) (*Key, error) {
+	var key Key
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key = Key{Method: jwt.SigningMethodEdDSA, Public: k.Public(), Signer: k}
+	case ed25519.PublicKey:
+		key = Key{Method: jwt.SigningMethodEdDSA, Public: k}
+	case *rsa.PrivateKey:
+		key = Key{Method: jwt.SigningMethodRS256, Public: &k.PublicKey, Signer: k}
+	case *rsa.PublicKey:
+		key = Key{Method: jwt.SigningMethodRS256, Public: k}
+	default:
+		return nil, errKeyType
+	}
+
+	if pub, ok := key.Public.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return nil, errRSAKeyTooSmall
+	}
+
+	id, err := thumbprint(key.Public)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = id
+	return &key, nil
+}
+
+func publicJWK(public crypto.PublicKey) JWK {
+	switch k := public.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(k)}
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	}
+	return JWK{}
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint, the hash of the required members
+// of the key in lexicographic order.
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk := publicJWK(public)
+
+	var members any
+	switch jwk.Kty {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	default:
+		return "", errKeyType
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,191 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/auth"
+	"github.com/NurulloMahmud/habits/internal/auth/oidctest"
+)
+
+func newOIDCClient(p *oidctest.Provider) *auth.OIDCClient {
+	return auth.NewOIDCClient(config.OIDCProvider{
+		Name:         "mock",
+		Issuer:       p.URL,
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  "http://app.test/login/oidc/mock/callback",
+		Scopes:       []string{"openid", "email"},
+	}, nil)
+}
+
+// authorize runs the browser part of the flow and returns the code.
+func authorize(t *testing.T, p *oidctest.Provider, c *auth.OIDCClient, nonce, verifier string, claims map[string]any) string {
+	t.Helper()
+
+	authURL, err := c.AuthCodeURL(context.Background(), "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state, err := p.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+	return code
+}
+
+func TestOIDCExchange(t *testing.T) {
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	c := newOIDCClient(p)
+	verifier, err := auth.NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := authorize(t, p, c, "nonce-1", verifier, map[string]any{
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+	})
+	claims, err := c.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "ada@example.com" || !bool(claims.EmailVerified) || claims.GivenName != "Ada" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// codes are single use
+	if _, err = c.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+		t.Fatal("second exchange of the same code succeeded")
+	}
+}
+
+func TestOIDCEmailVerifiedString(t *testing.T) {
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	c := newOIDCClient(p)
+
+	for _, tc := range []struct {
+		value any
+		want  bool
+	}{
+		{"true", true},
+		{"false", false},
+		{false, false},
+		{nil, false},
+	} {
+		verifier, _ := auth.NewPKCEVerifier()
+		code := authorize(t, p, c, "n", verifier, map[string]any{"email_verified": tc.value})
+		claims, err := c.Exchange(context.Background(), code, verifier, "n")
+		if err != nil {
+			t.Fatalf("Exchange(%v): %v", tc.value, err)
+		}
+		if bool(claims.EmailVerified) != tc.want {
+			t.Errorf("email_verified %v parsed as %v, want %v", tc.value, claims.EmailVerified, tc.want)
+		}
+	}
+}
+
+func TestOIDCPKCE(t *testing.T) {
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	c := newOIDCClient(p)
+	verifier, _ := auth.NewPKCEVerifier()
+	other, _ := auth.NewPKCEVerifier()
+
+	code := authorize(t, p, c, "n", verifier, nil)
+	if _, err := c.Exchange(context.Background(), code, other, "n"); err == nil {
+		t.Fatal("exchange with the wrong code verifier succeeded")
+	}
+}
+
+func TestOIDCPKCEChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	got := auth.PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Fatalf("PKCEChallenge = %q, want %q", got, want)
+	}
+}
+
+func TestOIDCRejectsBadIDTokens(t *testing.T) {
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	c := newOIDCClient(p)
+
+	tests := []struct {
+		name   string
+		nonce  string
+		claims map[string]any
+		want   error
+	}{
+		{name: "nonce", nonce: "other", want: auth.ErrOIDCNonce},
+		{name: "audience", claims: map[string]any{"aud": "client-2"}},
+		{name: "authorized party", claims: map[string]any{"aud": []string{"client-1", "client-2"}, "azp": "client-2"}},
+		{name: "issuer", claims: map[string]any{"iss": "https://evil.test"}},
+		{name: "expired", claims: map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "no expiry", claims: map[string]any{"exp": nil}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			verifier, _ := auth.NewPKCEVerifier()
+			code := authorize(t, p, c, "nonce-1", verifier, tc.claims)
+
+			nonce := "nonce-1"
+			if tc.nonce != "" {
+				nonce = tc.nonce
+			}
+			_, err := c.Exchange(context.Background(), code, verifier, nonce)
+			if err == nil {
+				t.Fatal("bad ID token was accepted")
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestOIDCAcceptsMatchingAuthorizedParty(t *testing.T) {
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	c := newOIDCClient(p)
+	verifier, _ := auth.NewPKCEVerifier()
+
+	code := authorize(t, p, c, "n", verifier, map[string]any{"aud": []string{"client-1", "client-2"}, "azp": "client-1"})
+	if _, err := c.Exchange(context.Background(), code, verifier, "n"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+}
+
+func TestOIDCWrongClientSecret(t *testing.T) {
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	c := auth.NewOIDCClient(config.OIDCProvider{
+		Name:         "mock",
+		Issuer:       p.URL,
+		ClientID:     "client-1",
+		ClientSecret: "wrong",
+		RedirectURL:  "http://app.test/cb",
+	}, nil)
+	verifier, _ := auth.NewPKCEVerifier()
+
+	code := authorize(t, p, c, "n", verifier, nil)
+	if _, err := c.Exchange(context.Background(), code, verifier, "n"); err == nil {
+		t.Fatal("exchange with the wrong client secret succeeded")
+	}
+}
+
+func TestOIDCIssuerMismatch(t *testing.T) {
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	c := auth.NewOIDCClient(config.OIDCProvider{
+		Name:     "mock",
+		Issuer:   p.URL + "/",
+		ClientID: "client-1",
+	}, nil)
+
+	if _, err := c.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Fatal("discovery with a different issuer was accepted")
+	}
+}
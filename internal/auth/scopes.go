@@ -0,0 +1,35 @@
+package auth
+
+import "slices"
+
+// Scopes a personal access token can be limited to. Requests authenticated
+// with a login session are not limited by scopes.
+const (
+	ScopeHabitsRead         = "habits:read"
+	ScopeHabitsWrite        = "habits:write"
+	ScopeMembersRead        = "members:read"
+	ScopeMembersWrite       = "members:write"
+	ScopeCheckinsRead       = "checkins:read"
+	ScopeCheckinsWrite      = "checkins:write"
+	ScopePostsRead          = "posts:read"
+	ScopePostsWrite         = "posts:write"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeNotificationsWrite = "notifications:write"
+)
+
+var Scopes = []string{
+	ScopeHabitsRead,
+	ScopeHabitsWrite,
+	ScopeMembersRead,
+	ScopeMembersWrite,
+	ScopeCheckinsRead,
+	ScopeCheckinsWrite,
+	ScopePostsRead,
+	ScopePostsWrite,
+	ScopeNotificationsRead,
+	ScopeNotificationsWrite,
+}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
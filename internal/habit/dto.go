@@ -5,6 +5,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/NurulloMahmud/habits/internal/schedule"
+	"github.com/NurulloMahmud/habits/internal/streak"
 	"github.com/NurulloMahmud/habits/pkg/utils"
 	"github.com/google/uuid"
 )
@@ -19,20 +21,23 @@ var (
 	errInvalidStatus        = errors.New("privacy_status field must be either public or private and must not be empty")
 	errInvalidDates         = errors.New("end_date cannot be before start_date")
 	errInvalidDailyDuration = errors.New("daily duration minutes must be greater than or equal to 1")
+	errTransferUser         = errors.New("user_id field is required")
+	errArchivedState        = errors.New("state can only be archived or deleted")
 )
 
 type createHabitRequest struct {
-	ID            int        `json:"id"`
-	Name          string     `json:"name"`
-	Description   string     `json:"description"`
-	StartDate     *time.Time `json:"start_date"`
-	EndDate       *time.Time `json:"end_date"`
-	DailyCount    *int64     `json:"daily_count"`
-	DailyDuration *int64     `json:"daily_duration"`
-	PrivacyStatus string     `json:"privacy_status"`
-	Identifier    *string    `json:"-"`
-	CreatedBy     int64      `json:"-"`
-	CreatedAt     time.Time  `json:"-"`
+	ID            int                `json:"id"`
+	Name          string             `json:"name"`
+	Description   string             `json:"description"`
+	StartDate     *time.Time         `json:"start_date"`
+	EndDate       *time.Time         `json:"end_date"`
+	DailyCount    *int64             `json:"daily_count"`
+	DailyDuration *int64             `json:"daily_duration"`
+	Schedule      *schedule.Schedule `json:"schedule"`
+	PrivacyStatus string             `json:"privacy_status"`
+	Identifier    *string            `json:"-"`
+	CreatedBy     int64              `json:"-"`
+	CreatedAt     time.Time          `json:"-"`
 }
 
 func (r *createHabitRequest) validateCreateRequest(createdBy int64) error {
@@ -64,6 +69,14 @@ func (r *createHabitRequest) validateCreateRequest(createdBy int64) error {
 		return errInvalidDates
 	}
 
+	if r.Schedule == nil {
+		daily := schedule.Daily()
+		r.Schedule = &daily
+	}
+	if err := r.Schedule.Validate(); err != nil {
+		return err
+	}
+
 	if r.PrivacyStatus == "private" {
 		identifier := uuid.New().String()
 		r.Identifier = &identifier
@@ -76,15 +89,16 @@ func (r *createHabitRequest) validateCreateRequest(createdBy int64) error {
 }
 
 type updateHabitRequest struct {
-	ID            int        `json:"-"`
-	Name          *string    `json:"name"`
-	Description   *string    `json:"description"`
-	StartDate     *time.Time `json:"start_date"`
-	EndDate       *time.Time `json:"end_date"`
-	DailyCount    *int64     `json:"daily_count"`
-	DailyDuration *int64     `json:"daily_duration"`
-	PrivacyStatus *string    `json:"privacy_status"`
-	Identifier    *string    `json:"-"`
+	ID            int                `json:"-"`
+	Name          *string            `json:"name"`
+	Description   *string            `json:"description"`
+	StartDate     *time.Time         `json:"start_date"`
+	EndDate       *time.Time         `json:"end_date"`
+	DailyCount    *int64             `json:"daily_count"`
+	DailyDuration *int64             `json:"daily_duration"`
+	Schedule      *schedule.Schedule `json:"schedule"`
+	PrivacyStatus *string            `json:"privacy_status"`
+	Identifier    *string            `json:"-"`
 }
 
 type habitCreator struct {
@@ -95,17 +109,20 @@ type habitCreator struct {
 }
 
 type getHabitResponse struct {
-	ID            int64        `json:"id"`
-	Name          string       `json:"name"`
-	Description   string       `json:"description"`
-	StartDate     time.Time    `json:"start_date"`
-	EndDate       time.Time    `json:"end_date"`
-	DailyCount    *int64       `json:"daily_count,omitempty"`
-	DailyDuration *int64       `json:"daily_duration,omitempty"`
-	PrivacyStatus string       `json:"privacy_status"`
-	Identifier    *string      `json:"-"`
-	CreatedAt     time.Time    `json:"created_at"`
-	Creator       habitCreator `json:"creator"`
+	ID            int64             `json:"id"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	StartDate     time.Time         `json:"start_date"`
+	EndDate       time.Time         `json:"end_date"`
+	DailyCount    *int64            `json:"daily_count,omitempty"`
+	DailyDuration *int64            `json:"daily_duration,omitempty"`
+	Schedule      schedule.Schedule `json:"schedule"`
+	PrivacyStatus string            `json:"privacy_status"`
+	Identifier    *string           `json:"-"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Creator       habitCreator      `json:"creator"`
+	Role          *string           `json:"role,omitempty"`
+	Streak        *streak.Streak    `json:"streak,omitempty"`
 }
 
 type dateFilter struct {
@@ -120,17 +137,26 @@ type HabitListQuery struct {
 	endDate     dateFilter
 	createdAt   dateFilter
 	userRole    string
+	userID      int64
+	location    *time.Location
 	utils.Filter
 }
 
 func (h *HabitListQuery) getHabitType() (string, error) {
-	if h.habitType == "" {
+	return TypeFilter(h.habitType)
+}
+
+// TypeFilter turns the type query parameter of habit lists into a condition
+// on the habits table aliased h. Lists of other packages use it to accept the
+// same values.
+func TypeFilter(habitType string) (string, error) {
+	if habitType == "" {
 		return " 1=1", nil
 	}
-	if h.habitType == "quantity" {
+	if habitType == "quantity" {
 		return " h.daily_duration IS NULL ", nil
 	}
-	if h.habitType == "duration" {
+	if habitType == "duration" {
 		return " h.daily_count IS NULL ", nil
 	}
 
@@ -149,3 +175,41 @@ func (h *HabitListQuery) getPrivacyType() string {
 	}
 	return "h.privacy_status = 'public'"
 }
+
+type transferRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+func (r *transferRequest) validate() error {
+	if r.UserID <= 0 {
+		return errTransferUser
+	}
+	return nil
+}
+
+type archivedHabitResponse struct {
+	ID            int64        `json:"id"`
+	Name          string       `json:"name"`
+	PrivacyStatus string       `json:"privacy_status"`
+	Creator       habitCreator `json:"creator"`
+	ArchivedAt    *time.Time   `json:"archived_at,omitempty"`
+	DeletedAt     *time.Time   `json:"deleted_at,omitempty"`
+	PurgeAt       *time.Time   `json:"purge_at,omitempty"`
+}
+
+type archivedListQuery struct {
+	state string
+	utils.Filter
+}
+
+func (q *archivedListQuery) getState() (string, error) {
+	switch q.state {
+	case "":
+		return "h.archived_at IS NOT NULL OR h.deleted_at IS NOT NULL", nil
+	case "archived":
+		return "h.archived_at IS NOT NULL AND h.deleted_at IS NULL", nil
+	case "deleted":
+		return "h.deleted_at IS NOT NULL", nil
+	}
+	return "", errArchivedState
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/schedule"
 	"github.com/NurulloMahmud/habits/pkg/context"
 	"github.com/NurulloMahmud/habits/pkg/response"
 	"github.com/NurulloMahmud/habits/pkg/utils"
@@ -38,8 +40,12 @@ func (h *HabitHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := h.service.create(r.Context(), req)
+	data, err := h.service.create(r.Context(), *user, req)
 	if err != nil {
+		if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
+			return
+		}
 		response.InternalServerError(w, r, err, h.logger)
 		return
 	}
@@ -63,16 +69,13 @@ func (h *HabitHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	req.ID = int(habitID)
 
 	user := context.GetUser(r)
-	data, err := h.service.update(r.Context(), user.ID, req)
+	data, err := h.service.update(r.Context(), *user, req)
 
 	if err != nil {
 		switch err {
-		case errNoHabitFound:
+		case errNoHabitFound, access.ErrNoHabit:
 			response.BadRequest(w, r, err, h.logger)
 			return
-		case errNotOwner:
-			response.Forbidden(w, r, err.Error())
-			return
 		case errTypeChange:
 			response.BadRequest(w, r, err, h.logger)
 			return
@@ -89,6 +92,14 @@ func (h *HabitHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 			response.BadRequest(w, r, err, h.logger)
 			return
 		default:
+			if schedule.IsValidationError(err) {
+				response.BadRequest(w, r, err, h.logger)
+				return
+			}
+			if access.IsForbidden(err) {
+				response.Forbidden(w, r, err.Error())
+				return
+			}
 			response.InternalServerError(w, r, err, h.logger)
 			return
 		}
@@ -107,11 +118,11 @@ func (h *HabitHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	user := context.GetUser(r)
 	err = h.service.delete(r.Context(), *user, habitID)
 	if err != nil {
-		if errors.Is(err, errNoHabitFound) {
+		if errors.Is(err, errNoHabitFound) || errors.Is(err, access.ErrNoHabit) {
 			response.BadRequest(w, r, err, h.logger)
 			return
-		} else if errors.Is(err, errNotOwner) {
-			response.Forbidden(w, r, "You are not the owner of this habit")
+		} else if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
 			return
 		}
 		response.InternalServerError(w, r, err, h.logger)
@@ -128,7 +139,8 @@ func (h *HabitHandler) HandleGetPrivateHabit(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	habit, err := h.service.repo.get(r.Context(), 0, identifier)
+	user := context.GetUser(r)
+	habit, err := h.service.repo.get(r.Context(), 0, identifier, user.ID)
 	if err != nil {
 		response.InternalServerError(w, r, err, h.logger)
 		return
@@ -162,6 +174,8 @@ func (h *HabitHandler) HandleGetHabitList(w http.ResponseWriter, r *http.Request
 	q.Page = utils.ReadInt(r, "page", 1)
 	q.SortSafeList = validSort
 	q.userRole = user.UserRole
+	q.userID = user.ID
+	q.location = user.Location()
 
 	err := q.Filter.Validate()
 	if err != nil {
@@ -244,3 +258,233 @@ func (h *HabitHandler) HandleGetHabitList(w http.ResponseWriter, r *http.Request
 		"data":     data,
 	})
 }
+
+func (h *HabitHandler) HandleRequestTransfer(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	var req transferRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.requestTransfer(r.Context(), *user, habitID, req.UserID, h.logger)
+	if err != nil {
+		h.handleTransferError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *HabitHandler) HandleListTransfers(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.listTransfers(r.Context(), *user, habitID)
+	if err != nil {
+		h.handleTransferError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *HabitHandler) HandleAcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	habitID, transferID, ok := h.readTransferParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	err := h.service.acceptTransfer(r.Context(), *user, habitID, transferID)
+	if err != nil {
+		h.handleTransferError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "ownership transferred"})
+}
+
+func (h *HabitHandler) HandleDeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	habitID, transferID, ok := h.readTransferParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	err := h.service.declineTransfer(r.Context(), *user, habitID, transferID)
+	if err != nil {
+		h.handleTransferError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "ownership transfer declined"})
+}
+
+func (h *HabitHandler) HandleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	habitID, transferID, ok := h.readTransferParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	err := h.service.cancelTransfer(r.Context(), *user, habitID, transferID)
+	if err != nil {
+		h.handleTransferError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "ownership transfer cancelled"})
+}
+
+func (h *HabitHandler) HandleForceTransfer(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	var req transferRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.forceTransfer(r.Context(), *user, habitID, req.UserID)
+	if err != nil {
+		h.handleTransferError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "ownership transferred"})
+}
+
+func (h *HabitHandler) readTransferParams(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return 0, 0, false
+	}
+	transferID, err := utils.ReadInt64Param(r, "transferID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return 0, 0, false
+	}
+	return habitID, transferID, true
+}
+
+func (h *HabitHandler) handleTransferError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errNoHabitFound, access.ErrNoHabit, errTransferNotMember, errTransferToOwner, errTransferPending,
+		errNoTransfer, errTransferNotPending, errTransferStale:
+		response.BadRequest(w, r, err, h.logger)
+	default:
+		if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
+			return
+		}
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
+
+func (h *HabitHandler) HandleArchive(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.archive(r.Context(), *user, habitID)
+	if err != nil {
+		h.handleArchiveError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "habit archived successfully"})
+}
+
+func (h *HabitHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.restore(r.Context(), *user, habitID)
+	if err != nil {
+		h.handleArchiveError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "habit restored successfully"})
+}
+
+func (h *HabitHandler) HandleListArchived(w http.ResponseWriter, r *http.Request) {
+	var q archivedListQuery
+
+	q.Search = utils.ReadString(r, "search", "")
+	q.state = utils.ReadString(r, "state", "")
+	q.Sort = utils.ReadString(r, "sort", "-id")
+	q.PageSize = utils.ReadInt(r, "page_size", 50)
+	q.Page = utils.ReadInt(r, "page", 1)
+	q.SortSafeList = []string{"id", "name", "archived_at", "deleted_at"}
+
+	err := q.Filter.Validate()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if _, err = q.getState(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	data, metaData, err := h.service.listArchived(r.Context(), q)
+	if err != nil {
+		response.InternalServerError(w, r, err, h.logger)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"metaData": metaData,
+		"data":     data,
+	})
+}
+
+func (h *HabitHandler) handleArchiveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errNoHabitFound, access.ErrNoHabit, errNotArchived, errRetentionExpired:
+		response.BadRequest(w, r, err, h.logger)
+	case errRestoreNotOwner:
+		response.Forbidden(w, r, err.Error())
+	default:
+		if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
+			return
+		}
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
@@ -2,18 +2,40 @@ package habit
 
 import (
 	"time"
+
+	"github.com/NurulloMahmud/habits/internal/schedule"
 )
 
 type Habit struct {
-	ID            int64     `json:"id"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	StartDate     time.Time `json:"start_date"`
-	EndDate       time.Time `json:"end_date"`
-	DailyCount    *int64    `json:"daily_count"`
-	DailyDuration *int64    `json:"daily_duration"`
-	PrivacyStatus string    `json:"privacy_status"`
-	Identifier    *string   `json:"-"`
-	CreatedBy     int64     `json:"created_by"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            int64             `json:"id"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	StartDate     time.Time         `json:"start_date"`
+	EndDate       time.Time         `json:"end_date"`
+	DailyCount    *int64            `json:"daily_count"`
+	DailyDuration *int64            `json:"daily_duration"`
+	Schedule      schedule.Schedule `json:"schedule"`
+	PrivacyStatus string            `json:"privacy_status"`
+	Identifier    *string           `json:"-"`
+	CreatedBy     int64             `json:"created_by"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+const (
+	transferPending   = "pending"
+	transferAccepted  = "accepted"
+	transferDeclined  = "declined"
+	transferCancelled = "cancelled"
+)
+
+type OwnershipTransfer struct {
+	ID          int64      `json:"id"`
+	HabitID     int64      `json:"habit_id"`
+	FromUserID  *int64     `json:"from_user_id"`
+	ToUserID    int64      `json:"to_user_id"`
+	Status      string     `json:"status"`
+	Forced      bool       `json:"forced"`
+	InitiatedBy *int64     `json:"initiated_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
 }
@@ -4,16 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/NurulloMahmud/habits/internal/streak"
 	"github.com/NurulloMahmud/habits/pkg/utils"
 )
 
 type HabitRepository interface {
 	create(ctx context.Context, req createHabitRequest) (*createHabitRequest, error)
-	get(ctx context.Context, id int64, identifier string) (*getHabitResponse, error)
+	get(ctx context.Context, id int64, identifier string, viewerID int64) (*getHabitResponse, error)
 	update(ctx context.Context, data getHabitResponse) error
 	delete(ctx context.Context, id int64) error
+	archive(ctx context.Context, id int64) error
+	restore(ctx context.Context, id int64) error
+	purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	getArchived(ctx context.Context, id int64) (*archivedHabitResponse, error)
+	listArchived(ctx context.Context, q archivedListQuery) ([]*archivedHabitResponse, utils.Metadata, error)
 	list(ctx context.Context, q HabitListQuery) ([]*getHabitResponse, utils.Metadata, error)
+	createTransfer(ctx context.Context, t OwnershipTransfer) (*OwnershipTransfer, error)
+	getTransfer(ctx context.Context, id int64) (*OwnershipTransfer, error)
+	hasPendingTransfer(ctx context.Context, habitID int64) (bool, error)
+	listTransfers(ctx context.Context, habitID int64) ([]*OwnershipTransfer, error)
+	decideTransfer(ctx context.Context, id int64, status string) error
+	completeTransfer(ctx context.Context, t OwnershipTransfer) error
 }
 
 type postgresHabitRepository struct {
@@ -32,8 +45,8 @@ func (r *postgresHabitRepository) create(ctx context.Context, req createHabitReq
 	defer tx.Rollback()
 
 	query := `
-	INSERT INTO habits(name, description, start_date, end_date, daily_count, daily_duration, privacy_status, identifier, created_by, created_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	INSERT INTO habits(name, description, start_date, end_date, daily_count, daily_duration, schedule, privacy_status, identifier, created_by, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	RETURNING id`
 
 	err = tx.QueryRowContext(
@@ -44,6 +57,7 @@ func (r *postgresHabitRepository) create(ctx context.Context, req createHabitReq
 		req.EndDate,
 		req.DailyCount,
 		req.DailyDuration,
+		req.Schedule,
 		req.PrivacyStatus,
 		req.Identifier,
 		req.CreatedBy,
@@ -55,8 +69,8 @@ func (r *postgresHabitRepository) create(ctx context.Context, req createHabitReq
 	}
 
 	memberInsertQuery := `
-	INSERT INTO habit_members (habit_id, member_id) 
-	VALUES ($1, $2) 
+	INSERT INTO habit_members (habit_id, user_id, role)
+	VALUES ($1, $2, 'owner') 
 	RETURNING id`
 	_, err = tx.ExecContext(
 		ctx, memberInsertQuery, req.ID, req.CreatedBy,
@@ -71,9 +85,11 @@ func (r *postgresHabitRepository) create(ctx context.Context, req createHabitReq
 	return &req, err
 }
 
-func (r *postgresHabitRepository) get(ctx context.Context, id int64, identifier string) (*getHabitResponse, error) {
+func (r *postgresHabitRepository) get(ctx context.Context, id int64, identifier string, viewerID int64) (*getHabitResponse, error) {
 	creator := habitCreator{}
 	habit := getHabitResponse{}
+	viewerStreak := streak.Streak{}
+	var isMember bool
 
 	query := `
 	SELECT 
@@ -84,18 +100,29 @@ func (r *postgresHabitRepository) get(ctx context.Context, id int64, identifier
 		h.end_date end_date, 
 		h.daily_count daily_count,  
 		h.daily_duration daily_duration,
+		h.schedule schedule,
 		h.privacy_status privacy_status,
 		h.identifier identifier,
 		h.created_at created_at,
 		u.id creator_id,
 		u.email creator_email,
 		u.first_name creator_first_name,
-		u.last_name creator_last_name
+		u.last_name creator_last_name,
+		hm.id IS NOT NULL is_member,
+		hm.role member_role,
+		COALESCE(st.current_streak, 0) current_streak,
+		COALESCE(st.longest_streak, 0) longest_streak,
+		st.last_met_date last_met_date
 	FROM habits h
 	JOIN users u ON u.id = h.created_by
-	WHERE h.identifier = $1 OR h.id = $2`
+	LEFT JOIN habit_members hm ON hm.habit_id = h.id AND hm.user_id = $3
+	LEFT JOIN habit_streaks st ON st.habit_id = h.id AND st.user_id = $3
+	WHERE
+		(h.identifier = $1 OR h.id = $2) AND
+		h.archived_at IS NULL AND
+		h.deleted_at IS NULL`
 
-	err := r.db.QueryRowContext(ctx, query, identifier, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, identifier, id, viewerID).Scan(
 		&habit.ID,
 		&habit.Name,
 		&habit.Description,
@@ -103,6 +130,7 @@ func (r *postgresHabitRepository) get(ctx context.Context, id int64, identifier
 		&habit.EndDate,
 		&habit.DailyCount,
 		&habit.DailyDuration,
+		&habit.Schedule,
 		&habit.PrivacyStatus,
 		&habit.Identifier,
 		&habit.CreatedAt,
@@ -110,6 +138,11 @@ func (r *postgresHabitRepository) get(ctx context.Context, id int64, identifier
 		&creator.Email,
 		&creator.FirstName,
 		&creator.LastName,
+		&isMember,
+		&habit.Role,
+		&viewerStreak.Current,
+		&viewerStreak.Longest,
+		&viewerStreak.LastMetDate,
 	)
 
 	if err == sql.ErrNoRows {
@@ -120,6 +153,9 @@ func (r *postgresHabitRepository) get(ctx context.Context, id int64, identifier
 	}
 
 	habit.Creator = creator
+	if isMember {
+		habit.Streak = &viewerStreak
+	}
 	return &habit, nil
 }
 
@@ -132,9 +168,10 @@ func (r *postgresHabitRepository) update(ctx context.Context, data getHabitRespo
 		end_date = $4, 
 		daily_count = $5, 
 		daily_duration = $6,
-		privacy_status = $7,
-		identifier = $8
-	WHERE id = $9`
+		schedule = $7,
+		privacy_status = $8,
+		identifier = $9
+	WHERE id = $10`
 
 	_, err := r.db.ExecContext(
 		ctx, query,
@@ -144,6 +181,7 @@ func (r *postgresHabitRepository) update(ctx context.Context, data getHabitRespo
 		data.EndDate,
 		data.DailyCount,
 		data.DailyDuration,
+		data.Schedule,
 		data.PrivacyStatus,
 		data.Identifier,
 		data.ID)
@@ -151,12 +189,122 @@ func (r *postgresHabitRepository) update(ctx context.Context, data getHabitRespo
 	return err
 }
 
+// delete only marks the habit as deleted, it is purged once the retention
+// window passes.
 func (r *postgresHabitRepository) delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM habits WHERE id = $1`
+	query := `UPDATE habits SET deleted_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *postgresHabitRepository) archive(ctx context.Context, id int64) error {
+	query := `UPDATE habits SET archived_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *postgresHabitRepository) restore(ctx context.Context, id int64) error {
+	query := `UPDATE habits SET archived_at = NULL, deleted_at = NULL WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
+func (r *postgresHabitRepository) purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	query := `DELETE FROM habits WHERE deleted_at < $1`
+	res, err := r.db.ExecContext(ctx, query, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const archivedColumns = `
+	h.id,
+	h.name,
+	h.privacy_status,
+	h.archived_at,
+	h.deleted_at,
+	u.id,
+	u.email,
+	u.first_name,
+	u.last_name`
+
+func (r *postgresHabitRepository) getArchived(ctx context.Context, id int64) (*archivedHabitResponse, error) {
+	var h archivedHabitResponse
+
+	query := `
+	SELECT ` + archivedColumns + `
+	FROM habits h
+	JOIN users u ON u.id = h.created_by
+	WHERE h.id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&h.ID,
+		&h.Name,
+		&h.PrivacyStatus,
+		&h.ArchivedAt,
+		&h.DeletedAt,
+		&h.Creator.ID,
+		&h.Creator.Email,
+		&h.Creator.FirstName,
+		&h.Creator.LastName,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+func (r *postgresHabitRepository) listArchived(ctx context.Context, q archivedListQuery) ([]*archivedHabitResponse, utils.Metadata, error) {
+	result := []*archivedHabitResponse{}
+	var metaData utils.Metadata
+	var totalRecords int
+
+	state, _ := q.getState()
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), `+archivedColumns+`
+		FROM habits h
+		JOIN users u ON u.id = h.created_by
+		WHERE
+			(%s) AND
+			(h.name ILIKE $1 || '%%' OR $1 = '')
+		ORDER BY %s, h.id
+		LIMIT $2 OFFSET $3`, state, q.GetSort())
+
+	rows, err := r.db.QueryContext(ctx, query, q.Search, q.Limit(), q.Offset())
+	if err != nil {
+		return nil, metaData, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h archivedHabitResponse
+		err = rows.Scan(
+			&totalRecords,
+			&h.ID,
+			&h.Name,
+			&h.PrivacyStatus,
+			&h.ArchivedAt,
+			&h.DeletedAt,
+			&h.Creator.ID,
+			&h.Creator.Email,
+			&h.Creator.FirstName,
+			&h.Creator.LastName,
+		)
+		if err != nil {
+			return nil, metaData, err
+		}
+		result = append(result, &h)
+	}
+
+	metaData = utils.CalculateMetadata(totalRecords, q.Page, q.PageSize)
+	return result, metaData, rows.Err()
+}
+
 func (r *postgresHabitRepository) list(ctx context.Context, q HabitListQuery) ([]*getHabitResponse, utils.Metadata, error) {
 	var data []*getHabitResponse
 	var metaData utils.Metadata
@@ -173,17 +321,27 @@ func (r *postgresHabitRepository) list(ctx context.Context, q HabitListQuery) ([
 			h.end_date end_date, 
 			h.daily_count daily_count,  
 			h.daily_duration daily_duration,
+			h.schedule schedule,
 			h.privacy_status privacy_status,
 			h.identifier identifier,
 			h.created_at created_at,
 			u.id creator_id,
 			u.email creator_email,
 			u.first_name creator_first_name,
-			u.last_name creator_last_name
+			u.last_name creator_last_name,
+			hm.id IS NOT NULL is_member,
+			hm.role member_role,
+			COALESCE(st.current_streak, 0) current_streak,
+			COALESCE(st.longest_streak, 0) longest_streak,
+			st.last_met_date last_met_date
 		FROM habits h
 		JOIN users u ON u.id = h.created_by
+		LEFT JOIN habit_members hm ON hm.habit_id = h.id AND hm.user_id = $10
+		LEFT JOIN habit_streaks st ON st.habit_id = h.id AND st.user_id = $10
 		WHERE 
 			(%s) AND
+			h.archived_at IS NULL AND
+			h.deleted_at IS NULL AND
 			(h.name ILIKE $1 || '%%' OR $1 = '') AND
 			(h.start_date >= $2 OR $2 IS NULL) AND
 			(h.start_date <= $3 OR $3 IS NULL) AND
@@ -206,6 +364,7 @@ func (r *postgresHabitRepository) list(ctx context.Context, q HabitListQuery) ([
 		q.createdAt.maxDate,
 		q.Limit(),
 		q.Offset(),
+		q.userID,
 	)
 
 	if err != nil {
@@ -215,8 +374,10 @@ func (r *postgresHabitRepository) list(ctx context.Context, q HabitListQuery) ([
 
 	for rows.Next() {
 		var (
-			creator habitCreator
-			habit   getHabitResponse
+			creator      habitCreator
+			habit        getHabitResponse
+			viewerStreak streak.Streak
+			isMember     bool
 		)
 		err = rows.Scan(
 			&totalRecords,
@@ -227,6 +388,7 @@ func (r *postgresHabitRepository) list(ctx context.Context, q HabitListQuery) ([
 			&habit.EndDate,
 			&habit.DailyCount,
 			&habit.DailyDuration,
+			&habit.Schedule,
 			&habit.PrivacyStatus,
 			&habit.Identifier,
 			&habit.CreatedAt,
@@ -234,6 +396,11 @@ func (r *postgresHabitRepository) list(ctx context.Context, q HabitListQuery) ([
 			&creator.Email,
 			&creator.FirstName,
 			&creator.LastName,
+			&isMember,
+			&habit.Role,
+			&viewerStreak.Current,
+			&viewerStreak.Longest,
+			&viewerStreak.LastMetDate,
 		)
 
 		if err != nil {
@@ -245,9 +412,171 @@ func (r *postgresHabitRepository) list(ctx context.Context, q HabitListQuery) ([
 		}
 
 		habit.Creator = creator
+		if isMember {
+			habit.Streak = &viewerStreak
+		}
 		data = append(data, &habit)
 	}
 
 	metaData = utils.CalculateMetadata(totalRecords, q.Page, q.PageSize)
 	return data, metaData, nil
 }
+
+const transferColumns = `id, habit_id, from_user_id, to_user_id, status, forced, initiated_by, created_at, decided_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTransfer(row rowScanner) (*OwnershipTransfer, error) {
+	var t OwnershipTransfer
+	err := row.Scan(
+		&t.ID,
+		&t.HabitID,
+		&t.FromUserID,
+		&t.ToUserID,
+		&t.Status,
+		&t.Forced,
+		&t.InitiatedBy,
+		&t.CreatedAt,
+		&t.DecidedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *postgresHabitRepository) createTransfer(ctx context.Context, t OwnershipTransfer) (*OwnershipTransfer, error) {
+	query := `
+	INSERT INTO habit_ownership_transfers (habit_id, from_user_id, to_user_id, initiated_by)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + transferColumns
+
+	return scanTransfer(r.db.QueryRowContext(ctx, query, t.HabitID, t.FromUserID, t.ToUserID, t.InitiatedBy))
+}
+
+func (r *postgresHabitRepository) getTransfer(ctx context.Context, id int64) (*OwnershipTransfer, error) {
+	query := `SELECT ` + transferColumns + ` FROM habit_ownership_transfers WHERE id = $1`
+
+	t, err := scanTransfer(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+func (r *postgresHabitRepository) hasPendingTransfer(ctx context.Context, habitID int64) (bool, error) {
+	var result bool
+	query := `SELECT EXISTS(SELECT 1 FROM habit_ownership_transfers WHERE habit_id = $1 AND status = 'pending')`
+	err := r.db.QueryRowContext(ctx, query, habitID).Scan(&result)
+	return result, err
+}
+
+func (r *postgresHabitRepository) listTransfers(ctx context.Context, habitID int64) ([]*OwnershipTransfer, error) {
+	result := []*OwnershipTransfer{}
+
+	query := `
+	SELECT ` + transferColumns + `
+	FROM habit_ownership_transfers
+	WHERE habit_id = $1
+	ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *postgresHabitRepository) decideTransfer(ctx context.Context, id int64, status string) error {
+	query := `
+	UPDATE habit_ownership_transfers
+	SET status = $2, decided_at = NOW()
+	WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, status)
+	return err
+}
+
+// completeTransfer hands the habit over to t.ToUserID in one transaction. The
+// previous owner stays in the habit as a moderator. Accepted transfers must
+// still be pending, so a transfer cancelled or declined in the meantime is not
+// carried out. Forced transfers have no pending row yet and are recorded as
+// accepted right away.
+func (r *postgresHabitRepository) completeTransfer(ctx context.Context, t OwnershipTransfer) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !t.Forced {
+		query := `
+		UPDATE habit_ownership_transfers
+		SET status = 'accepted', decided_at = NOW()
+		WHERE id = $1 AND status = 'pending'`
+		res, err := tx.ExecContext(ctx, query, t.ID)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return errTransferNotPending
+		}
+	}
+
+	query := `UPDATE habit_members SET role = 'owner' WHERE habit_id = $1 AND user_id = $2`
+	res, err := tx.ExecContext(ctx, query, t.HabitID, t.ToUserID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errTransferNotMember
+	}
+
+	query = `UPDATE habit_members SET role = 'moderator' WHERE habit_id = $1 AND role = 'owner' AND user_id <> $2`
+	if _, err = tx.ExecContext(ctx, query, t.HabitID, t.ToUserID); err != nil {
+		return err
+	}
+
+	query = `UPDATE habits SET created_by = $2 WHERE id = $1`
+	if _, err = tx.ExecContext(ctx, query, t.HabitID, t.ToUserID); err != nil {
+		return err
+	}
+
+	if t.Forced {
+		query = `
+		UPDATE habit_ownership_transfers
+		SET status = 'cancelled', decided_at = NOW()
+		WHERE habit_id = $1 AND status = 'pending'`
+		if _, err = tx.ExecContext(ctx, query, t.HabitID); err != nil {
+			return err
+		}
+
+		query = `
+		INSERT INTO habit_ownership_transfers (habit_id, from_user_id, to_user_id, status, forced, initiated_by, decided_at)
+		VALUES ($1, $2, $3, 'accepted', TRUE, $4, NOW())`
+		if _, err = tx.ExecContext(ctx, query, t.HabitID, t.FromUserID, t.ToUserID, t.InitiatedBy); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
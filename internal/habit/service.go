@@ -3,8 +3,14 @@ package habit
 import (
 	"context"
 	"errors"
+	"log"
 	"strings"
+	"time"
 
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/notification"
+	"github.com/NurulloMahmud/habits/internal/streak"
 	cx "github.com/NurulloMahmud/habits/pkg/context"
 	"github.com/NurulloMahmud/habits/pkg/utils"
 	"github.com/google/uuid"
@@ -12,22 +18,48 @@ import (
 
 var (
 	errNoHabitFound = errors.New("No habit data found with given id/identifier")
-	errNotOwner     = errors.New("You are not the owner of this habit")
 	errTypeChange   = errors.New("Habit type cannot be changed. You can only update type's value")
 	errHabitType    = errors.New("habit type can only be quantity or duration")
 	errDateQuery    = errors.New("min date value must not be after max date")
 	errInvalidSort  = errors.New("Invalid sort field value")
+
+	errTransferNotMember  = errors.New("Ownership can only be transferred to a member of the habit")
+	errTransferToOwner    = errors.New("User already owns this habit")
+	errTransferPending    = errors.New("This habit already has a pending ownership transfer")
+	errNoTransfer         = errors.New("No ownership transfer found with given id")
+	errTransferNotPending = errors.New("Ownership transfer is not pending anymore")
+	errTransferStale      = errors.New("Habit owner has changed since the transfer was requested")
+
+	errNotArchived      = errors.New("Habit is neither archived nor deleted")
+	errRestoreNotOwner  = errors.New("Only the habit owner can restore this habit")
+	errRetentionExpired = errors.New("Habit was deleted too long ago and can no longer be restored")
 )
 
 type Service struct {
-	repo HabitRepository
+	repo          HabitRepository
+	streaks       streak.Service
+	access        access.Service
+	notifications notification.Service
+	retention     time.Duration
 }
 
-func NewHabitService(repo HabitRepository) Service {
-	return Service{repo: repo}
+func NewHabitService(repo HabitRepository, streaks streak.Service, access access.Service, notifications notification.Service, cfg config.Config) Service {
+	return Service{
+		repo:          repo,
+		streaks:       streaks,
+		access:        access,
+		notifications: notifications,
+		retention:     cfg.HabitRetention,
+	}
 }
 
-func (s *Service) create(ctx context.Context, data createHabitRequest) (*createHabitRequest, error) {
+func (s *Service) create(ctx context.Context, user cx.User, data createHabitRequest) (*createHabitRequest, error) {
+	if data.PrivacyStatus == "public" {
+		if err := s.access.RequireVerified(user); err != nil {
+			return nil, err
+		}
+	}
+
 	habit, err := s.repo.create(ctx, data)
 	if err != nil {
 		return nil, err
@@ -36,8 +68,8 @@ func (s *Service) create(ctx context.Context, data createHabitRequest) (*createH
 	return habit, nil
 }
 
-func (s *Service) update(ctx context.Context, userID int64, data updateHabitRequest) (*getHabitResponse, error) {
-	habit, err := s.repo.get(ctx, int64(data.ID), "")
+func (s *Service) update(ctx context.Context, user cx.User, data updateHabitRequest) (*getHabitResponse, error) {
+	habit, err := s.repo.get(ctx, int64(data.ID), "", user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +77,9 @@ func (s *Service) update(ctx context.Context, userID int64, data updateHabitRequ
 		return nil, errNoHabitFound
 	}
 
-	if userID != habit.Creator.ID {
-		return nil, errNotOwner
+	_, err = s.access.Require(ctx, user, habit.ID, access.EditHabit)
+	if err != nil {
+		return nil, err
 	}
 
 	// handle habit privacy type
@@ -60,6 +93,9 @@ func (s *Service) update(ctx context.Context, userID int64, data updateHabitRequ
 			habit.PrivacyStatus = *data.PrivacyStatus
 		}
 		if *data.PrivacyStatus == "public" && habit.PrivacyStatus == "private" {
+			if err = s.access.RequireVerified(user); err != nil {
+				return nil, err
+			}
 			habit.Identifier = nil
 			habit.PrivacyStatus = *data.PrivacyStatus
 		}
@@ -102,11 +138,21 @@ func (s *Service) update(ctx context.Context, userID int64, data updateHabitRequ
 		}
 	}
 
-	if data.DailyCount != nil {
+	targetChanged := false
+	if data.Schedule != nil {
+		if err := data.Schedule.Validate(); err != nil {
+			return nil, err
+		}
+		habit.Schedule = *data.Schedule
+		targetChanged = true
+	}
+	if data.DailyCount != nil && *data.DailyCount != *habit.DailyCount {
 		habit.DailyCount = data.DailyCount
+		targetChanged = true
 	}
-	if data.DailyDuration != nil {
+	if data.DailyDuration != nil && *data.DailyDuration != *habit.DailyDuration {
 		habit.DailyDuration = data.DailyDuration
+		targetChanged = true
 	}
 
 	err = s.repo.update(ctx, *habit)
@@ -114,11 +160,19 @@ func (s *Service) update(ctx context.Context, userID int64, data updateHabitRequ
 		return nil, err
 	}
 
+	// a new daily target or schedule changes which days count as met
+	if targetChanged {
+		err = s.streaks.RebuildHabit(ctx, habit.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return habit, nil
 }
 
 func (s *Service) delete(ctx context.Context, user cx.User, habitID int64) error {
-	habit, err := s.repo.get(ctx, habitID, "")
+	habit, err := s.repo.get(ctx, habitID, "", user.ID)
 	if err != nil {
 		return err
 	}
@@ -126,13 +180,105 @@ func (s *Service) delete(ctx context.Context, user cx.User, habitID int64) error
 		return errNoHabitFound
 	}
 
-	if user.ID != habit.Creator.ID && user.UserRole != "admin" {
-		return errNotOwner
+	_, err = s.access.Require(ctx, user, habit.ID, access.DeleteHabit)
+	if err != nil {
+		return err
 	}
 
 	return s.repo.delete(ctx, habitID)
 }
 
+func (s *Service) archive(ctx context.Context, user cx.User, habitID int64) error {
+	habit, err := s.repo.get(ctx, habitID, "", user.ID)
+	if err != nil {
+		return err
+	}
+	if habit == nil {
+		return errNoHabitFound
+	}
+
+	_, err = s.access.Require(ctx, user, habit.ID, access.EditHabit)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.archive(ctx, habitID)
+}
+
+// restore brings back an archived habit, or a deleted one while it is still
+// inside the retention window.
+func (s *Service) restore(ctx context.Context, user cx.User, habitID int64) error {
+	habit, err := s.repo.getArchived(ctx, habitID)
+	if err != nil {
+		return err
+	}
+	if habit == nil {
+		return errNoHabitFound
+	}
+	if habit.ArchivedAt == nil && habit.DeletedAt == nil {
+		return errNotArchived
+	}
+
+	if user.UserRole != "admin" {
+		m, err := s.access.Membership(ctx, habitID, user.ID)
+		if err != nil {
+			return err
+		}
+		if m == nil || !m.Can(access.DeleteHabit) {
+			return errRestoreNotOwner
+		}
+	}
+
+	if habit.DeletedAt != nil && time.Since(*habit.DeletedAt) > s.retention {
+		return errRetentionExpired
+	}
+
+	return s.repo.restore(ctx, habitID)
+}
+
+func (s *Service) listArchived(ctx context.Context, q archivedListQuery) ([]*archivedHabitResponse, utils.Metadata, error) {
+	habits, metaData, err := s.repo.listArchived(ctx, q)
+	if err != nil {
+		return nil, metaData, err
+	}
+
+	for _, habit := range habits {
+		if habit.DeletedAt != nil {
+			purgeAt := habit.DeletedAt.Add(s.retention)
+			habit.PurgeAt = &purgeAt
+		}
+	}
+
+	return habits, metaData, nil
+}
+
+// Purge hard deletes habits whose retention window has passed.
+func (s *Service) Purge(ctx context.Context) (int64, error) {
+	return s.repo.purge(ctx, time.Now().UTC().Add(-s.retention))
+}
+
+// RunPurge calls Purge every interval until ctx is cancelled.
+func (s *Service) RunPurge(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.Purge(ctx)
+			if err != nil {
+				logger.Printf("[ERROR] habit purge: %v\n", err)
+				continue
+			}
+			if purged > 0 {
+				logger.Printf("habit purge: deleted %d habit(s)\n", purged)
+			}
+		}
+	}
+}
+
 func (s *Service) list(ctx context.Context, query HabitListQuery) ([]*getHabitResponse, utils.Metadata, error) {
 	var metaData utils.Metadata
 	_, err := query.getHabitType()
@@ -161,5 +307,183 @@ func (s *Service) list(ctx context.Context, query HabitListQuery) ([]*getHabitRe
 		return nil, metaData, err
 	}
 
+	today := utils.Today(query.location)
+	for _, habit := range data {
+		if habit.Streak != nil {
+			habit.Streak.Resolve(today, habit.Schedule, habit.StartDate)
+		}
+	}
+
 	return data, metaData, nil
 }
+
+// requestTransfer nominates a member as the next owner of the habit. The
+// ownership only changes once the nominee accepts. A failed notification to
+// the nominee is logged, the transfer stays pending.
+func (s *Service) requestTransfer(ctx context.Context, user cx.User, habitID, toUserID int64, logger *log.Logger) (*OwnershipTransfer, error) {
+	habit, err := s.repo.get(ctx, habitID, "", user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if habit == nil {
+		return nil, errNoHabitFound
+	}
+
+	_, err = s.access.Require(ctx, user, habitID, access.TransferOwnership)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.checkTransferTarget(ctx, habit, toUserID); err != nil {
+		return nil, err
+	}
+
+	pending, err := s.repo.hasPendingTransfer(ctx, habitID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, errTransferPending
+	}
+
+	t, err := s.repo.createTransfer(ctx, OwnershipTransfer{
+		HabitID:     habitID,
+		FromUserID:  &habit.Creator.ID,
+		ToUserID:    toUserID,
+		InitiatedBy: &user.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.notifications.Notify(ctx, notification.TypeOwnershipRequest, notification.Payload{
+		HabitID:    &habitID,
+		HabitName:  habit.Name,
+		TransferID: &t.ID,
+		ActorID:    &user.ID,
+	}, toUserID)
+	if err != nil {
+		logger.Printf("[ERROR] ownership transfer %d notification: %v\n", t.ID, err)
+	}
+
+	return t, nil
+}
+
+func (s *Service) acceptTransfer(ctx context.Context, user cx.User, habitID, transferID int64) error {
+	t, err := s.nomineeTransfer(ctx, user, habitID, transferID)
+	if err != nil {
+		return err
+	}
+
+	// the habit may have been force transferred in the meantime
+	habit, err := s.repo.get(ctx, habitID, "", user.ID)
+	if err != nil {
+		return err
+	}
+	if habit == nil {
+		return errNoHabitFound
+	}
+	if t.FromUserID == nil || *t.FromUserID != habit.Creator.ID {
+		if err = s.repo.decideTransfer(ctx, t.ID, transferCancelled); err != nil {
+			return err
+		}
+		return errTransferStale
+	}
+
+	return s.repo.completeTransfer(ctx, *t)
+}
+
+func (s *Service) declineTransfer(ctx context.Context, user cx.User, habitID, transferID int64) error {
+	t, err := s.nomineeTransfer(ctx, user, habitID, transferID)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.decideTransfer(ctx, t.ID, transferDeclined)
+}
+
+func (s *Service) cancelTransfer(ctx context.Context, user cx.User, habitID, transferID int64) error {
+	t, err := s.pendingTransfer(ctx, habitID, transferID)
+	if err != nil {
+		return err
+	}
+	if (t.FromUserID == nil || *t.FromUserID != user.ID) && user.UserRole != "admin" {
+		return errNoTransfer
+	}
+
+	return s.repo.decideTransfer(ctx, t.ID, transferCancelled)
+}
+
+func (s *Service) listTransfers(ctx context.Context, user cx.User, habitID int64) ([]*OwnershipTransfer, error) {
+	_, err := s.access.Require(ctx, user, habitID, access.ViewHabit)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.listTransfers(ctx, habitID)
+}
+
+// forceTransfer lets an admin hand a habit over without the owner, for
+// example when the owner's account is deactivated.
+func (s *Service) forceTransfer(ctx context.Context, admin cx.User, habitID, toUserID int64) error {
+	habit, err := s.repo.get(ctx, habitID, "", admin.ID)
+	if err != nil {
+		return err
+	}
+	if habit == nil {
+		return errNoHabitFound
+	}
+
+	if err = s.checkTransferTarget(ctx, habit, toUserID); err != nil {
+		return err
+	}
+
+	return s.repo.completeTransfer(ctx, OwnershipTransfer{
+		HabitID:     habitID,
+		FromUserID:  &habit.Creator.ID,
+		ToUserID:    toUserID,
+		Forced:      true,
+		InitiatedBy: &admin.ID,
+	})
+}
+
+func (s *Service) checkTransferTarget(ctx context.Context, habit *getHabitResponse, toUserID int64) error {
+	if toUserID == habit.Creator.ID {
+		return errTransferToOwner
+	}
+
+	target, err := s.access.Membership(ctx, habit.ID, toUserID)
+	if err != nil {
+		return err
+	}
+	if target == nil || !target.IsMember() {
+		return errTransferNotMember
+	}
+	return nil
+}
+
+// nomineeTransfer loads a pending transfer of the habit addressed to the user.
+func (s *Service) nomineeTransfer(ctx context.Context, user cx.User, habitID, transferID int64) (*OwnershipTransfer, error) {
+	t, err := s.pendingTransfer(ctx, habitID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if t.ToUserID != user.ID {
+		return nil, errNoTransfer
+	}
+	return t, nil
+}
+
+func (s *Service) pendingTransfer(ctx context.Context, habitID, transferID int64) (*OwnershipTransfer, error) {
+	t, err := s.repo.getTransfer(ctx, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.HabitID != habitID {
+		return nil, errNoTransfer
+	}
+	if t.Status != transferPending {
+		return nil, errTransferNotPending
+	}
+	return t, nil
+}
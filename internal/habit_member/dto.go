@@ -1,12 +1,67 @@
 package habitmember
 
-import "time"
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/habit"
+	"github.com/NurulloMahmud/habits/internal/schedule"
+	"github.com/NurulloMahmud/habits/internal/streak"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+var (
+	errReasonTooLong = errors.New("reason must not be longer than 500 characters")
+	errInvalidStatus = errors.New("status must be one of pending, approved, rejected or cancelled")
+	errEmailFormat   = errors.New("invalid email")
+	errTokenRequired = errors.New("token field is required")
+	errHabitState    = errors.New("habit state can only be upcoming, active or ended")
+	errDateQuery     = errors.New("min date value must not be after max date")
+	errInvalidRole   = errors.New("role must be one of moderator, member or viewer")
+)
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
 type habitMemberCreateRequest struct {
-	UserID  int64 `json:"user_id"`
+	UserID  int64 `json:"-"`
 	HabitID int64 `json:"habit_id"`
 }
 
+type rejectJoinRequest struct {
+	Reason *string `json:"reason"`
+}
+
+func (r *rejectJoinRequest) validate() error {
+	if r.Reason != nil && len(*r.Reason) > 500 {
+		return errReasonTooLong
+	}
+	return nil
+}
+
+type requester struct {
+	ID        int64   `json:"user_id"`
+	Email     string  `json:"email"`
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+}
+
+type joinRequestResponse struct {
+	HabitFollowRequest
+	HabitName string    `json:"habit_name"`
+	Requester requester `json:"requester"`
+}
+
+func validateRequestStatus(status string) error {
+	switch status {
+	case "", requestPending, requestApproved, requestRejected, requestCancelled:
+		return nil
+	}
+	return errInvalidStatus
+}
+
 type habitOwner struct {
 	ID        int64   `json:"user_id"`
 	Email     string  `json:"email"`
@@ -15,15 +70,137 @@ type habitOwner struct {
 }
 
 type userHabitsResponse struct {
-	HabitID       int64      `json:"habit_id"`
-	Name          string     `json:"name"`
-	Description   *string    `json:"description,omitempty"`
-	StartDate     time.Time  `json:"start_date"`
-	EndDate       time.Time  `json:"end_date"`
-	DailyCount    *int64     `json:"daily_count,omitempty"`
-	DailyDuration *int64     `json:"daily_duration,omitempty"`
-	PrivacyStatus string     `json:"privacy_status"`
-	Identifier    *string    `json:"-"`
-	CreatedAt     time.Time  `json:"created_at"`
-	Owner         habitOwner `json:"owner"`
+	HabitID       int64             `json:"habit_id"`
+	Name          string            `json:"name"`
+	Description   *string           `json:"description,omitempty"`
+	StartDate     time.Time         `json:"start_date"`
+	EndDate       time.Time         `json:"end_date"`
+	DailyCount    *int64            `json:"daily_count,omitempty"`
+	DailyDuration *int64            `json:"daily_duration,omitempty"`
+	Schedule      schedule.Schedule `json:"schedule"`
+	PrivacyStatus string            `json:"privacy_status"`
+	Identifier    *string           `json:"-"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Owner         habitOwner        `json:"owner"`
+	Streak        streak.Streak     `json:"streak"`
+	Today         todayProgress     `json:"today"`
+}
+
+// todayProgress is the caller's progress on the current day, in their time zone.
+type todayProgress struct {
+	Date      time.Time `json:"date"`
+	Scheduled bool      `json:"scheduled"`
+	Quantity  *int64    `json:"quantity,omitempty"`
+	Duration  *int64    `json:"duration,omitempty"`
+	Completed bool      `json:"completed"`
+}
+
+type dateFilter struct {
+	minDate *time.Time
+	maxDate *time.Time
+}
+
+func (d dateFilter) validate() error {
+	if d.minDate != nil && d.maxDate != nil && d.maxDate.Before(*d.minDate) {
+		return errDateQuery
+	}
+	return nil
+}
+
+// userHabitsQuery takes the filters of the habit list. The state filter is
+// named apart from the list's privacy status.
+type userHabitsQuery struct {
+	userID    int64
+	habitType string
+	state     string
+	startDate dateFilter
+	endDate   dateFilter
+	createdAt dateFilter
+	today     time.Time
+	utils.Filter
+}
+
+func (q *userHabitsQuery) getHabitType() (string, error) {
+	return habit.TypeFilter(q.habitType)
+}
+
+// getState filters habits by their dates relative to the caller's today ($2).
+func (q *userHabitsQuery) getState() (string, error) {
+	switch q.state {
+	case "":
+		return "1 = 1", nil
+	case "upcoming":
+		return "h.start_date > $2", nil
+	case "active":
+		return "h.start_date <= $2 AND h.end_date >= $2", nil
+	case "ended":
+		return "h.end_date < $2", nil
+	}
+	return "", errHabitState
+}
+
+func (q *userHabitsQuery) validate() error {
+	if _, err := q.getHabitType(); err != nil {
+		return err
+	}
+	if _, err := q.getState(); err != nil {
+		return err
+	}
+	if err := q.startDate.validate(); err != nil {
+		return err
+	}
+	if err := q.endDate.validate(); err != nil {
+		return err
+	}
+	return q.createdAt.validate()
+}
+
+type createInviteRequest struct {
+	Email string `json:"email"`
+}
+
+func (r *createInviteRequest) validate() error {
+	r.Email = strings.TrimSpace(r.Email)
+	if !emailRegex.MatchString(r.Email) {
+		return errEmailFormat
+	}
+	return nil
+}
+
+type acceptInviteRequest struct {
+	Token string `json:"token"`
+}
+
+func (r *acceptInviteRequest) validate() error {
+	if strings.TrimSpace(r.Token) == "" {
+		return errTokenRequired
+	}
+	return nil
+}
+
+// memberResponse carries the email only for callers who manage members.
+type memberResponse struct {
+	UserID    int64     `json:"user_id"`
+	Email     *string   `json:"email,omitempty"`
+	FirstName *string   `json:"first_name"`
+	LastName  *string   `json:"last_name"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+type memberListQuery struct {
+	habitID   int64
+	withEmail bool
+	utils.Filter
+}
+
+type updateRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (r *updateRoleRequest) validate() error {
+	if r.Role == access.RoleOwner || !access.ValidRole(r.Role) {
+		return errInvalidRole
+	}
+	return nil
 }
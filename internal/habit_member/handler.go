@@ -3,10 +3,15 @@ package habitmember
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/pkg/context"
 	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
 )
 
 type Handler struct {
@@ -30,9 +35,12 @@ func (h *Handler) HandleJoinHabit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg, err := h.service.joinHabit(r.Context(), req)
+	user := context.GetUser(r)
+	req.UserID = user.ID
+
+	msg, err := h.service.joinHabit(r.Context(), *user, req, h.logger)
 	if err != nil {
-		if err == sql.ErrNoRows || err == errAlreadyMember {
+		if err == sql.ErrNoRows || err == errAlreadyMember || err == errPendingRequest {
 			response.BadRequest(w, r, err, h.logger)
 			return
 		}
@@ -43,3 +51,370 @@ func (h *Handler) HandleJoinHabit(w http.ResponseWriter, r *http.Request) {
 
 	response.WriteJSON(w, http.StatusCreated, response.Envelope{"message": msg})
 }
+
+func (h *Handler) HandleListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	status := utils.ReadString(r, "status", requestPending)
+	if err = validateRequestStatus(status); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.listJoinRequests(r.Context(), *user, habitID, status)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	requestID, err := utils.ReadInt64Param(r, "requestID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.approveJoinRequest(r.Context(), *user, habitID, requestID, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "join request approved"})
+}
+
+func (h *Handler) HandleRejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, a rejection without a reason is fine
+	var req rejectJoinRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = req.validate()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	requestID, err := utils.ReadInt64Param(r, "requestID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.rejectJoinRequest(r.Context(), *user, habitID, requestID, req.Reason, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "join request rejected"})
+}
+
+func (h *Handler) HandleMyJoinRequests(w http.ResponseWriter, r *http.Request) {
+	status := utils.ReadString(r, "status", requestPending)
+	if err := validateRequestStatus(status); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.userJoinRequests(r.Context(), *user, status)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleCancelJoinRequest(w http.ResponseWriter, r *http.Request) {
+	requestID, err := utils.ReadInt64Param(r, "requestID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.cancelJoinRequest(r.Context(), *user, requestID)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "join request cancelled"})
+}
+
+func (h *Handler) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	var req createInviteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = req.validate()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.createInvite(r.Context(), *user, habitID, req.Email, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data, "message": "invite sent"})
+}
+
+func (h *Handler) HandleAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	var req acceptInviteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = req.validate()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	msg, err := h.service.acceptInvite(r.Context(), *user, req.Token, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": msg})
+}
+
+func (h *Handler) HandleLeaveHabit(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.leaveHabit(r.Context(), *user, habitID)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "you left the habit"})
+}
+
+func (h *Handler) HandleRevokeMember(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	memberID, err := utils.ReadInt64Param(r, "userID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.revokeMember(r.Context(), *user, habitID, memberID)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "membership revoked"})
+}
+
+func (h *Handler) HandleUpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	memberID, err := utils.ReadInt64Param(r, "userID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	var req updateRoleRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.updateMemberRole(r.Context(), *user, habitID, memberID, req.Role)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "member role updated"})
+}
+
+func (h *Handler) HandleListMembers(w http.ResponseWriter, r *http.Request) {
+	var q memberListQuery
+
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.habitID = habitID
+
+	q.Search = utils.ReadString(r, "search", "")
+	q.Sort = utils.ReadString(r, "sort", "created_at")
+	q.PageSize = utils.ReadInt(r, "page_size", 50)
+	q.Page = utils.ReadInt(r, "page", 1)
+	q.SortSafeList = []string{"created_at", "email", "first_name", "last_name"}
+
+	err = q.Filter.Validate()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, metaData, err := h.service.listMembers(r.Context(), *user, q)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"metaData": metaData,
+		"data":     data,
+	})
+}
+
+func (h *Handler) HandleGetMyHabits(w http.ResponseWriter, r *http.Request) {
+	var q userHabitsQuery
+
+	q.Search = utils.ReadString(r, "search", "")
+	q.habitType = utils.ReadString(r, "type", "")
+	q.state = utils.ReadString(r, "state", "")
+	minStartDateStr := utils.ReadString(r, "min_start", "")
+	maxStartDateStr := utils.ReadString(r, "max_start", "")
+	minEndDateStr := utils.ReadString(r, "min_end", "")
+	maxEndDateStr := utils.ReadString(r, "max_end", "")
+	minCreatedAtStr := utils.ReadString(r, "min_created_at", "")
+	maxCreatedAtStr := utils.ReadString(r, "max_created_at", "")
+
+	q.Sort = utils.ReadString(r, "sort", "-id")
+	q.PageSize = utils.ReadInt(r, "page_size", 50)
+	q.Page = utils.ReadInt(r, "page", 1)
+	q.SortSafeList = []string{"id", "name", "created_at", "start_date", "end_date"}
+
+	err := q.Filter.Validate()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	q.startDate.minDate, err = utils.ConvertStrToDate(minStartDateStr)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.startDate.maxDate, err = utils.ConvertStrToDate(maxStartDateStr)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.endDate.minDate, err = utils.ConvertStrToDate(minEndDateStr)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.endDate.maxDate, err = utils.ConvertStrToDate(maxEndDateStr)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.createdAt.minDate, err = utils.ConvertStrToDate(minCreatedAtStr)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.createdAt.maxDate, err = utils.ConvertStrToDate(maxCreatedAtStr)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = q.validate()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, metaData, err := h.service.getUserHabits(r.Context(), *user, q)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"metaData": metaData,
+		"data":     data,
+	})
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case sql.ErrNoRows, access.ErrNoHabit, errNoJoinRequest, errRequestNotPending, errNoHabitFound, errAlreadyMember,
+		errSelfInvite, errInvalidInvite, errInviteUsed, errInviteExpired, errNotHabitMember, errOwnerCannotLeave,
+		errRevokeOwner, errOwnerRole:
+		response.BadRequest(w, r, err, h.logger)
+	case errInviteEmail, errRevokeModerator, errEmailSort:
+		response.Forbidden(w, r, err.Error())
+	default:
+		if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
+			return
+		}
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
@@ -7,6 +7,13 @@ import (
 	"github.com/NurulloMahmud/habits/internal/user"
 )
 
+const (
+	requestPending   = "pending"
+	requestApproved  = "approved"
+	requestRejected  = "rejected"
+	requestCancelled = "cancelled"
+)
+
 type HabitMember struct {
 	ID        int64       `json:"id"`
 	Habit     habit.Habit `json:"habit"`
@@ -15,8 +22,30 @@ type HabitMember struct {
 }
 
 type HabitFollowRequest struct {
-	ID        int64     `json:"id"`
-	HabitID   int64     `json:"habit_id"`
-	UserID    int64     `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int64      `json:"id"`
+	HabitID   int64      `json:"habit_id"`
+	UserID    int64      `json:"user_id"`
+	Status    string     `json:"status"`
+	Reason    *string    `json:"reason,omitempty"`
+	DecidedBy *int64     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type HabitInvite struct {
+	ID        int64      `json:"id"`
+	HabitID   int64      `json:"habit_id"`
+	Email     string     `json:"email"`
+	TokenHash []byte     `json:"-"`
+	InvitedBy int64      `json:"invited_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    *int64     `json:"used_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type inviteHabit struct {
+	ID            int64
+	Name          string
+	PrivacyStatus string
 }
@@ -3,14 +3,35 @@ package habitmember
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/NurulloMahmud/habits/pkg/utils"
 )
 
 type HabitMemberRepository interface {
 	createHabitMember(ctx context.Context, req habitMemberCreateRequest) error
 	createjoinRequest(ctx context.Context, req habitMemberCreateRequest) error
 	isMember(ctx context.Context, habitID, userID int64) (bool, error)
-	getUserHabits(ctx context.Context, userID int64) ([]*userHabitsResponse, error)
+	getUserHabits(ctx context.Context, q userHabitsQuery) ([]*userHabitsResponse, utils.Metadata, error)
 	getHabitPrivacyType(ctx context.Context, habitID int64) (string, error)
+	hasPendingRequest(ctx context.Context, habitID, userID int64) (bool, error)
+	getJoinRequest(ctx context.Context, id int64) (*HabitFollowRequest, error)
+	listHabitJoinRequests(ctx context.Context, habitID int64, status string) ([]*joinRequestResponse, error)
+	listUserJoinRequests(ctx context.Context, userID int64, status string) ([]*joinRequestResponse, error)
+	approveJoinRequest(ctx context.Context, req HabitFollowRequest, decidedBy int64) error
+	decideJoinRequest(ctx context.Context, id int64, status string, reason *string, decidedBy *int64) error
+	getInviteHabit(ctx context.Context, habitID int64) (*inviteHabit, error)
+	createInvite(ctx context.Context, inv HabitInvite) (*HabitInvite, error)
+	getInviteByToken(ctx context.Context, tokenHash []byte) (*HabitInvite, error)
+	acceptInvite(ctx context.Context, inv HabitInvite, userID int64, autoJoin bool) error
+	removeMember(ctx context.Context, habitID, userID int64) error
+	revokeMember(ctx context.Context, habitID, userID, revokedBy int64) error
+	isRevoked(ctx context.Context, habitID, userID int64) (bool, error)
+	listMembers(ctx context.Context, q memberListQuery) ([]*memberResponse, utils.Metadata, error)
+	updateMemberRole(ctx context.Context, habitID, userID int64, role string) error
+	habitManagers(ctx context.Context, habitID int64) ([]int64, error)
+	userIDByEmail(ctx context.Context, email string) (*int64, error)
 }
 
 type postgresRepository struct {
@@ -40,38 +61,82 @@ func (r *postgresRepository) isMember(ctx context.Context, habitID, userID int64
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return result, nil
 }
 
-func (r *postgresRepository) getUserHabits(ctx context.Context, userID int64) ([]*userHabitsResponse, error) {
-	var result []*userHabitsResponse
+func (r *postgresRepository) getUserHabits(ctx context.Context, q userHabitsQuery) ([]*userHabitsResponse, utils.Metadata, error) {
+	result := []*userHabitsResponse{}
+	var metaData utils.Metadata
+	var totalRecords int
 
-	query := `
+	habitType, _ := q.getHabitType()
+	state, _ := q.getState()
+	query := fmt.Sprintf(`
 	SELECT 
+		COUNT(*) OVER(),
 		h.created_by,
 		(SELECT email FROM users WHERE id = h.created_by) email,
 		(SELECT first_name FROM users WHERE id = h.created_by) first_name,
 		(SELECT last_name FROM users WHERE id = h.created_by) last_name,
-		h.id,
-		h.name,
+		h.id id,
+		h.name name,
 		h.description,
-		h.start_date,
-		h.end_date,
+		h.start_date start_date,
+		h.end_date end_date,
 		h.daily_count,
 		h.daily_duration,
+		h.schedule,
 		h.privacy_status,
 		h.identifier,
-		h.created_at
+		h.created_at created_at,
+		COALESCE(st.current_streak, 0),
+		COALESCE(st.longest_streak, 0),
+		st.last_met_date,
+		tp.quantity,
+		tp.duration
 	FROM 
 		habit_members hms
 		JOIN habits h ON h.id = hms.habit_id
+		LEFT JOIN habit_streaks st ON st.habit_id = hms.habit_id AND st.user_id = hms.user_id
+		LEFT JOIN LATERAL (
+			SELECT
+				SUM(p.quantity) quantity,
+				(EXTRACT(EPOCH FROM SUM(p.duration)) / 60)::BIGINT duration
+			FROM habit_performance p
+			WHERE p.habit_id = h.id AND p.user_id = hms.user_id AND p.date = $2
+		) tp ON TRUE
 	WHERE 
-		hms.user_id = $1
-	ORDER BY hms.id DESC`
+		hms.user_id = $1 AND
+		h.archived_at IS NULL AND
+		h.deleted_at IS NULL AND
+		(%s) AND
+		(%s) AND
+		(h.name ILIKE $3 || '%%' OR $3 = '') AND
+		(h.start_date >= $4 OR $4 IS NULL) AND
+		(h.start_date <= $5 OR $5 IS NULL) AND
+		(h.end_date >= $6 OR $6 IS NULL) AND
+		(h.end_date <= $7 OR $7 IS NULL) AND
+		(h.created_at::date >= $8 OR $8 IS NULL) AND
+		(h.created_at::date <= $9 OR $9 IS NULL)
+	ORDER BY %s, hms.id DESC
+	LIMIT $10 OFFSET $11`, habitType, state, q.GetSort())
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	rows, err := r.db.QueryContext(
+		ctx, query,
+		q.userID,
+		q.today,
+		q.Search,
+		q.startDate.minDate,
+		q.startDate.maxDate,
+		q.endDate.minDate,
+		q.endDate.maxDate,
+		q.createdAt.minDate,
+		q.createdAt.maxDate,
+		q.Limit(),
+		q.Offset(),
+	)
 	if err != nil {
-		return nil, err
+		return nil, metaData, err
 	}
 	defer rows.Close()
 
@@ -80,6 +145,7 @@ func (r *postgresRepository) getUserHabits(ctx context.Context, userID int64) ([
 		var userHabit userHabitsResponse
 
 		err = rows.Scan(
+			&totalRecords,
 			&owner.ID,
 			&owner.Email,
 			&owner.FirstName,
@@ -91,25 +157,468 @@ func (r *postgresRepository) getUserHabits(ctx context.Context, userID int64) ([
 			&userHabit.EndDate,
 			&userHabit.DailyCount,
 			&userHabit.DailyDuration,
+			&userHabit.Schedule,
 			&userHabit.PrivacyStatus,
 			&userHabit.Identifier,
 			&userHabit.CreatedAt,
+			&userHabit.Streak.Current,
+			&userHabit.Streak.Longest,
+			&userHabit.Streak.LastMetDate,
+			&userHabit.Today.Quantity,
+			&userHabit.Today.Duration,
 		)
 
 		if err != nil {
-			return nil, err
+			return nil, metaData, err
 		}
 
 		userHabit.Owner = owner
 		result = append(result, &userHabit)
 	}
 
-	return result, nil
+	metaData = utils.CalculateMetadata(totalRecords, q.Page, q.PageSize)
+	return result, metaData, rows.Err()
 }
 
 func (r *postgresRepository) getHabitPrivacyType(ctx context.Context, habitID int64) (string, error) {
 	var result string
-	query := `SELECT privacy_status FROM habits WHERE id = $1`
+	query := `SELECT privacy_status FROM habits WHERE id = $1 AND archived_at IS NULL AND deleted_at IS NULL`
 	err := r.db.QueryRowContext(ctx, query, habitID).Scan(&result)
 	return result, err
 }
+
+func (r *postgresRepository) hasPendingRequest(ctx context.Context, habitID, userID int64) (bool, error) {
+	var result bool
+	query := `SELECT EXISTS(SELECT 1 FROM habit_follow_requests WHERE habit_id = $1 AND user_id = $2 AND status = 'pending')`
+	err := r.db.QueryRowContext(ctx, query, habitID, userID).Scan(&result)
+	return result, err
+}
+
+func (r *postgresRepository) getJoinRequest(ctx context.Context, id int64) (*HabitFollowRequest, error) {
+	var req HabitFollowRequest
+
+	query := `
+	SELECT id, habit_id, user_id, status, reason, decided_by, decided_at, created_at
+	FROM habit_follow_requests
+	WHERE id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&req.ID,
+		&req.HabitID,
+		&req.UserID,
+		&req.Status,
+		&req.Reason,
+		&req.DecidedBy,
+		&req.DecidedAt,
+		&req.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+func (r *postgresRepository) listHabitJoinRequests(ctx context.Context, habitID int64, status string) ([]*joinRequestResponse, error) {
+	return r.listJoinRequests(ctx, "fr.habit_id = $1", habitID, status)
+}
+
+func (r *postgresRepository) listUserJoinRequests(ctx context.Context, userID int64, status string) ([]*joinRequestResponse, error) {
+	return r.listJoinRequests(ctx, "fr.user_id = $1", userID, status)
+}
+
+func (r *postgresRepository) listJoinRequests(ctx context.Context, where string, id int64, status string) ([]*joinRequestResponse, error) {
+	result := []*joinRequestResponse{}
+
+	query := `
+	SELECT
+		fr.id,
+		fr.habit_id,
+		fr.user_id,
+		fr.status,
+		fr.reason,
+		fr.decided_by,
+		fr.decided_at,
+		fr.created_at,
+		h.name,
+		u.email,
+		u.first_name,
+		u.last_name
+	FROM habit_follow_requests fr
+	JOIN habits h ON h.id = fr.habit_id
+	JOIN users u ON u.id = fr.user_id
+	WHERE ` + where + ` AND ($2 = '' OR fr.status = $2)
+	ORDER BY fr.created_at DESC, fr.id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, id, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var req joinRequestResponse
+		err = rows.Scan(
+			&req.ID,
+			&req.HabitID,
+			&req.UserID,
+			&req.Status,
+			&req.Reason,
+			&req.DecidedBy,
+			&req.DecidedAt,
+			&req.CreatedAt,
+			&req.HabitName,
+			&req.Requester.Email,
+			&req.Requester.FirstName,
+			&req.Requester.LastName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Requester.ID = req.UserID
+		result = append(result, &req)
+	}
+
+	return result, rows.Err()
+}
+
+// approveJoinRequest marks the request approved and adds the requester to
+// habit_members in one transaction.
+func (r *postgresRepository) approveJoinRequest(ctx context.Context, req HabitFollowRequest, decidedBy int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE habit_follow_requests
+	SET status = 'approved', decided_by = $1, decided_at = $2
+	WHERE id = $3 AND status = 'pending'`
+
+	res, err := tx.ExecContext(ctx, query, decidedBy, time.Now().UTC(), req.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errRequestNotPending
+	}
+
+	memberQuery := `
+	INSERT INTO habit_members (habit_id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT (habit_id, user_id) DO NOTHING`
+	_, err = tx.ExecContext(ctx, memberQuery, req.HabitID, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	// an approval lifts an earlier revocation
+	revocationQuery := `DELETE FROM habit_member_revocations WHERE habit_id = $1 AND user_id = $2`
+	_, err = tx.ExecContext(ctx, revocationQuery, req.HabitID, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) decideJoinRequest(ctx context.Context, id int64, status string, reason *string, decidedBy *int64) error {
+	query := `
+	UPDATE habit_follow_requests
+	SET status = $1, reason = $2, decided_by = $3, decided_at = $4
+	WHERE id = $5 AND status = 'pending'`
+
+	res, err := r.db.ExecContext(ctx, query, status, reason, decidedBy, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errRequestNotPending
+	}
+	return nil
+}
+
+func (r *postgresRepository) getInviteHabit(ctx context.Context, habitID int64) (*inviteHabit, error) {
+	var h inviteHabit
+
+	query := `SELECT id, name, privacy_status FROM habits WHERE id = $1 AND archived_at IS NULL AND deleted_at IS NULL`
+	err := r.db.QueryRowContext(ctx, query, habitID).Scan(&h.ID, &h.Name, &h.PrivacyStatus)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+func (r *postgresRepository) createInvite(ctx context.Context, inv HabitInvite) (*HabitInvite, error) {
+	query := `
+	INSERT INTO habit_invites (habit_id, email, token_hash, invited_by, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(
+		ctx, query,
+		inv.HabitID,
+		inv.Email,
+		inv.TokenHash,
+		inv.InvitedBy,
+		inv.ExpiresAt,
+	).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+func (r *postgresRepository) getInviteByToken(ctx context.Context, tokenHash []byte) (*HabitInvite, error) {
+	var inv HabitInvite
+
+	query := `
+	SELECT id, habit_id, email, token_hash, invited_by, expires_at, used_at, used_by, created_at
+	FROM habit_invites
+	WHERE token_hash = $1`
+
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&inv.ID,
+		&inv.HabitID,
+		&inv.Email,
+		&inv.TokenHash,
+		&inv.InvitedBy,
+		&inv.ExpiresAt,
+		&inv.UsedAt,
+		&inv.UsedBy,
+		&inv.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// acceptInvite consumes the invite and either adds the user to the habit or
+// files a join request for the owner, in one transaction.
+func (r *postgresRepository) acceptInvite(ctx context.Context, inv HabitInvite, userID int64, autoJoin bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE habit_invites
+	SET used_at = $1, used_by = $2
+	WHERE id = $3 AND used_at IS NULL`
+
+	res, err := tx.ExecContext(ctx, query, time.Now().UTC(), userID, inv.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errInviteUsed
+	}
+
+	if autoJoin {
+		query = `
+		INSERT INTO habit_members (habit_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (habit_id, user_id) DO NOTHING`
+	} else {
+		query = `
+		INSERT INTO habit_follow_requests (habit_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (habit_id, user_id) WHERE status = 'pending' DO NOTHING`
+	}
+	_, err = tx.ExecContext(ctx, query, inv.HabitID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) removeMember(ctx context.Context, habitID, userID int64) error {
+	query := `DELETE FROM habit_members WHERE habit_id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, habitID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotHabitMember
+	}
+	return nil
+}
+
+// revokeMember removes the member and records the revocation, so rejoining
+// needs a new approval.
+func (r *postgresRepository) revokeMember(ctx context.Context, habitID, userID, revokedBy int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM habit_members WHERE habit_id = $1 AND user_id = $2`
+	res, err := tx.ExecContext(ctx, query, habitID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotHabitMember
+	}
+
+	query = `
+	INSERT INTO habit_member_revocations (habit_id, user_id, revoked_by, revoked_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (habit_id, user_id) DO UPDATE
+	SET revoked_by = EXCLUDED.revoked_by, revoked_at = EXCLUDED.revoked_at`
+	_, err = tx.ExecContext(ctx, query, habitID, userID, revokedBy, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) isRevoked(ctx context.Context, habitID, userID int64) (bool, error) {
+	var result bool
+	query := `SELECT EXISTS(SELECT 1 FROM habit_member_revocations WHERE habit_id = $1 AND user_id = $2)`
+	err := r.db.QueryRowContext(ctx, query, habitID, userID).Scan(&result)
+	return result, err
+}
+
+func (r *postgresRepository) listMembers(ctx context.Context, q memberListQuery) ([]*memberResponse, utils.Metadata, error) {
+	result := []*memberResponse{}
+	var metaData utils.Metadata
+	var totalRecords int
+
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			u.id user_id,
+			CASE WHEN $5 THEN u.email END email,
+			u.first_name first_name,
+			u.last_name last_name,
+			hm.role role,
+			hm.created_at created_at
+		FROM habit_members hm
+		JOIN users u ON u.id = hm.user_id
+		WHERE
+			hm.habit_id = $1 AND
+			(
+				$2 = '' OR
+				($5 AND u.email ILIKE $2 || '%%') OR
+				u.first_name ILIKE $2 || '%%' OR
+				u.last_name ILIKE $2 || '%%'
+			)
+		ORDER BY %s, hm.id
+		LIMIT $3 OFFSET $4`, q.GetSort())
+
+	rows, err := r.db.QueryContext(ctx, query, q.habitID, q.Search, q.Limit(), q.Offset(), q.withEmail)
+	if err != nil {
+		return nil, metaData, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m memberResponse
+		err = rows.Scan(
+			&totalRecords,
+			&m.UserID,
+			&m.Email,
+			&m.FirstName,
+			&m.LastName,
+			&m.Role,
+			&m.JoinedAt,
+		)
+		if err != nil {
+			return nil, metaData, err
+		}
+		result = append(result, &m)
+	}
+
+	metaData = utils.CalculateMetadata(totalRecords, q.Page, q.PageSize)
+	return result, metaData, rows.Err()
+}
+
+func (r *postgresRepository) updateMemberRole(ctx context.Context, habitID, userID int64, role string) error {
+	query := `UPDATE habit_members SET role = $3 WHERE habit_id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, habitID, userID, role)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotHabitMember
+	}
+	return nil
+}
+
+// habitManagers returns the owner and moderators of the habit.
+func (r *postgresRepository) habitManagers(ctx context.Context, habitID int64) ([]int64, error) {
+	var result []int64
+
+	query := `SELECT user_id FROM habit_members WHERE habit_id = $1 AND role IN ('owner', 'moderator')`
+	rows, err := r.db.QueryContext(ctx, query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		if err = rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		result = append(result, userID)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *postgresRepository) userIDByEmail(ctx context.Context, email string) (*int64, error) {
+	var result int64
+	query := `SELECT id FROM users WHERE LOWER(email) = LOWER($1)`
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -3,23 +3,65 @@ package habitmember
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/auth"
+	"github.com/NurulloMahmud/habits/internal/notification"
+	"github.com/NurulloMahmud/habits/internal/platform/mailer"
+	"github.com/NurulloMahmud/habits/internal/realtime"
 	cx "github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/utils"
 )
 
 var (
-	errAlreadyMember = errors.New("You are already a member of this habit")
+	errAlreadyMember     = errors.New("You are already a member of this habit")
+	errPendingRequest    = errors.New("You already have a pending join request for this habit")
+	errNoJoinRequest     = errors.New("No join request found with given id")
+	errRequestNotPending = errors.New("Join request is not pending anymore")
+	errNoHabitFound      = errors.New("No habit data found with given id")
+	errSelfInvite        = errors.New("You cannot invite yourself")
+	errInvalidInvite     = errors.New("Invalid invite token")
+	errInviteUsed        = errors.New("This invite has already been used")
+	errInviteExpired     = errors.New("This invite has expired")
+	errInviteEmail       = errors.New("This invite was sent to a different email address")
+	errNotHabitMember    = errors.New("User is not a member of this habit")
+	errOwnerCannotLeave  = errors.New("Habit owner cannot leave the habit, transfer the ownership first")
+	errRevokeOwner       = errors.New("Habit owner's membership cannot be revoked")
+	errRevokeModerator   = errors.New("Only the habit owner can revoke a moderator's membership")
+	errOwnerRole         = errors.New("Owner role cannot be changed, transfer the ownership instead")
+	errEmailSort         = errors.New("Only the habit owner or a moderator can sort members by email")
 )
 
 type Service struct {
-	repo HabitMemberRepository
+	repo          HabitMemberRepository
+	access        access.Service
+	notifications notification.Service
+	events        *realtime.Hub
+	mailer        mailer.Mailer
+	cfg           config.Config
 }
 
-func NewService(hmRepo HabitMemberRepository) Service {
-	return Service{repo: hmRepo}
+func NewService(hmRepo HabitMemberRepository, access access.Service, notifications notification.Service, events *realtime.Hub, m mailer.Mailer, cfg config.Config) Service {
+	return Service{
+		repo:          hmRepo,
+		access:        access,
+		notifications: notifications,
+		events:        events,
+		mailer:        m,
+		cfg:           cfg,
+	}
 }
 
-func (s *Service) joinHabit(ctx context.Context, req habitMemberCreateRequest) (string, error) {
+// joinHabit adds the user to a public habit or files a join request. The
+// request is stored before the managers are notified, a failed notification
+// is logged and does not fail the request.
+func (s *Service) joinHabit(ctx context.Context, user cx.User, req habitMemberCreateRequest, logger *log.Logger) (string, error) {
 	privacyType, err := s.repo.getHabitPrivacyType(ctx, req.HabitID)
 	if err != nil {
 		return "", err
@@ -34,21 +76,409 @@ func (s *Service) joinHabit(ctx context.Context, req habitMemberCreateRequest) (
 		return "", errAlreadyMember
 	}
 
-	user, _ := ctx.Value("user").(*cx.User)
+	revoked, err := s.repo.isRevoked(ctx, req.HabitID, req.UserID)
+	if err != nil {
+		return "", err
+	}
 
-	if privacyType == "public" || user.UserRole == "admin" {
+	if (privacyType == "public" && !revoked) || user.UserRole == "admin" {
 		err = s.repo.createHabitMember(ctx, req)
 		if err != nil {
 			return "", err
 		}
 
+		s.publishMember(ctx, req.HabitID, realtime.TypeMemberJoined, req.UserID, access.RoleMember)
 		return "Member joined successfully", nil
 	}
 
+	pending, err := s.repo.hasPendingRequest(ctx, req.HabitID, req.UserID)
+	if err != nil {
+		return "", err
+	}
+	if pending {
+		return "", errPendingRequest
+	}
+
 	err = s.repo.createjoinRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 
-	return "Join request has been sent to habit owner", err
+	if err = s.notifyManagers(ctx, req.HabitID, user.ID); err != nil {
+		logger.Printf("[ERROR] join request notification for habit %d: %v\n", req.HabitID, err)
+	}
+
+	return "Join request has been sent to habit owner", nil
+}
+
+// notifyManagers tells the habit owner and moderators about a new join request.
+func (s *Service) notifyManagers(ctx context.Context, habitID, requesterID int64) error {
+	managers, err := s.repo.habitManagers(ctx, habitID)
+	if err != nil {
+		return err
+	}
+
+	return s.notifications.Notify(ctx, notification.TypeJoinRequest, notification.Payload{
+		HabitID: &habitID,
+		ActorID: &requesterID,
+	}, managers...)
+}
+
+func (s *Service) getUserHabits(ctx context.Context, user cx.User, q userHabitsQuery) ([]*userHabitsResponse, utils.Metadata, error) {
+	q.userID = user.ID
+	q.today = utils.Today(user.Location())
+
+	habits, metaData, err := s.repo.getUserHabits(ctx, q)
+	if err != nil {
+		return nil, metaData, err
+	}
+
+	for _, habit := range habits {
+		habit.Streak.Resolve(q.today, habit.Schedule, habit.StartDate)
+
+		_, scheduled := habit.Schedule.Period(q.today, habit.StartDate)
+		habit.Today.Date = q.today
+		habit.Today.Scheduled = scheduled && !q.today.Before(habit.StartDate) && !q.today.After(habit.EndDate)
+
+		switch {
+		case habit.DailyCount != nil && habit.Today.Quantity != nil:
+			habit.Today.Completed = *habit.Today.Quantity >= *habit.DailyCount
+		case habit.DailyDuration != nil && habit.Today.Duration != nil:
+			habit.Today.Completed = *habit.Today.Duration >= *habit.DailyDuration
+		}
+	}
+
+	return habits, metaData, nil
+}
+
+func (s *Service) listJoinRequests(ctx context.Context, user cx.User, habitID int64, status string) ([]*joinRequestResponse, error) {
+	if _, err := s.access.Require(ctx, user, habitID, access.ManageRequests); err != nil {
+		return nil, err
+	}
+
+	return s.repo.listHabitJoinRequests(ctx, habitID, status)
+}
+
+// approveJoinRequest adds the requester to the habit. The requester is told
+// after the fact, a failed notification is logged.
+func (s *Service) approveJoinRequest(ctx context.Context, user cx.User, habitID, requestID int64, logger *log.Logger) error {
+	req, err := s.habitJoinRequest(ctx, user, habitID, requestID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.approveJoinRequest(ctx, *req, user.ID)
+	if err != nil {
+		return err
+	}
+	s.publishMember(ctx, habitID, realtime.TypeMemberJoined, req.UserID, access.RoleMember)
+
+	err = s.notifications.Notify(ctx, notification.TypeJoinApproved, notification.Payload{
+		HabitID: &habitID,
+		ActorID: &user.ID,
+	}, req.UserID)
+	if err != nil {
+		logger.Printf("[ERROR] join request %d approval notification: %v\n", req.ID, err)
+	}
+	return nil
+}
+
+// rejectJoinRequest declines the request. As with approvals, a failed
+// notification is logged.
+func (s *Service) rejectJoinRequest(ctx context.Context, user cx.User, habitID, requestID int64, reason *string, logger *log.Logger) error {
+	req, err := s.habitJoinRequest(ctx, user, habitID, requestID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.decideJoinRequest(ctx, req.ID, requestRejected, reason, &user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.notifications.Notify(ctx, notification.TypeJoinRejected, notification.Payload{
+		HabitID: &habitID,
+		ActorID: &user.ID,
+		Reason:  reason,
+	}, req.UserID)
+	if err != nil {
+		logger.Printf("[ERROR] join request %d rejection notification: %v\n", req.ID, err)
+	}
+	return nil
+}
+
+func (s *Service) userJoinRequests(ctx context.Context, user cx.User, status string) ([]*joinRequestResponse, error) {
+	return s.repo.listUserJoinRequests(ctx, user.ID, status)
+}
+
+func (s *Service) cancelJoinRequest(ctx context.Context, user cx.User, requestID int64) error {
+	req, err := s.repo.getJoinRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	if req == nil || req.UserID != user.ID {
+		return errNoJoinRequest
+	}
+	if req.Status != requestPending {
+		return errRequestNotPending
+	}
+
+	return s.repo.decideJoinRequest(ctx, req.ID, requestCancelled, nil, nil)
+}
+
+// habitJoinRequest loads a pending join request of the habit for its owner
+// or a moderator.
+func (s *Service) habitJoinRequest(ctx context.Context, user cx.User, habitID, requestID int64) (*HabitFollowRequest, error) {
+	if _, err := s.access.Require(ctx, user, habitID, access.ManageRequests); err != nil {
+		return nil, err
+	}
+
+	req, err := s.repo.getJoinRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil || req.HabitID != habitID {
+		return nil, errNoJoinRequest
+	}
+	if req.Status != requestPending {
+		return nil, errRequestNotPending
+	}
+
+	return req, nil
+}
+
+// createInvite stores an invite and delivers it by email, and to the inbox of
+// a registered invitee. Delivery happens after the invite is stored, so its
+// failures are logged rather than returned.
+func (s *Service) createInvite(ctx context.Context, user cx.User, habitID int64, email string, logger *log.Logger) (*HabitInvite, error) {
+	habit, err := s.repo.getInviteHabit(ctx, habitID)
+	if err != nil {
+		return nil, err
+	}
+	if habit == nil {
+		return nil, errNoHabitFound
+	}
+
+	_, err = s.access.Require(ctx, user, habitID, access.Invite)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.access.RequireVerified(user); err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(email, user.Email) {
+		return nil, errSelfInvite
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invite, err := s.repo.createInvite(ctx, HabitInvite{
+		HabitID:   habitID,
+		Email:     email,
+		TokenHash: hash,
+		InvitedBy: user.ID,
+		ExpiresAt: time.Now().UTC().Add(s.cfg.InviteTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// registered users also see the invite in their inbox
+	if err = s.notifyInvitee(ctx, user, habitID, habit.Name, email); err != nil {
+		logger.Printf("[ERROR] invite %d notification: %v\n", invite.ID, err)
+	}
+
+	link := fmt.Sprintf("%s/invites/accept?token=%s", s.cfg.AppBaseURL, url.QueryEscape(token))
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: fmt.Sprintf("You are invited to join %q", habit.Name),
+		Body: fmt.Sprintf(
+			"%s invited you to join the habit %q.\n\nAccept the invite here: %s\n\nThe link expires on %s.\n",
+			user.Email, habit.Name, link, invite.ExpiresAt.Format(time.RFC1123),
+		),
+	})
+	if err != nil {
+		logger.Printf("[ERROR] invite %d email: %v\n", invite.ID, err)
+	}
+
+	return invite, nil
+}
+
+func (s *Service) notifyInvitee(ctx context.Context, user cx.User, habitID int64, habitName, email string) error {
+	inviteeID, err := s.repo.userIDByEmail(ctx, email)
+	if err != nil || inviteeID == nil {
+		return err
+	}
+
+	return s.notifications.Notify(ctx, notification.TypeInvite, notification.Payload{
+		HabitID:   &habitID,
+		HabitName: habitName,
+		ActorID:   &user.ID,
+	}, *inviteeID)
+}
+
+// acceptInvite consumes an invite for the signed in user. Invites sent by the
+// habit owner or a moderator are an approval on their own, any other invite
+// turns into a join request the owner has to approve.
+func (s *Service) acceptInvite(ctx context.Context, user cx.User, token string, logger *log.Logger) (string, error) {
+	invite, err := s.repo.getInviteByToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return "", err
+	}
+	if invite == nil {
+		return "", errInvalidInvite
+	}
+	if invite.UsedAt != nil {
+		return "", errInviteUsed
+	}
+	if time.Now().UTC().After(invite.ExpiresAt) {
+		return "", errInviteExpired
+	}
+	if !strings.EqualFold(invite.Email, user.Email) {
+		return "", errInviteEmail
+	}
+
+	member, err := s.repo.isMember(ctx, invite.HabitID, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if member {
+		return "", errAlreadyMember
+	}
+
+	habit, err := s.repo.getInviteHabit(ctx, invite.HabitID)
+	if err != nil {
+		return "", err
+	}
+	if habit == nil {
+		return "", errNoHabitFound
+	}
+
+	revoked, err := s.repo.isRevoked(ctx, invite.HabitID, user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	inviter, err := s.access.Membership(ctx, invite.HabitID, invite.InvitedBy)
+	if err != nil {
+		return "", err
+	}
+	approved := inviter != nil && inviter.Can(access.ManageRequests)
+
+	// revoked members always go through a new approval
+	autoJoin := (habit.PrivacyStatus == "public" || approved) && !revoked
+	err = s.repo.acceptInvite(ctx, *invite, user.ID, autoJoin)
+	if err != nil {
+		return "", err
+	}
+
+	if autoJoin {
+		s.publishMember(ctx, invite.HabitID, realtime.TypeMemberJoined, user.ID, access.RoleMember)
+		return "Member joined successfully", nil
+	}
+
+	if err = s.notifyManagers(ctx, invite.HabitID, user.ID); err != nil {
+		logger.Printf("[ERROR] join request notification for habit %d: %v\n", invite.HabitID, err)
+	}
+	return "Join request has been sent to habit owner", nil
+}
+
+func (s *Service) leaveHabit(ctx context.Context, user cx.User, habitID int64) error {
+	m, err := s.access.Membership(ctx, habitID, user.ID)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errNoHabitFound
+	}
+	if m.Role == access.RoleOwner {
+		return errOwnerCannotLeave
+	}
+
+	err = s.repo.removeMember(ctx, habitID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	s.publishMember(ctx, habitID, realtime.TypeMemberLeft, user.ID, "")
+	return nil
+}
+
+func (s *Service) revokeMember(ctx context.Context, user cx.User, habitID, memberID int64) error {
+	actor, err := s.access.Require(ctx, user, habitID, access.RemoveMembers)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.access.Membership(ctx, habitID, memberID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case target == nil || !target.IsMember():
+		return errNotHabitMember
+	case target.Role == access.RoleOwner:
+		return errRevokeOwner
+	case target.Role == access.RoleModerator && !actor.Can(access.ManageRoles) && user.UserRole != "admin":
+		return errRevokeModerator
+	}
+
+	err = s.repo.revokeMember(ctx, habitID, memberID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	s.publishMember(ctx, habitID, realtime.TypeMemberRemoved, memberID, "")
+	return nil
+}
+
+func (s *Service) updateMemberRole(ctx context.Context, user cx.User, habitID, memberID int64, role string) error {
+	if _, err := s.access.Require(ctx, user, habitID, access.ManageRoles); err != nil {
+		return err
+	}
+
+	target, err := s.access.Membership(ctx, habitID, memberID)
+	if err != nil {
+		return err
+	}
+	if target == nil || !target.IsMember() {
+		return errNotHabitMember
+	}
+	if target.Role == access.RoleOwner {
+		return errOwnerRole
+	}
+
+	err = s.repo.updateMemberRole(ctx, habitID, memberID, role)
+	if err != nil {
+		return err
+	}
+
+	s.publishMember(ctx, habitID, realtime.TypeMemberRole, memberID, role)
+	return nil
+}
+
+// publishMember streams a membership change to the habit's live watchers.
+func (s *Service) publishMember(ctx context.Context, habitID int64, typ string, userID int64, role string) {
+	s.events.Publish(ctx, habitID, typ, realtime.MemberChange{UserID: userID, Role: role})
+}
+
+func (s *Service) listMembers(ctx context.Context, user cx.User, q memberListQuery) ([]*memberResponse, utils.Metadata, error) {
+	var metaData utils.Metadata
+
+	m, err := s.access.Require(ctx, user, q.habitID, access.ViewHabit)
+	if err != nil {
+		return nil, metaData, err
+	}
+
+	// emails are only shown to those who manage the members
+	q.withEmail = s.access.Allows(user, *m, access.RemoveMembers)
+	if !q.withEmail && strings.TrimPrefix(q.Sort, "-") == "email" {
+		return nil, metaData, errEmailSort
+	}
+
+	return s.repo.listMembers(ctx, q)
 }
@@ -0,0 +1,19 @@
+package identity
+
+import "errors"
+
+type callbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+func (r *callbackRequest) validate() error {
+	if r.Code == "" || r.State == "" {
+		return errors.New("code and state are required")
+	}
+	return nil
+}
+
+type authorization struct {
+	URL string `json:"authorization_url"`
+}
@@ -0,0 +1,152 @@
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleProviders(w http.ResponseWriter, r *http.Request) {
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": h.service.listProviders()})
+}
+
+func (h *Handler) HandleBeginLogin(w http.ResponseWriter, r *http.Request) {
+	data, err := h.service.begin(r.Context(), chi.URLParam(r, "provider"), nil)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+// HandleFinishLogin takes the code and state the provider redirected back
+// with and replies like the password login.
+func (h *Handler) HandleFinishLogin(w http.ResponseWriter, r *http.Request) {
+	var req callbackRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	result, err := h.service.finishLogin(r.Context(), chi.URLParam(r, "provider"), req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if result.Challenge != nil {
+		response.WriteJSON(w, http.StatusOK, response.Envelope{
+			"two_factor_required": true,
+			"challenge":           result.Challenge,
+		})
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"access_token":  result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"user":          result.User,
+	})
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	data, err := h.service.list(r.Context(), *user)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleBeginLink(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	data, err := h.service.begin(r.Context(), chi.URLParam(r, "provider"), &user.ID)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleFinishLink(w http.ResponseWriter, r *http.Request) {
+	var req callbackRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.finishLink(r.Context(), *user, chi.URLParam(r, "provider"), req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleUnlink(w http.ResponseWriter, r *http.Request) {
+	identityID, err := utils.ReadInt64Param(r, "identityID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	if err = h.service.unlink(r.Context(), *user, identityID); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "account unlinked"})
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errProviderRejected),
+		errors.Is(err, errUnknownProvider),
+		errors.Is(err, errInvalidState),
+		errors.Is(err, errEmailNotVerified),
+		errors.Is(err, errLocalNotVerified),
+		errors.Is(err, errIdentityTaken),
+		errors.Is(err, errProviderLinked),
+		errors.Is(err, errNoIdentityFound):
+		response.BadRequest(w, r, err, h.logger)
+	case errors.Is(err, errLoginFailed), errors.Is(err, errLinkStateMismatch):
+		response.Unauthorized(w, r, err.Error())
+	default:
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
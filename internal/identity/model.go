@@ -0,0 +1,32 @@
+package identity
+
+import "time"
+
+// Identity links a user to their account at an OpenID Connect provider.
+type Identity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"-"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// State is an authorization request waiting for the provider to redirect
+// back. UserID is set when a logged in user links a new identity.
+type State struct {
+	ID           int64
+	StateHash    []byte
+	Provider     string
+	UserID       *int64
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// localUser is the part of a users row needed to decide on linking.
+type localUser struct {
+	ID            int64
+	EmailVerified bool
+}
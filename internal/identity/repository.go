@@ -0,0 +1,185 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Repository interface {
+	create(ctx context.Context, i Identity) (*Identity, error)
+	get(ctx context.Context, id int64) (*Identity, error)
+	getBySubject(ctx context.Context, provider, subject string) (*Identity, error)
+	listByUser(ctx context.Context, userID int64) ([]*Identity, error)
+	delete(ctx context.Context, id int64) error
+	markUsed(ctx context.Context, id int64, email string) error
+	createState(ctx context.Context, s State) error
+	takeState(ctx context.Context, stateHash []byte, provider string) (*State, error)
+	getLocalUser(ctx context.Context, email string) (*localUser, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const identityColumns = `
+	id,
+	user_id,
+	provider,
+	subject,
+	email,
+	last_login_at,
+	created_at`
+
+func scanIdentity(row interface{ Scan(...any) error }, i *Identity) error {
+	return row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.LastLoginAt,
+		&i.CreatedAt,
+	)
+}
+
+func (r *postgresRepository) create(ctx context.Context, i Identity) (*Identity, error) {
+	query := `
+	INSERT INTO user_identities (user_id, provider, subject, email)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query, i.UserID, i.Provider, i.Subject, i.Email).Scan(&i.ID, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (r *postgresRepository) get(ctx context.Context, id int64) (*Identity, error) {
+	var i Identity
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE id = $1`
+
+	err := scanIdentity(r.db.QueryRowContext(ctx, query, id), &i)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (r *postgresRepository) getBySubject(ctx context.Context, provider, subject string) (*Identity, error) {
+	var i Identity
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	err := scanIdentity(r.db.QueryRowContext(ctx, query, provider, subject), &i)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (r *postgresRepository) listByUser(ctx context.Context, userID int64) ([]*Identity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		var i Identity
+		if err = scanIdentity(rows, &i); err != nil {
+			return nil, err
+		}
+		identities = append(identities, &i)
+	}
+
+	return identities, rows.Err()
+}
+
+func (r *postgresRepository) delete(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM user_identities WHERE id = $1`, id)
+	return err
+}
+
+func (r *postgresRepository) markUsed(ctx context.Context, id int64, email string) error {
+	query := `UPDATE user_identities SET email = COALESCE(NULLIF($1, ''), email), last_login_at = CURRENT_TIMESTAMP WHERE id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, email, id)
+	return err
+}
+
+func (r *postgresRepository) createState(ctx context.Context, s State) error {
+	query := `
+	INSERT INTO oidc_states (state_hash, provider, user_id, nonce, code_verifier, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := r.db.ExecContext(ctx, query, s.StateHash, s.Provider, s.UserID, s.Nonce, s.CodeVerifier, s.ExpiresAt)
+	return err
+}
+
+// takeState marks an open state as used and returns it, so an authorization
+// response can only be redeemed once.
+func (r *postgresRepository) takeState(ctx context.Context, stateHash []byte, provider string) (*State, error) {
+	var s State
+	query := `
+	UPDATE oidc_states
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE state_hash = $1 AND provider = $2 AND used_at IS NULL AND expires_at > $3
+	RETURNING id, state_hash, provider, user_id, nonce, code_verifier, expires_at`
+
+	err := r.db.QueryRowContext(ctx, query, stateHash, provider, time.Now().UTC()).Scan(
+		&s.ID,
+		&s.StateHash,
+		&s.Provider,
+		&s.UserID,
+		&s.Nonce,
+		&s.CodeVerifier,
+		&s.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// getLocalUser finds the user with the email, ignoring case. Should the
+// email exist in several spellings, a verified one wins.
+func (r *postgresRepository) getLocalUser(ctx context.Context, email string) (*localUser, error) {
+	var u localUser
+	query := `
+	SELECT id, email_verified_at IS NOT NULL
+	FROM users
+	WHERE lower(email) = lower($1)
+	ORDER BY email_verified_at IS NULL, id
+	LIMIT 1`
+
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&u.ID, &u.EmailVerified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
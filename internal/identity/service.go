@@ -0,0 +1,258 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/auth"
+	"github.com/NurulloMahmud/habits/internal/user"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+const stateTTL = 10 * time.Minute
+
+var (
+	errUnknownProvider   = errors.New("Unknown sign in provider")
+	errInvalidState      = errors.New("Sign in request is invalid or expired")
+	errProviderRejected  = errors.New("Sign in with the provider could not be verified")
+	errEmailNotVerified  = errors.New("The provider did not confirm your email, log in with your password and link the account instead")
+	errLocalNotVerified  = errors.New("An account with this email exists but its email is not verified, log in with your password and link the account instead")
+	errLoginFailed       = errors.New("Sign in failed")
+	errIdentityTaken     = errors.New("This account is already linked to another user")
+	errProviderLinked    = errors.New("You already linked an account of this provider")
+	errNoIdentityFound   = errors.New("No linked account found with given id")
+	errLinkStateMismatch = errors.New("Sign in request was started by another user")
+)
+
+// Users is what signing in with a provider needs from the user service.
+type Users interface {
+	RegisterExternal(ctx context.Context, email string, firstName, lastName *string) (*user.User, error)
+	ExternalLogin(ctx context.Context, userID int64) (*user.LoginResult, error)
+}
+
+type Service struct {
+	repo      Repository
+	users     Users
+	providers map[string]*auth.OIDCClient
+	names     []string
+}
+
+func NewService(repo Repository, users Users, cfg config.Config) Service {
+	s := Service{
+		repo:      repo,
+		users:     users,
+		providers: map[string]*auth.OIDCClient{},
+		names:     []string{},
+	}
+	for _, p := range cfg.OIDCProviders {
+		s.providers[p.Name] = auth.NewOIDCClient(p, http.DefaultClient)
+		s.names = append(s.names, p.Name)
+	}
+	return s
+}
+
+func (s *Service) listProviders() []string {
+	return s.names
+}
+
+func (s *Service) provider(name string) (*auth.OIDCClient, error) {
+	client, ok := s.providers[name]
+	if !ok {
+		return nil, errUnknownProvider
+	}
+	return client, nil
+}
+
+// begin starts an authorization request and returns the provider URL to send
+// the user to. The state, nonce and PKCE verifier stay on the server.
+func (s *Service) begin(ctx context.Context, provider string, userID *int64) (*authorization, error) {
+	client, err := s.provider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	state, stateHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := auth.NewPKCEVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := client.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.createState(ctx, State{
+		StateHash:    stateHash,
+		Provider:     provider,
+		UserID:       userID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(stateTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &authorization{URL: authURL}, nil
+}
+
+// exchange redeems the state and the authorization code for the verified ID
+// token claims.
+func (s *Service) exchange(ctx context.Context, provider string, req callbackRequest) (*auth.OIDCClaims, *State, error) {
+	client, err := s.provider(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state, err := s.repo.takeState(ctx, auth.HashToken(req.State), provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state == nil {
+		return nil, nil, errInvalidState
+	}
+
+	claims, err := client.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errProviderRejected, err)
+	}
+	return claims, state, nil
+}
+
+// finishLogin signs the user in with the provider account. A new account is
+// linked to the user with the same email, or a user is created, but only when
+// the provider verified the email. An existing user must have verified the
+// email as well, otherwise whoever registered it could have been someone else
+// who still knows the password.
+func (s *Service) finishLogin(ctx context.Context, provider string, req callbackRequest) (*user.LoginResult, error) {
+	claims, state, err := s.exchange(ctx, provider, req)
+	if err != nil {
+		return nil, err
+	}
+	if state.UserID != nil {
+		return nil, errInvalidState
+	}
+
+	identity, err := s.repo.getBySubject(ctx, provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		if !claims.EmailVerified || claims.Email == "" {
+			return nil, errEmailNotVerified
+		}
+
+		local, err := s.repo.getLocalUser(ctx, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+		if local != nil && !local.EmailVerified {
+			return nil, errLocalNotVerified
+		}
+		if local == nil {
+			created, err := s.users.RegisterExternal(ctx, claims.Email, optional(claims.GivenName), optional(claims.FamilyName))
+			if err != nil {
+				return nil, err
+			}
+			local = &localUser{ID: created.ID, EmailVerified: true}
+		}
+
+		identity, err = s.repo.create(ctx, Identity{
+			UserID:   local.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.repo.markUsed(ctx, identity.ID, claims.Email); err != nil {
+		return nil, err
+	}
+
+	result, err := s.users.ExternalLogin(ctx, identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errLoginFailed
+	}
+	return result, nil
+}
+
+// finishLink links the provider account to the logged in user who started
+// the request.
+func (s *Service) finishLink(ctx context.Context, u cx.User, provider string, req callbackRequest) (*Identity, error) {
+	claims, state, err := s.exchange(ctx, provider, req)
+	if err != nil {
+		return nil, err
+	}
+	if state.UserID == nil || *state.UserID != u.ID {
+		return nil, errLinkStateMismatch
+	}
+
+	existing, err := s.repo.getBySubject(ctx, provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.UserID != u.ID {
+			return nil, errIdentityTaken
+		}
+		return existing, nil
+	}
+
+	identities, err := s.repo.listByUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range identities {
+		if i.Provider == provider {
+			return nil, errProviderLinked
+		}
+	}
+
+	return s.repo.create(ctx, Identity{
+		UserID:   u.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+}
+
+func (s *Service) list(ctx context.Context, u cx.User) ([]*Identity, error) {
+	return s.repo.listByUser(ctx, u.ID)
+}
+
+func (s *Service) unlink(ctx context.Context, u cx.User, id int64) error {
+	identity, err := s.repo.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if identity == nil || identity.UserID != u.ID {
+		return errNoIdentityFound
+	}
+	return s.repo.delete(ctx, id)
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,350 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/auth/oidctest"
+	"github.com/NurulloMahmud/habits/internal/user"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+// memoryRepository keeps identities and open states in memory. Methods the
+// tests do not reach panic through the nil embedded interface.
+type memoryRepository struct {
+	Repository
+	identities []*Identity
+	states     []State
+	users      map[string]*localUser
+}
+
+func (r *memoryRepository) find(match func(i *Identity) bool) *Identity {
+	if i := slices.IndexFunc(r.identities, match); i >= 0 {
+		copied := *r.identities[i]
+		return &copied
+	}
+	return nil
+}
+
+func (r *memoryRepository) create(ctx context.Context, i Identity) (*Identity, error) {
+	i.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, &i)
+	copied := i
+	return &copied, nil
+}
+
+func (r *memoryRepository) get(ctx context.Context, id int64) (*Identity, error) {
+	return r.find(func(i *Identity) bool { return i.ID == id }), nil
+}
+
+func (r *memoryRepository) getBySubject(ctx context.Context, provider, subject string) (*Identity, error) {
+	return r.find(func(i *Identity) bool { return i.Provider == provider && i.Subject == subject }), nil
+}
+
+func (r *memoryRepository) listByUser(ctx context.Context, userID int64) ([]*Identity, error) {
+	list := []*Identity{}
+	for _, i := range r.identities {
+		if i.UserID == userID {
+			list = append(list, i)
+		}
+	}
+	return list, nil
+}
+
+func (r *memoryRepository) delete(ctx context.Context, id int64) error {
+	r.identities = slices.DeleteFunc(r.identities, func(i *Identity) bool { return i.ID == id })
+	return nil
+}
+
+func (r *memoryRepository) markUsed(ctx context.Context, id int64, email string) error {
+	return nil
+}
+
+func (r *memoryRepository) createState(ctx context.Context, s State) error {
+	r.states = append(r.states, s)
+	return nil
+}
+
+func (r *memoryRepository) takeState(ctx context.Context, stateHash []byte, provider string) (*State, error) {
+	i := slices.IndexFunc(r.states, func(s State) bool {
+		return string(s.StateHash) == string(stateHash) && s.Provider == provider
+	})
+	if i < 0 {
+		return nil, nil
+	}
+	s := r.states[i]
+	r.states = slices.Delete(r.states, i, i+1)
+	return &s, nil
+}
+
+func (r *memoryRepository) getLocalUser(ctx context.Context, email string) (*localUser, error) {
+	return r.users[strings.ToLower(email)], nil
+}
+
+// fakeUsers records registrations and logs anyone in.
+type fakeUsers struct {
+	registered []string
+	loggedIn   []int64
+}
+
+func (f *fakeUsers) RegisterExternal(ctx context.Context, email string, firstName, lastName *string) (*user.User, error) {
+	f.registered = append(f.registered, email)
+	return &user.User{ID: int64(1000 + len(f.registered)), Email: email}, nil
+}
+
+func (f *fakeUsers) ExternalLogin(ctx context.Context, userID int64) (*user.LoginResult, error) {
+	f.loggedIn = append(f.loggedIn, userID)
+	return &user.LoginResult{User: &user.User{ID: userID}, Tokens: &user.TokenPair{AccessToken: "access"}}, nil
+}
+
+func newTestService(t *testing.T) (*Service, *memoryRepository, *fakeUsers, *oidctest.Provider) {
+	t.Helper()
+
+	p := oidctest.NewProvider(t, "client-1", "secret-1")
+	repo := &memoryRepository{users: map[string]*localUser{}}
+	users := &fakeUsers{}
+	cfg := config.Config{OIDCProviders: []config.OIDCProvider{{
+		Name:         "mock",
+		Issuer:       p.URL,
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+		RedirectURL:  "http://app.test/login/oidc/mock/callback",
+		Scopes:       []string{"openid", "email"},
+	}}}
+
+	s := NewService(repo, users, cfg)
+	return &s, repo, users, p
+}
+
+// signIn starts a request, lets the provider authorize it with the claims
+// and returns the callback the app would receive.
+func signIn(t *testing.T, s *Service, p *oidctest.Provider, userID *int64, claims map[string]any) callbackRequest {
+	t.Helper()
+
+	auth, err := s.begin(context.Background(), "mock", userID)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	code, state, err := p.Authorize(auth.URL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return callbackRequest{Code: code, State: state}
+}
+
+func verifiedEmail(email string) map[string]any {
+	return map[string]any{"email": email, "email_verified": true}
+}
+
+func TestLoginCreatesUserForVerifiedEmail(t *testing.T) {
+	s, _, users, p := newTestService(t)
+
+	result, err := s.finishLogin(context.Background(), "mock", signIn(t, s, p, nil, verifiedEmail("new@example.com")))
+	if err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+	if len(users.registered) != 1 || result.User.ID != 1001 {
+		t.Fatalf("registered %v, logged in %d", users.registered, result.User.ID)
+	}
+
+	// the second login finds the identity
+	result, err = s.finishLogin(context.Background(), "mock", signIn(t, s, p, nil, verifiedEmail("new@example.com")))
+	if err != nil {
+		t.Fatalf("second finishLogin: %v", err)
+	}
+	if len(users.registered) != 1 || result.User.ID != 1001 {
+		t.Fatalf("second login registered again or logged in %d", result.User.ID)
+	}
+}
+
+func TestLoginRejectsUnverifiedProviderEmail(t *testing.T) {
+	s, repo, users, p := newTestService(t)
+	repo.users["victim@example.com"] = &localUser{ID: 1, EmailVerified: true}
+
+	for _, value := range []any{false, "false", nil} {
+		claims := map[string]any{"email": "victim@example.com", "email_verified": value}
+		_, err := s.finishLogin(context.Background(), "mock", signIn(t, s, p, nil, claims))
+		if !errors.Is(err, errEmailNotVerified) {
+			t.Fatalf("email_verified=%v: err = %v, want %v", value, err, errEmailNotVerified)
+		}
+	}
+	if len(repo.identities) != 0 || len(users.loggedIn) != 0 {
+		t.Fatal("unverified provider email was linked or logged in")
+	}
+}
+
+func TestLoginLinksVerifiedLocalUser(t *testing.T) {
+	s, repo, users, p := newTestService(t)
+	repo.users["ada@example.com"] = &localUser{ID: 7, EmailVerified: true}
+
+	result, err := s.finishLogin(context.Background(), "mock", signIn(t, s, p, nil, verifiedEmail("Ada@Example.com")))
+	if err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+	if result.User.ID != 7 || len(users.registered) != 0 {
+		t.Fatalf("logged in %d, registered %v", result.User.ID, users.registered)
+	}
+}
+
+func TestLoginRefusesUnverifiedLocalUser(t *testing.T) {
+	s, repo, users, p := newTestService(t)
+	// someone registered the victim's email but never verified it
+	repo.users["victim@example.com"] = &localUser{ID: 7, EmailVerified: false}
+
+	_, err := s.finishLogin(context.Background(), "mock", signIn(t, s, p, nil, verifiedEmail("victim@example.com")))
+	if !errors.Is(err, errLocalNotVerified) {
+		t.Fatalf("err = %v, want %v", err, errLocalNotVerified)
+	}
+	if len(repo.identities) != 0 || len(users.loggedIn) != 0 {
+		t.Fatal("identity was linked to an unverified account")
+	}
+}
+
+func TestStateIsSingleUse(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	req := signIn(t, s, p, nil, verifiedEmail("ada@example.com"))
+
+	if _, err := s.finishLogin(context.Background(), "mock", req); err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+	if _, err := s.finishLogin(context.Background(), "mock", req); !errors.Is(err, errInvalidState) {
+		t.Fatalf("replayed state: err = %v, want %v", err, errInvalidState)
+	}
+}
+
+func TestUnknownState(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	req := signIn(t, s, p, nil, verifiedEmail("ada@example.com"))
+	req.State = "forged"
+
+	if _, err := s.finishLogin(context.Background(), "mock", req); !errors.Is(err, errInvalidState) {
+		t.Fatalf("err = %v, want %v", err, errInvalidState)
+	}
+}
+
+func TestUnknownProvider(t *testing.T) {
+	s, _, _, _ := newTestService(t)
+	if _, err := s.begin(context.Background(), "other", nil); !errors.Is(err, errUnknownProvider) {
+		t.Fatalf("err = %v, want %v", err, errUnknownProvider)
+	}
+}
+
+func TestAuthorizationURL(t *testing.T) {
+	s, repo, _, _ := newTestService(t)
+	auth, err := s.begin(context.Background(), "mock", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(auth.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Fatalf("authorization URL misses PKCE, state or nonce: %s", auth.URL)
+	}
+	// the verifier never leaves the server
+	if strings.Contains(auth.URL, repo.states[0].CodeVerifier) {
+		t.Fatal("authorization URL contains the code verifier")
+	}
+}
+
+func TestLoginRejectsLinkState(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	userID := int64(7)
+
+	_, err := s.finishLogin(context.Background(), "mock", signIn(t, s, p, &userID, verifiedEmail("ada@example.com")))
+	if !errors.Is(err, errInvalidState) {
+		t.Fatalf("err = %v, want %v", err, errInvalidState)
+	}
+}
+
+func TestLinkAndUnlink(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	ada := cx.User{ID: 7}
+
+	// the provider email does not need to match or be verified for linking
+	identity, err := s.finishLink(context.Background(), ada, "mock", signIn(t, s, p, &ada.ID, map[string]any{"email": "ada@work.example"}))
+	if err != nil {
+		t.Fatalf("finishLink: %v", err)
+	}
+	if identity.UserID != 7 || identity.Provider != "mock" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	list, err := s.list(context.Background(), ada)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list = %v, %v", list, err)
+	}
+
+	// logging in with the linked account works without any email
+	result, err := s.finishLogin(context.Background(), "mock", signIn(t, s, p, nil, map[string]any{"email": nil}))
+	if err != nil || result.User.ID != 7 {
+		t.Fatalf("login with linked identity: %v", err)
+	}
+
+	// someone else cannot unlink it
+	if err = s.unlink(context.Background(), cx.User{ID: 8}, identity.ID); !errors.Is(err, errNoIdentityFound) {
+		t.Fatalf("unlink by other user: err = %v, want %v", err, errNoIdentityFound)
+	}
+
+	if err = s.unlink(context.Background(), ada, identity.ID); err != nil {
+		t.Fatalf("unlink: %v", err)
+	}
+	list, _ = s.list(context.Background(), ada)
+	if len(list) != 0 {
+		t.Fatalf("identity still linked after unlink: %v", list)
+	}
+}
+
+func TestLinkStateOfAnotherUser(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	ada := int64(7)
+
+	req := signIn(t, s, p, &ada, nil)
+	if _, err := s.finishLink(context.Background(), cx.User{ID: 8}, "mock", req); !errors.Is(err, errLinkStateMismatch) {
+		t.Fatalf("err = %v, want %v", err, errLinkStateMismatch)
+	}
+}
+
+func TestLinkIdentityTaken(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	ada, bob := cx.User{ID: 7}, cx.User{ID: 8}
+
+	if _, err := s.finishLink(context.Background(), ada, "mock", signIn(t, s, p, &ada.ID, nil)); err != nil {
+		t.Fatalf("finishLink: %v", err)
+	}
+	_, err := s.finishLink(context.Background(), bob, "mock", signIn(t, s, p, &bob.ID, nil))
+	if !errors.Is(err, errIdentityTaken) {
+		t.Fatalf("err = %v, want %v", err, errIdentityTaken)
+	}
+}
+
+func TestLinkSecondAccountOfProvider(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	ada := cx.User{ID: 7}
+
+	if _, err := s.finishLink(context.Background(), ada, "mock", signIn(t, s, p, &ada.ID, nil)); err != nil {
+		t.Fatalf("finishLink: %v", err)
+	}
+	_, err := s.finishLink(context.Background(), ada, "mock", signIn(t, s, p, &ada.ID, map[string]any{"sub": "subject-2"}))
+	if !errors.Is(err, errProviderLinked) {
+		t.Fatalf("err = %v, want %v", err, errProviderLinked)
+	}
+}
+
+func TestLinkRejectsBadNonce(t *testing.T) {
+	s, _, _, p := newTestService(t)
+	ada := cx.User{ID: 7}
+
+	_, err := s.finishLink(context.Background(), ada, "mock", signIn(t, s, p, &ada.ID, map[string]any{"nonce": "forged"}))
+	if !errors.Is(err, errProviderRejected) {
+		t.Fatalf("err = %v, want %v", err, errProviderRejected)
+	}
+}
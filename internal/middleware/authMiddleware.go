@@ -4,10 +4,13 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/NurulloMahmud/habits/internal/apitoken"
 	"github.com/NurulloMahmud/habits/internal/auth"
 	"github.com/NurulloMahmud/habits/pkg/context"
 	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/tomasen/realip"
 )
 
 var (
@@ -17,6 +20,7 @@ var (
 func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
+		r = context.SetClient(r, context.Client{IP: realip.FromRequest(r), UserAgent: r.UserAgent()})
 		authHeader := r.Header.Get("Authorization")
 
 		if authHeader == "" {
@@ -31,15 +35,38 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// personal access tokens are told apart from JWTs by their prefix
 		token := headerParts[1]
-		claims, err := auth.VerifyToken(token, m.cfg.JWTSecret)
-		if err != nil {
-			m.logger.Printf("error -> ", err.Error())
-			response.Unauthorized(w, r, "invalid token")
-			return
+		var userID int64
+		var scopes []string
+		var expiresAt *time.Time
+		var claims *auth.TokenClaims
+		if strings.HasPrefix(token, apitoken.TokenPrefix) {
+			pat, err := m.tokens.Authenticate(r.Context(), token)
+			if err != nil {
+				response.InternalServerError(w, r, err, m.logger)
+				return
+			}
+			if pat == nil {
+				response.Unauthorized(w, r, "invalid token")
+				return
+			}
+			userID, scopes, expiresAt = pat.UserID, pat.Scopes, pat.ExpiresAt
+		} else {
+			var err error
+			claims, err = auth.VerifyToken(token, m.keys)
+			if err != nil {
+				m.logger.Printf("error -> %s", err.Error())
+				response.Unauthorized(w, r, "invalid token")
+				return
+			}
+			userID = claims.ID
+			if claims.ExpiresAt != nil {
+				expiresAt = &claims.ExpiresAt.Time
+			}
 		}
 
-		user, err := m.userRepo.Get(r.Context(), claims.ID, "")
+		user, err := m.userRepo.Get(r.Context(), userID, "")
 		if err != nil {
 			response.InternalServerError(w, r, err, m.logger)
 			return
@@ -50,6 +77,24 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if claims != nil && user.TokensRevokedBefore.Valid && claims.IssuedBefore(user.TokensRevokedBefore.Time) {
+			response.Unauthorized(w, r, "token has been revoked")
+			return
+		}
+
+		// tokens issued before sessions were recorded have no session
+		if claims != nil && claims.SessionID != 0 {
+			active, err := m.sessions.Active(r.Context(), claims.SessionID)
+			if err != nil {
+				response.InternalServerError(w, r, err, m.logger)
+				return
+			}
+			if !active {
+				response.Unauthorized(w, r, "session has been signed out")
+				return
+			}
+		}
+
 		if !user.IsActive || user.IsLocked {
 			r = context.SetUser(r, context.AnonymousUser)
 			next.ServeHTTP(w, r)
@@ -57,13 +102,20 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		contextUser := context.User{
-			ID:        user.ID,
-			Email:     user.Email,
-			FirstName: user.FirstName,
-			LastName:  user.LastName,
-			UserRole:  user.UserRole,
-			IsActive:  user.IsActive,
-			IsLocked:  user.IsLocked,
+			ID:            user.ID,
+			Email:         user.Email,
+			FirstName:     user.FirstName,
+			LastName:      user.LastName,
+			UserRole:      user.UserRole,
+			IsActive:      user.IsActive,
+			IsLocked:      user.IsLocked,
+			Timezone:      user.Timezone,
+			EmailVerified: user.EmailVerifiedAt != nil,
+			Scopes:        scopes,
+			ExpiresAt:     expiresAt,
+		}
+		if claims != nil {
+			contextUser.SessionID = claims.SessionID
 		}
 
 		r = context.SetUser(r, &contextUser)
@@ -71,6 +123,29 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// QueryToken takes the bearer token from the access_token query parameter
+// when the Authorization header is missing. Browsers cannot set headers on an
+// EventSource, so it is only meant for streaming endpoints. The parameter is
+// removed from the URL so error and activity logs never contain the token.
+func (m *Middleware) QueryToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Has("access_token") {
+			token := query.Get("access_token")
+			query.Del("access_token")
+
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = query.Encode()
+			r.RequestURI = r.URL.RequestURI()
+			if r.Header.Get("Authorization") == "" && token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (m *Middleware) RequireUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userContext := context.GetUser(r)
@@ -83,6 +158,34 @@ func (m *Middleware) RequireUser(next http.Handler) http.Handler {
 	})
 }
 
+// RequireScope lets requests made with a personal access token through only
+// when the token has the scope. Login sessions always pass.
+func (m *Middleware) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !context.GetUser(r).HasScope(scope) {
+				response.Forbidden(w, r, "access token is missing the "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession keeps personal access tokens away from account settings and
+// admin endpoints, those need a login session.
+func (m *Middleware) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if context.GetUser(r).Scopes != nil {
+			response.Forbidden(w, r, "personal access tokens cannot be used here")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (m *Middleware) RequireAdminUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userContext := context.GetUser(r)
@@ -4,19 +4,28 @@ import (
 	"log"
 
 	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/apitoken"
+	"github.com/NurulloMahmud/habits/internal/auth"
+	"github.com/NurulloMahmud/habits/internal/session"
 	"github.com/NurulloMahmud/habits/internal/user"
 )
 
 type Middleware struct {
 	logger   *log.Logger
 	userRepo user.Repository
+	keys     *auth.KeySet
+	tokens   apitoken.Service
+	sessions session.Service
 	cfg      config.Config
 }
 
-func NewMiddleware(logger *log.Logger, repo user.Repository, cfg config.Config) *Middleware {
+func NewMiddleware(logger *log.Logger, repo user.Repository, keys *auth.KeySet, tokens apitoken.Service, sessions session.Service, cfg config.Config) *Middleware {
 	return &Middleware{
 		logger:   logger,
 		userRepo: repo,
+		keys:     keys,
+		tokens:   tokens,
+		sessions: sessions,
 		cfg:      cfg,
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/pkg/context"
 	"github.com/NurulloMahmud/habits/pkg/response"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
@@ -66,3 +68,56 @@ func (m *Middleware) RateLimit(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// UserRateLimit limits requests per signed in user with its own limiter
+// settings. It has to run after RequireUser.
+func (m *Middleware) UserRateLimit(limiter config.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !limiter.Enabbled {
+			return next
+		}
+
+		var (
+			mu      sync.Mutex
+			clients = make(map[int64]*client)
+		)
+
+		go func() {
+			for {
+				time.Sleep(time.Minute)
+				mu.Lock()
+
+				for id, client := range clients {
+					if time.Since(client.lastSeen) >= time.Minute*3 {
+						delete(clients, id)
+					}
+				}
+
+				mu.Unlock()
+			}
+		}()
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := context.GetUser(r)
+			mu.Lock()
+
+			if _, found := clients[user.ID]; !found {
+				clients[user.ID] = &client{
+					limiter: rate.NewLimiter(rate.Limit(limiter.RPS), limiter.Burst),
+				}
+			}
+
+			clients[user.ID].lastSeen = time.Now()
+
+			if !clients[user.ID].limiter.Allow() {
+				mu.Unlock()
+				response.RateLimitExceeded(w, r)
+				return
+			}
+
+			mu.Unlock()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package notification
+
+import "errors"
+
+var errInvalidLimit = errors.New("limit must be between 1 and 100")
+
+type listQuery struct {
+	userID     int64
+	unreadOnly bool
+	beforeID   int64
+	limit      int
+}
+
+func (q *listQuery) validate() error {
+	if q.limit < 1 || q.limit > 100 {
+		return errInvalidLimit
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	var q listQuery
+
+	unread, err := utils.ReadBool(r, "unread")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.unreadOnly = unread != nil && *unread
+	q.beforeID = int64(utils.ReadInt(r, "before", 0))
+	q.limit = utils.ReadInt(r, "limit", 20)
+
+	if err = q.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	q.userID = user.ID
+	data, next, err := h.service.list(r.Context(), q)
+	if err != nil {
+		response.InternalServerError(w, r, err, h.logger)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"data":        data,
+		"next_before": next,
+	})
+}
+
+func (h *Handler) HandleUnreadCount(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	count, err := h.service.unreadCount(r.Context(), user.ID)
+	if err != nil {
+		response.InternalServerError(w, r, err, h.logger)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": map[string]int64{"unread": count}})
+}
+
+func (h *Handler) HandleMarkRead(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadInt64Param(r, "notificationID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.markRead(r.Context(), user.ID, id)
+	if err != nil {
+		if err == errNoNotification {
+			response.BadRequest(w, r, err, h.logger)
+			return
+		}
+		response.InternalServerError(w, r, err, h.logger)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "notification marked as read"})
+}
+
+func (h *Handler) HandleMarkAllRead(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	updated, err := h.service.markAllRead(r.Context(), user.ID)
+	if err != nil {
+		response.InternalServerError(w, r, err, h.logger)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": map[string]int64{"updated": updated}})
+}
@@ -0,0 +1,62 @@
+package notification
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	TypeJoinRequest      = "join_request"
+	TypeJoinApproved     = "join_request_approved"
+	TypeJoinRejected     = "join_request_rejected"
+	TypeInvite           = "habit_invite"
+	TypeMention          = "mention"
+	TypePostComment      = "post_comment"
+	TypeStreakAtRisk     = "streak_at_risk"
+	TypeOwnershipRequest = "ownership_transfer"
+	TypeTimerAutoStopped = "timer_auto_stopped"
+)
+
+// Payload points the client at what the notification is about, so it can
+// deep-link to the habit, post or comment.
+type Payload struct {
+	HabitID    *int64     `json:"habit_id,omitempty"`
+	HabitName  string     `json:"habit_name,omitempty"`
+	PostID     *int64     `json:"post_id,omitempty"`
+	CommentID  *int64     `json:"comment_id,omitempty"`
+	TransferID *int64     `json:"transfer_id,omitempty"`
+	SessionID  *int64     `json:"session_id,omitempty"`
+	ActorID    *int64     `json:"actor_id,omitempty"`
+	Reason     *string    `json:"reason,omitempty"`
+	Streak     int64      `json:"streak,omitempty"`
+	PeriodEnd  *time.Time `json:"period_end,omitempty"`
+}
+
+func (p Payload) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *Payload) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*p = Payload{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	}
+	return fmt.Errorf("cannot scan %T into notification payload", src)
+}
+
+type Notification struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"-"`
+	Type      string     `json:"type"`
+	Payload   Payload    `json:"payload"`
+	DedupeKey *string    `json:"-"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
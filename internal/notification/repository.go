@@ -0,0 +1,92 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Repository interface {
+	create(ctx context.Context, n Notification) error
+	list(ctx context.Context, q listQuery) ([]*Notification, error)
+	unreadCount(ctx context.Context, userID int64) (int64, error)
+	markRead(ctx context.Context, userID, id int64) (bool, error)
+	markAllRead(ctx context.Context, userID int64) (int64, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) create(ctx context.Context, n Notification) error {
+	query := `
+	INSERT INTO notifications (user_id, type, payload, dedupe_key)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, n.UserID, n.Type, n.Payload, n.DedupeKey)
+	return err
+}
+
+// list returns the newest notifications with an id below q.beforeID.
+func (r *postgresRepository) list(ctx context.Context, q listQuery) ([]*Notification, error) {
+	result := []*Notification{}
+
+	query := `
+	SELECT id, user_id, type, payload, read_at, created_at
+	FROM notifications
+	WHERE
+		user_id = $1 AND
+		($2 = FALSE OR read_at IS NULL) AND
+		($3 = 0 OR id < $3)
+	ORDER BY id DESC
+	LIMIT $4`
+
+	rows, err := r.db.QueryContext(ctx, query, q.userID, q.unreadOnly, q.beforeID, q.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Notification
+		err = rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Payload, &n.ReadAt, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &n)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *postgresRepository) unreadCount(ctx context.Context, userID int64) (int64, error) {
+	var result int64
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&result)
+	return result, err
+}
+
+func (r *postgresRepository) markRead(ctx context.Context, userID, id int64) (bool, error) {
+	query := `
+	UPDATE notifications
+	SET read_at = COALESCE(read_at, NOW())
+	WHERE id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *postgresRepository) markAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,73 @@
+package notification
+
+import (
+	"context"
+	"errors"
+)
+
+var errNoNotification = errors.New("No notification found with given id")
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return Service{repo: repo}
+}
+
+// Notify sends a notification to each of the users. Users equal to the
+// payload's actor are skipped, nobody is notified about their own action.
+func (s *Service) Notify(ctx context.Context, typ string, payload Payload, userIDs ...int64) error {
+	for _, userID := range userIDs {
+		if payload.ActorID != nil && *payload.ActorID == userID {
+			continue
+		}
+
+		err := s.repo.create(ctx, Notification{UserID: userID, Type: typ, Payload: payload})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotifyOnce sends a notification unless the user already got one with the
+// same dedupe key.
+func (s *Service) NotifyOnce(ctx context.Context, userID int64, typ, dedupeKey string, payload Payload) error {
+	return s.repo.create(ctx, Notification{UserID: userID, Type: typ, Payload: payload, DedupeKey: &dedupeKey})
+}
+
+func (s *Service) list(ctx context.Context, q listQuery) ([]*Notification, *int64, error) {
+	limit := q.limit
+	q.limit++
+	result, err := s.repo.list(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *int64
+	if len(result) > limit {
+		result = result[:limit]
+		next = &result[limit-1].ID
+	}
+	return result, next, nil
+}
+
+func (s *Service) unreadCount(ctx context.Context, userID int64) (int64, error) {
+	return s.repo.unreadCount(ctx, userID)
+}
+
+func (s *Service) markRead(ctx context.Context, userID, id int64) error {
+	found, err := s.repo.markRead(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errNoNotification
+	}
+	return nil
+}
+
+func (s *Service) markAllRead(ctx context.Context, userID int64) (int64, error) {
+	return s.repo.markAllRead(ctx, userID)
+}
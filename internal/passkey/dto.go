@@ -0,0 +1,123 @@
+package passkey
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/NurulloMahmud/habits/internal/platform/webauthn"
+)
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          webauthn.Base64URL `json:"id"`
+	Name        string             `json:"name"`
+	DisplayName string             `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type       string             `json:"type"`
+	ID         webauthn.Base64URL `json:"id"`
+	Transports []string           `json:"transports,omitempty"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// creationOptions is passed as is to navigator.credentials.create.
+type creationOptions struct {
+	Challenge              webauthn.Base64URL     `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// requestOptions is passed as is to navigator.credentials.get.
+type requestOptions struct {
+	Challenge        webauthn.Base64URL     `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type loginBeginRequest struct {
+	Email *string `json:"email"`
+}
+
+type registrationResponse struct {
+	ClientDataJSON    webauthn.Base64URL `json:"clientDataJSON"`
+	AttestationObject webauthn.Base64URL `json:"attestationObject"`
+	Transports        []string           `json:"transports"`
+}
+
+type registrationRequest struct {
+	Name     string               `json:"name"`
+	ID       webauthn.Base64URL   `json:"rawId"`
+	Response registrationResponse `json:"response"`
+}
+
+func (r *registrationRequest) validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		r.Name = "Passkey"
+	}
+	if len(r.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	if len(r.Response.ClientDataJSON) == 0 || len(r.Response.AttestationObject) == 0 {
+		return errors.New("response.clientDataJSON and response.attestationObject are required")
+	}
+	return nil
+}
+
+type assertionResponse struct {
+	ClientDataJSON    webauthn.Base64URL `json:"clientDataJSON"`
+	AuthenticatorData webauthn.Base64URL `json:"authenticatorData"`
+	Signature         webauthn.Base64URL `json:"signature"`
+	UserHandle        webauthn.Base64URL `json:"userHandle"`
+}
+
+type assertionRequest struct {
+	ID       webauthn.Base64URL `json:"rawId"`
+	Response assertionResponse  `json:"response"`
+}
+
+func (r *assertionRequest) validate() error {
+	if len(r.ID) == 0 {
+		return errors.New("rawId is required")
+	}
+	if len(r.Response.ClientDataJSON) == 0 || len(r.Response.AuthenticatorData) == 0 || len(r.Response.Signature) == 0 {
+		return errors.New("response.clientDataJSON, response.authenticatorData and response.signature are required")
+	}
+	return nil
+}
+
+type renameRequest struct {
+	Name *string `json:"name"`
+}
+
+func (r *renameRequest) validate() error {
+	if r.Name == nil || strings.TrimSpace(*r.Name) == "" {
+		return errors.New("name is required")
+	}
+	*r.Name = strings.TrimSpace(*r.Name)
+	if len(*r.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package passkey
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleBeginRegistration(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	data, err := h.service.beginRegistration(r.Context(), *user)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"publicKey": data})
+}
+
+func (h *Handler) HandleFinishRegistration(w http.ResponseWriter, r *http.Request) {
+	var req registrationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.finishRegistration(r.Context(), *user, req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleBeginLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginBeginRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.BadRequest(w, r, err, h.logger)
+			return
+		}
+	}
+
+	data, err := h.service.beginLogin(r.Context(), req.Email)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"publicKey": data})
+}
+
+func (h *Handler) HandleFinishLogin(w http.ResponseWriter, r *http.Request) {
+	var req assertionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user, tokens, err := h.service.finishLogin(r.Context(), req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
+	})
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	data, err := h.service.list(r.Context(), *user)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleRename(w http.ResponseWriter, r *http.Request) {
+	passkeyID, err := utils.ReadInt64Param(r, "passkeyID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	var req renameRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.rename(r.Context(), *user, passkeyID, *req.Name)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	passkeyID, err := utils.ReadInt64Param(r, "passkeyID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	if err = h.service.delete(r.Context(), *user, passkeyID); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "passkey deleted"})
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errInvalidResponse),
+		errors.Is(err, errInvalidChallenge),
+		errors.Is(err, errNoPasskeyFound),
+		errors.Is(err, errTooManyPasskeys),
+		errors.Is(err, errPasskeyExists):
+		response.BadRequest(w, r, err, h.logger)
+	case errors.Is(err, errLoginFailed):
+		response.Unauthorized(w, r, err.Error())
+	default:
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
@@ -0,0 +1,35 @@
+package passkey
+
+import "time"
+
+const (
+	ceremonyRegister = "register"
+	ceremonyLogin    = "login"
+)
+
+// Passkey is a WebAuthn credential a user registered to log in without a
+// password.
+type Passkey struct {
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"-"`
+	CredentialID   []byte     `json:"-"`
+	PublicKey      []byte     `json:"-"`
+	Algorithm      int64      `json:"-"`
+	SignCount      uint32     `json:"-"`
+	AAGUID         []byte     `json:"-"`
+	BackupEligible bool       `json:"backup_eligible"`
+	Transports     []string   `json:"transports"`
+	Name           string     `json:"name"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Challenge is an open registration or login ceremony. Login challenges have
+// no user, the credential tells who is logging in.
+type Challenge struct {
+	ID        int64
+	UserID    *int64
+	Ceremony  string
+	Challenge []byte
+	ExpiresAt time.Time
+}
@@ -0,0 +1,216 @@
+package passkey
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Repository interface {
+	create(ctx context.Context, p Passkey) (*Passkey, error)
+	get(ctx context.Context, id int64) (*Passkey, error)
+	getByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error)
+	listByUser(ctx context.Context, userID int64) ([]*Passkey, error)
+	rename(ctx context.Context, id int64, name string) error
+	delete(ctx context.Context, id int64) error
+	markUsed(ctx context.Context, id int64, signCount uint32) error
+	createChallenge(ctx context.Context, c Challenge) error
+	takeChallenge(ctx context.Context, challenge []byte, ceremony string) (*Challenge, error)
+	getUserID(ctx context.Context, email string) (*int64, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const passkeyColumns = `
+	id,
+	user_id,
+	credential_id,
+	public_key,
+	algorithm,
+	sign_count,
+	aaguid,
+	backup_eligible,
+	transports,
+	name,
+	last_used_at,
+	created_at`
+
+func scanPasskey(row interface{ Scan(...any) error }, p *Passkey) error {
+	var transports string
+	var signCount int64
+	err := row.Scan(
+		&p.ID,
+		&p.UserID,
+		&p.CredentialID,
+		&p.PublicKey,
+		&p.Algorithm,
+		&signCount,
+		&p.AAGUID,
+		&p.BackupEligible,
+		&transports,
+		&p.Name,
+		&p.LastUsedAt,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	p.SignCount = uint32(signCount)
+	p.Transports = []string{}
+	if transports != "" {
+		p.Transports = strings.Split(transports, ",")
+	}
+	return nil
+}
+
+func (r *postgresRepository) create(ctx context.Context, p Passkey) (*Passkey, error) {
+	query := `
+	INSERT INTO passkeys (user_id, credential_id, public_key, algorithm, sign_count, aaguid, backup_eligible, transports, name)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(
+		ctx, query,
+		p.UserID,
+		p.CredentialID,
+		p.PublicKey,
+		p.Algorithm,
+		int64(p.SignCount),
+		p.AAGUID,
+		p.BackupEligible,
+		strings.Join(p.Transports, ","),
+		p.Name,
+	).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *postgresRepository) get(ctx context.Context, id int64) (*Passkey, error) {
+	var p Passkey
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE id = $1`
+
+	err := scanPasskey(r.db.QueryRowContext(ctx, query, id), &p)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *postgresRepository) getByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error) {
+	var p Passkey
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE credential_id = $1`
+
+	err := scanPasskey(r.db.QueryRowContext(ctx, query, credentialID), &p)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *postgresRepository) listByUser(ctx context.Context, userID int64) ([]*Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []*Passkey{}
+	for rows.Next() {
+		var p Passkey
+		if err = scanPasskey(rows, &p); err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, &p)
+	}
+
+	return passkeys, rows.Err()
+}
+
+func (r *postgresRepository) rename(ctx context.Context, id int64, name string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE passkeys SET name = $1 WHERE id = $2`, name, id)
+	return err
+}
+
+func (r *postgresRepository) delete(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM passkeys WHERE id = $1`, id)
+	return err
+}
+
+func (r *postgresRepository) markUsed(ctx context.Context, id int64, signCount uint32) error {
+	query := `UPDATE passkeys SET sign_count = $1, last_used_at = CURRENT_TIMESTAMP WHERE id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, int64(signCount), id)
+	return err
+}
+
+func (r *postgresRepository) createChallenge(ctx context.Context, c Challenge) error {
+	query := `
+	INSERT INTO webauthn_challenges (user_id, ceremony, challenge, expires_at)
+	VALUES ($1, $2, $3, $4)`
+
+	_, err := r.db.ExecContext(ctx, query, c.UserID, c.Ceremony, c.Challenge, c.ExpiresAt)
+	return err
+}
+
+// takeChallenge marks an open challenge as used and returns it, so the same
+// challenge can never finish two ceremonies.
+func (r *postgresRepository) takeChallenge(ctx context.Context, challenge []byte, ceremony string) (*Challenge, error) {
+	var c Challenge
+	query := `
+	UPDATE webauthn_challenges
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE challenge = $1 AND ceremony = $2 AND used_at IS NULL AND expires_at > $3
+	RETURNING id, user_id, ceremony, challenge, expires_at`
+
+	err := r.db.QueryRowContext(ctx, query, challenge, ceremony, time.Now().UTC()).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.Ceremony,
+		&c.Challenge,
+		&c.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (r *postgresRepository) getUserID(ctx context.Context, email string) (*int64, error) {
+	var id int64
+	query := `SELECT id FROM users WHERE email = $1 AND is_active`
+
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
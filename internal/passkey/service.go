@@ -0,0 +1,302 @@
+package passkey
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/platform/webauthn"
+	"github.com/NurulloMahmud/habits/internal/user"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+const (
+	challengeTTL = 5 * time.Minute
+	maxPasskeys  = 20
+)
+
+var (
+	errNoPasskeyFound   = errors.New("No passkey found with given id")
+	errTooManyPasskeys  = errors.New("You can register at most 20 passkeys")
+	errPasskeyExists    = errors.New("This passkey is already registered")
+	errInvalidChallenge = errors.New("Passkey challenge is invalid or expired")
+	errInvalidResponse  = errors.New("Passkey response could not be verified")
+	errLoginFailed      = errors.New("Passkey login failed")
+)
+
+// Users is what logging in with a passkey needs from the user service.
+type Users interface {
+	PasswordlessLogin(ctx context.Context, userID int64) (*user.User, *user.TokenPair, error)
+}
+
+type Service struct {
+	repo  Repository
+	users Users
+	rp    webauthn.RelyingParty
+}
+
+func NewService(repo Repository, users Users, cfg config.Config) Service {
+	return Service{
+		repo:  repo,
+		users: users,
+		rp: webauthn.RelyingParty{
+			ID:      cfg.WebAuthn.RPID,
+			Name:    cfg.WebAuthn.RPName,
+			Origins: cfg.WebAuthn.Origins,
+		},
+	}
+}
+
+// userHandle is the opaque id authenticators store for the user. It is the
+// user id, so it never exposes the email.
+func userHandle(userID int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(userID))
+	return b
+}
+
+func descriptors(passkeys []*Passkey) []credentialDescriptor {
+	list := make([]credentialDescriptor, 0, len(passkeys))
+	for _, p := range passkeys {
+		list = append(list, credentialDescriptor{
+			Type:       "public-key",
+			ID:         p.CredentialID,
+			Transports: p.Transports,
+		})
+	}
+	return list
+}
+
+func (s *Service) newChallenge(ctx context.Context, userID *int64, ceremony string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.createChallenge(ctx, Challenge{
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Challenge: challenge,
+		ExpiresAt: time.Now().UTC().Add(challengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// takeChallenge finds the open ceremony the client answered to.
+func (s *Service) takeChallenge(ctx context.Context, clientDataJSON []byte, ceremony string) (*Challenge, error) {
+	challenge, err := webauthn.ClientChallenge(clientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidResponse, err)
+	}
+
+	c, err := s.repo.takeChallenge(ctx, challenge, ceremony)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, errInvalidChallenge
+	}
+	return c, nil
+}
+
+func (s *Service) beginRegistration(ctx context.Context, u cx.User) (*creationOptions, error) {
+	passkeys, err := s.repo.listByUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) >= maxPasskeys {
+		return nil, errTooManyPasskeys
+	}
+
+	challenge, err := s.newChallenge(ctx, &u.ID, ceremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]credentialParameter, 0, len(webauthn.SupportedAlgorithms))
+	for _, alg := range webauthn.SupportedAlgorithms {
+		params = append(params, credentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return &creationOptions{
+		Challenge: challenge,
+		RP:        rpEntity{ID: s.rp.ID, Name: s.rp.Name},
+		User: userEntity{
+			ID:          userHandle(u.ID),
+			Name:        u.Email,
+			DisplayName: u.Email,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            challengeTTL.Milliseconds(),
+		ExcludeCredentials: descriptors(passkeys),
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+func (s *Service) finishRegistration(ctx context.Context, u cx.User, req registrationRequest) (*Passkey, error) {
+	c, err := s.takeChallenge(ctx, req.Response.ClientDataJSON, ceremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserID == nil || *c.UserID != u.ID {
+		return nil, errInvalidChallenge
+	}
+
+	cred, err := s.rp.VerifyRegistration(c.Challenge, req.Response.ClientDataJSON, req.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidResponse, err)
+	}
+
+	existing, err := s.repo.getByCredentialID(ctx, cred.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errPasskeyExists
+	}
+
+	passkeys, err := s.repo.listByUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) >= maxPasskeys {
+		return nil, errTooManyPasskeys
+	}
+
+	transports := req.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	return s.repo.create(ctx, Passkey{
+		UserID:         u.ID,
+		CredentialID:   cred.ID,
+		PublicKey:      cred.PublicKey,
+		Algorithm:      cred.Algorithm,
+		SignCount:      cred.SignCount,
+		AAGUID:         cred.AAGUID,
+		BackupEligible: cred.BackupEligible,
+		Transports:     transports,
+		Name:           req.Name,
+	})
+}
+
+// beginLogin starts a login ceremony. With an email the options list that
+// user's passkeys, without one the authenticator offers its discoverable
+// credentials. Unknown emails get an empty list so they can't be probed.
+func (s *Service) beginLogin(ctx context.Context, email *string) (*requestOptions, error) {
+	allowed := []credentialDescriptor{}
+	if email != nil && *email != "" {
+		userID, err := s.repo.getUserID(ctx, *email)
+		if err != nil {
+			return nil, err
+		}
+		if userID != nil {
+			passkeys, err := s.repo.listByUser(ctx, *userID)
+			if err != nil {
+				return nil, err
+			}
+			allowed = descriptors(passkeys)
+		}
+	}
+
+	challenge, err := s.newChallenge(ctx, nil, ceremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &requestOptions{
+		Challenge:        challenge,
+		RPID:             s.rp.ID,
+		Timeout:          challengeTTL.Milliseconds(),
+		AllowCredentials: allowed,
+		UserVerification: "required",
+	}, nil
+}
+
+// finishLogin verifies the assertion and logs the owner of the passkey in.
+// VerifyAssertion insists on user verification, which makes the passkey count
+// as both factors, see PasswordlessLogin.
+func (s *Service) finishLogin(ctx context.Context, req assertionRequest) (*user.User, *user.TokenPair, error) {
+	c, err := s.takeChallenge(ctx, req.Response.ClientDataJSON, ceremonyLogin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := s.repo.getByCredentialID(ctx, req.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p == nil {
+		return nil, nil, errLoginFailed
+	}
+	if len(req.Response.UserHandle) > 0 && string(req.Response.UserHandle) != string(userHandle(p.UserID)) {
+		return nil, nil, errLoginFailed
+	}
+
+	cred := webauthn.Credential{
+		ID:        p.CredentialID,
+		PublicKey: p.PublicKey,
+		Algorithm: p.Algorithm,
+		SignCount: p.SignCount,
+	}
+	signCount, err := s.rp.VerifyAssertion(cred, c.Challenge, req.Response.ClientDataJSON, req.Response.AuthenticatorData, req.Response.Signature)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidResponse, err)
+	}
+
+	if err = s.repo.markUsed(ctx, p.ID, signCount); err != nil {
+		return nil, nil, err
+	}
+
+	u, tokens, err := s.users.PasswordlessLogin(ctx, p.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u == nil {
+		return nil, nil, errLoginFailed
+	}
+	return u, tokens, nil
+}
+
+func (s *Service) list(ctx context.Context, u cx.User) ([]*Passkey, error) {
+	return s.repo.listByUser(ctx, u.ID)
+}
+
+func (s *Service) ownPasskey(ctx context.Context, u cx.User, id int64) (*Passkey, error) {
+	p, err := s.repo.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || p.UserID != u.ID {
+		return nil, errNoPasskeyFound
+	}
+	return p, nil
+}
+
+func (s *Service) rename(ctx context.Context, u cx.User, id int64, name string) (*Passkey, error) {
+	p, err := s.ownPasskey(ctx, u, id)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Name = name
+	return p, s.repo.rename(ctx, id, name)
+}
+
+func (s *Service) delete(ctx context.Context, u cx.User, id int64) error {
+	if _, err := s.ownPasskey(ctx, u, id); err != nil {
+		return err
+	}
+	return s.repo.delete(ctx, id)
+}
@@ -0,0 +1,275 @@
+package passkey
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/platform/webauthn"
+	"github.com/NurulloMahmud/habits/internal/platform/webauthn/webauthntest"
+	"github.com/NurulloMahmud/habits/internal/user"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+const (
+	rpID   = "habits.example.com"
+	origin = "https://habits.example.com"
+)
+
+// memoryRepository keeps passkeys and open challenges in memory. Methods the
+// tests do not reach panic through the nil embedded interface.
+type memoryRepository struct {
+	Repository
+	passkeys   []*Passkey
+	challenges []Challenge
+	emails     map[string]int64
+}
+
+func (r *memoryRepository) find(match func(p *Passkey) bool) *Passkey {
+	if i := slices.IndexFunc(r.passkeys, match); i >= 0 {
+		copied := *r.passkeys[i]
+		return &copied
+	}
+	return nil
+}
+
+func (r *memoryRepository) create(ctx context.Context, p Passkey) (*Passkey, error) {
+	p.ID = int64(len(r.passkeys) + 1)
+	r.passkeys = append(r.passkeys, &p)
+	return r.find(func(s *Passkey) bool { return s.ID == p.ID }), nil
+}
+
+func (r *memoryRepository) get(ctx context.Context, id int64) (*Passkey, error) {
+	return r.find(func(p *Passkey) bool { return p.ID == id }), nil
+}
+
+func (r *memoryRepository) getByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error) {
+	return r.find(func(p *Passkey) bool { return string(p.CredentialID) == string(credentialID) }), nil
+}
+
+func (r *memoryRepository) listByUser(ctx context.Context, userID int64) ([]*Passkey, error) {
+	list := []*Passkey{}
+	for _, p := range r.passkeys {
+		if p.UserID == userID {
+			list = append(list, p)
+		}
+	}
+	return list, nil
+}
+
+func (r *memoryRepository) rename(ctx context.Context, id int64, name string) error {
+	return nil
+}
+
+func (r *memoryRepository) delete(ctx context.Context, id int64) error {
+	r.passkeys = slices.DeleteFunc(r.passkeys, func(p *Passkey) bool { return p.ID == id })
+	return nil
+}
+
+func (r *memoryRepository) markUsed(ctx context.Context, id int64, signCount uint32) error {
+	for _, p := range r.passkeys {
+		if p.ID == id {
+			p.SignCount = signCount
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) createChallenge(ctx context.Context, c Challenge) error {
+	r.challenges = append(r.challenges, c)
+	return nil
+}
+
+func (r *memoryRepository) takeChallenge(ctx context.Context, challenge []byte, ceremony string) (*Challenge, error) {
+	i := slices.IndexFunc(r.challenges, func(c Challenge) bool {
+		return string(c.Challenge) == string(challenge) && c.Ceremony == ceremony
+	})
+	if i < 0 {
+		return nil, nil
+	}
+	c := r.challenges[i]
+	r.challenges = slices.Delete(r.challenges, i, i+1)
+	return &c, nil
+}
+
+func (r *memoryRepository) getUserID(ctx context.Context, email string) (*int64, error) {
+	if id, ok := r.emails[email]; ok {
+		return &id, nil
+	}
+	return nil, nil
+}
+
+// fakeUsers logs anyone in and records who.
+type fakeUsers struct {
+	loggedIn []int64
+}
+
+func (f *fakeUsers) PasswordlessLogin(ctx context.Context, userID int64) (*user.User, *user.TokenPair, error) {
+	f.loggedIn = append(f.loggedIn, userID)
+	return &user.User{ID: userID}, &user.TokenPair{AccessToken: "access"}, nil
+}
+
+func newTestService() (*Service, *memoryRepository, *fakeUsers) {
+	repo := &memoryRepository{emails: map[string]int64{}}
+	users := &fakeUsers{}
+	cfg := config.Config{WebAuthn: config.WebAuthn{RPID: rpID, RPName: "Habits", Origins: []string{origin}}}
+
+	s := NewService(repo, users, cfg)
+	return &s, repo, users
+}
+
+// register runs a registration ceremony for u with a new authenticator.
+func register(t *testing.T, s *Service, u cx.User) (*webauthntest.Authenticator, *Passkey) {
+	t.Helper()
+
+	a := webauthntest.New(t, rpID, origin, webauthn.AlgES256)
+	p, err := s.finishRegistration(context.Background(), u, registration(t, s, u, a))
+	if err != nil {
+		t.Fatalf("finishRegistration: %v", err)
+	}
+	return a, p
+}
+
+func registration(t *testing.T, s *Service, u cx.User, a *webauthntest.Authenticator) registrationRequest {
+	t.Helper()
+
+	opts, err := s.beginRegistration(context.Background(), u)
+	if err != nil {
+		t.Fatalf("beginRegistration: %v", err)
+	}
+	req := registrationRequest{Name: "Laptop", ID: a.ID}
+	req.Response.ClientDataJSON, req.Response.AttestationObject = a.Create(opts.Challenge)
+	return req
+}
+
+func assertion(t *testing.T, s *Service, a *webauthntest.Authenticator, userID int64) assertionRequest {
+	t.Helper()
+
+	opts, err := s.beginLogin(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("beginLogin: %v", err)
+	}
+	req := assertionRequest{ID: a.ID}
+	req.Response.ClientDataJSON, req.Response.AuthenticatorData, req.Response.Signature = a.Get(t, opts.Challenge)
+	req.Response.UserHandle = userHandle(userID)
+	return req
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s, repo, _ := newTestService()
+	ada := cx.User{ID: 7}
+	a, p := register(t, s, ada)
+
+	if p.UserID != ada.ID || p.Name != "Laptop" || string(p.CredentialID) != string(a.ID) {
+		t.Fatalf("unexpected passkey %+v", p)
+	}
+
+	u, tokens, err := s.finishLogin(context.Background(), assertion(t, s, a, ada.ID))
+	if err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+	if u.ID != ada.ID || tokens == nil {
+		t.Fatalf("logged in %d with tokens %v", u.ID, tokens)
+	}
+	if repo.passkeys[0].SignCount != a.SignCount {
+		t.Fatalf("sign count %d after login, want %d", repo.passkeys[0].SignCount, a.SignCount)
+	}
+}
+
+func TestLoginChallengeIsSingleUse(t *testing.T) {
+	s, _, _ := newTestService()
+	a, _ := register(t, s, cx.User{ID: 7})
+
+	req := assertion(t, s, a, 7)
+	if _, _, err := s.finishLogin(context.Background(), req); err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+	if _, _, err := s.finishLogin(context.Background(), req); !errors.Is(err, errInvalidChallenge) {
+		t.Fatalf("replayed assertion: err = %v, want %v", err, errInvalidChallenge)
+	}
+}
+
+func TestLoginRejectsSignCountRegression(t *testing.T) {
+	s, _, users := newTestService()
+	a, _ := register(t, s, cx.User{ID: 7})
+
+	a.SignCount = 10
+	if _, _, err := s.finishLogin(context.Background(), assertion(t, s, a, 7)); err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+
+	// a cloned authenticator is behind the original
+	a.SignCount = 3
+	if _, _, err := s.finishLogin(context.Background(), assertion(t, s, a, 7)); !errors.Is(err, errInvalidResponse) {
+		t.Fatalf("err = %v, want %v", err, errInvalidResponse)
+	}
+	if len(users.loggedIn) != 1 {
+		t.Fatalf("cloned authenticator logged in: %v", users.loggedIn)
+	}
+}
+
+func TestLoginRejectsOtherUserHandle(t *testing.T) {
+	s, _, _ := newTestService()
+	a, _ := register(t, s, cx.User{ID: 7})
+
+	if _, _, err := s.finishLogin(context.Background(), assertion(t, s, a, 8)); !errors.Is(err, errLoginFailed) {
+		t.Fatalf("err = %v, want %v", err, errLoginFailed)
+	}
+}
+
+func TestRegistrationChallengeOfAnotherUser(t *testing.T) {
+	s, _, _ := newTestService()
+	a := webauthntest.New(t, rpID, origin, webauthn.AlgES256)
+
+	req := registration(t, s, cx.User{ID: 7}, a)
+	if _, err := s.finishRegistration(context.Background(), cx.User{ID: 8}, req); !errors.Is(err, errInvalidChallenge) {
+		t.Fatalf("err = %v, want %v", err, errInvalidChallenge)
+	}
+}
+
+func TestRegistrationRejectsKnownCredential(t *testing.T) {
+	s, _, _ := newTestService()
+	ada := cx.User{ID: 7}
+	a, _ := register(t, s, ada)
+
+	if _, err := s.finishRegistration(context.Background(), ada, registration(t, s, ada, a)); !errors.Is(err, errPasskeyExists) {
+		t.Fatalf("err = %v, want %v", err, errPasskeyExists)
+	}
+}
+
+func TestBeginLoginAllowedCredentials(t *testing.T) {
+	s, repo, _ := newTestService()
+	repo.emails["ada@example.com"] = 7
+	a, _ := register(t, s, cx.User{ID: 7})
+
+	for email, want := range map[string]int{"ada@example.com": 1, "nobody@example.com": 0} {
+		opts, err := s.beginLogin(context.Background(), &email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(opts.AllowCredentials) != want || (want == 1 && string(opts.AllowCredentials[0].ID) != string(a.ID)) {
+			t.Fatalf("%s: allowed credentials = %+v", email, opts.AllowCredentials)
+		}
+	}
+}
+
+func TestManageOnlyOwnPasskeys(t *testing.T) {
+	s, _, _ := newTestService()
+	ada, bob := cx.User{ID: 7}, cx.User{ID: 8}
+	_, p := register(t, s, ada)
+
+	if _, err := s.rename(context.Background(), bob, p.ID, "Stolen"); !errors.Is(err, errNoPasskeyFound) {
+		t.Fatalf("rename by other user: err = %v, want %v", err, errNoPasskeyFound)
+	}
+	if err := s.delete(context.Background(), bob, p.ID); !errors.Is(err, errNoPasskeyFound) {
+		t.Fatalf("delete by other user: err = %v, want %v", err, errNoPasskeyFound)
+	}
+	if err := s.delete(context.Background(), ada, p.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if list, _ := s.list(context.Background(), ada); len(list) != 0 {
+		t.Fatalf("passkey still listed after delete: %v", list)
+	}
+}
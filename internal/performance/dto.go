@@ -0,0 +1,55 @@
+package performance
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+var (
+	errCheckinTypeConflict = errors.New("Check-in must be either quantity based or duration based. You cannot provide both quantity and duration fields")
+	errCheckinTypeEmpty    = errors.New("Please provide either quantity or duration")
+	errInvalidQuantity     = errors.New("quantity must be greater than or equal to 1")
+	errInvalidDuration     = errors.New("duration minutes must be greater than or equal to 1")
+	errInvalidDate         = errors.New("date must be a calendar day in YYYY-MM-DD format")
+)
+
+// createCheckinRequest takes the date as a calendar day, it is the member's
+// own day whatever their time zone. date holds it once validated.
+type createCheckinRequest struct {
+	Quantity *int64  `json:"quantity"`
+	Duration *int64  `json:"duration"`
+	Date     *string `json:"date"`
+
+	date *time.Time
+}
+
+func (r *createCheckinRequest) validateCreateRequest() error {
+	if r.Quantity != nil && r.Duration != nil {
+		return errCheckinTypeConflict
+	}
+	if r.Quantity == nil && r.Duration == nil {
+		return errCheckinTypeEmpty
+	}
+	if r.Quantity != nil && *r.Quantity < 1 {
+		return errInvalidQuantity
+	}
+	if r.Duration != nil && *r.Duration < 1 {
+		return errInvalidDuration
+	}
+	if r.Date != nil {
+		date, err := utils.ConvertStrToDate(*r.Date)
+		if err != nil || date == nil {
+			return errInvalidDate
+		}
+		r.date = date
+	}
+	return nil
+}
+
+type listCheckinsQuery struct {
+	habitID int64
+	from    *time.Time
+	to      *time.Time
+}
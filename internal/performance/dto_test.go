@@ -0,0 +1,31 @@
+package performance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckinDateIsACalendarDay(t *testing.T) {
+	quantity := int64(1)
+	tests := []struct {
+		date string
+		want time.Time
+		err  error
+	}{
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), nil},
+		{"2024-05-01T00:00:00Z", time.Time{}, errInvalidDate},
+		{"01.05.2024", time.Time{}, errInvalidDate},
+		{"", time.Time{}, errInvalidDate},
+	}
+	for _, tt := range tests {
+		req := createCheckinRequest{Quantity: &quantity, Date: &tt.date}
+		err := req.validateCreateRequest()
+		if err != tt.err {
+			t.Errorf("date %q: err = %v, want %v", tt.date, err, tt.err)
+			continue
+		}
+		if err == nil && !req.date.Equal(tt.want) {
+			t.Errorf("date %q = %v, want %v", tt.date, req.date, tt.want)
+		}
+	}
+}
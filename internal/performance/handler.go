@@ -0,0 +1,105 @@
+package performance
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleCreateCheckin(w http.ResponseWriter, r *http.Request) {
+	var req createCheckinRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = req.validateCreateRequest()
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.checkin(r.Context(), *user, habitID, req, h.logger)
+	if err != nil {
+		switch err {
+		case errNoHabitFound, access.ErrNoHabit, errOutsideHabitDates, errFutureDate, errQuantityRequired, errDurationRequired:
+			response.BadRequest(w, r, err, h.logger)
+			return
+		default:
+			if access.IsForbidden(err) {
+				response.Forbidden(w, r, err.Error())
+				return
+			}
+			response.InternalServerError(w, r, err, h.logger)
+			return
+		}
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleListCheckins(w http.ResponseWriter, r *http.Request) {
+	var q listCheckinsQuery
+
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.habitID = habitID
+
+	q.from, err = utils.ConvertStrToDate(utils.ReadString(r, "from", ""))
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.to, err = utils.ConvertStrToDate(utils.ReadString(r, "to", ""))
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.list(r.Context(), *user, q)
+	if err != nil {
+		switch err {
+		case errNoHabitFound, access.ErrNoHabit, errDateRange:
+			response.BadRequest(w, r, err, h.logger)
+			return
+		default:
+			if access.IsForbidden(err) {
+				response.Forbidden(w, r, err.Error())
+				return
+			}
+			response.InternalServerError(w, r, err, h.logger)
+			return
+		}
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
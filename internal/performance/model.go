@@ -0,0 +1,22 @@
+package performance
+
+import "time"
+
+type Checkin struct {
+	ID        int64     `json:"id"`
+	HabitID   int64     `json:"habit_id"`
+	UserID    int64     `json:"user_id"`
+	Quantity  *int64    `json:"quantity,omitempty"`
+	Duration  *int64    `json:"duration,omitempty"`
+	Date      time.Time `json:"date"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type habitTarget struct {
+	ID            int64
+	StartDate     time.Time
+	EndDate       time.Time
+	DailyCount    *int64
+	DailyDuration *int64
+	PrivacyStatus string
+}
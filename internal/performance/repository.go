@@ -0,0 +1,112 @@
+package performance
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Repository interface {
+	create(ctx context.Context, c Checkin) (*Checkin, error)
+	list(ctx context.Context, q listCheckinsQuery) ([]*Checkin, error)
+	getHabit(ctx context.Context, habitID int64) (*habitTarget, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) create(ctx context.Context, c Checkin) (*Checkin, error) {
+	query := `
+	INSERT INTO habit_performance (habit_id, user_id, quantity, duration, date)
+	VALUES ($1, $2, $3, $4::DOUBLE PRECISION * INTERVAL '1 minute', $5)
+	RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(
+		ctx, query,
+		c.HabitID,
+		c.UserID,
+		c.Quantity,
+		c.Duration,
+		c.Date,
+	).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (r *postgresRepository) list(ctx context.Context, q listCheckinsQuery) ([]*Checkin, error) {
+	result := []*Checkin{}
+
+	query := `
+	SELECT
+		id,
+		habit_id,
+		user_id,
+		quantity,
+		(EXTRACT(EPOCH FROM duration) / 60)::BIGINT duration,
+		date,
+		created_at
+	FROM habit_performance
+	WHERE
+		habit_id = $1 AND
+		(date >= $2 OR $2 IS NULL) AND
+		(date <= $3 OR $3 IS NULL)
+	ORDER BY date DESC, id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, q.habitID, q.from, q.to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Checkin
+		err = rows.Scan(
+			&c.ID,
+			&c.HabitID,
+			&c.UserID,
+			&c.Quantity,
+			&c.Duration,
+			&c.Date,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &c)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *postgresRepository) getHabit(ctx context.Context, habitID int64) (*habitTarget, error) {
+	var h habitTarget
+
+	query := `
+	SELECT id, start_date, end_date, daily_count, daily_duration, privacy_status
+	FROM habits
+	WHERE id = $1 AND archived_at IS NULL AND deleted_at IS NULL`
+
+	err := r.db.QueryRowContext(ctx, query, habitID).Scan(
+		&h.ID,
+		&h.StartDate,
+		&h.EndDate,
+		&h.DailyCount,
+		&h.DailyDuration,
+		&h.PrivacyStatus,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
@@ -0,0 +1,150 @@
+package performance
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/realtime"
+	"github.com/NurulloMahmud/habits/internal/streak"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+var (
+	errNoHabitFound      = errors.New("No habit data found with given id")
+	errOutsideHabitDates = errors.New("Check-in date must be between habit's start_date and end_date")
+	errFutureDate        = errors.New("Check-in date must not be in the future")
+	errQuantityRequired  = errors.New("This habit is quantity based. Please provide quantity instead of duration")
+	errDurationRequired  = errors.New("This habit is duration based. Please provide duration instead of quantity")
+	errDateRange         = errors.New("from date must not be after to date")
+)
+
+// streakRebuildTimeout bounds the background rebuild of a streak that could
+// not be updated along with its check-in.
+const streakRebuildTimeout = time.Minute
+
+type Service struct {
+	repo    Repository
+	streaks streak.Service
+	access  access.Service
+	events  *realtime.Hub
+}
+
+func NewService(repo Repository, streaks streak.Service, access access.Service, events *realtime.Hub) Service {
+	return Service{
+		repo:    repo,
+		streaks: streaks,
+		access:  access,
+		events:  events,
+	}
+}
+
+// checkin stores a check-in and then updates the member's streak. The check-in
+// is kept when the streak update fails, the failure is logged and the streak
+// is rebuilt from history in the background.
+func (s *Service) checkin(ctx context.Context, user cx.User, habitID int64, req createCheckinRequest, logger *log.Logger) (*Checkin, error) {
+	habit, err := s.repo.getHabit(ctx, habitID)
+	if err != nil {
+		return nil, err
+	}
+	if habit == nil {
+		return nil, errNoHabitFound
+	}
+
+	_, err = s.access.Require(ctx, user, habitID, access.CheckIn)
+	if err != nil {
+		return nil, err
+	}
+
+	// quantity goes to daily_count habits, duration to daily_duration habits
+	if habit.DailyCount != nil && req.Quantity == nil {
+		return nil, errQuantityRequired
+	}
+	if habit.DailyDuration != nil && req.Duration == nil {
+		return nil, errDurationRequired
+	}
+
+	// check-ins are dated by the calendar day in the member's time zone
+	today := utils.Today(user.Location())
+	date := today
+	if req.date != nil {
+		date = *req.date
+	}
+	if date.After(today) {
+		return nil, errFutureDate
+	}
+
+	if date.Before(habit.StartDate) || date.After(habit.EndDate) {
+		return nil, errOutsideHabitDates
+	}
+
+	checkin, err := s.repo.create(ctx, Checkin{
+		HabitID:  habitID,
+		UserID:   user.ID,
+		Quantity: req.Quantity,
+		Duration: req.Duration,
+		Date:     date,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.streaks.Record(ctx, habitID, user.ID, date); err != nil {
+		logger.Printf("[ERROR] streak of user %d in habit %d: %v\n", user.ID, habitID, err)
+		go s.rebuildStreak(context.WithoutCancel(ctx), habitID, user.ID, logger)
+	}
+
+	s.events.Publish(ctx, habitID, realtime.TypeCheckin, checkin)
+	return checkin, nil
+}
+
+func (s *Service) rebuildStreak(ctx context.Context, habitID, userID int64, logger *log.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, streakRebuildTimeout)
+	defer cancel()
+
+	if err := s.streaks.Rebuild(ctx, habitID, userID); err != nil {
+		logger.Printf("[ERROR] streak rebuild of user %d in habit %d: %v\n", userID, habitID, err)
+	}
+}
+
+// RecordDuration stores a duration check-in on behalf of another feature,
+// such as a stopped timer session. It is dated by the member's calendar day
+// at the given instant.
+func (s *Service) RecordDuration(ctx context.Context, user cx.User, habitID, minutes int64, at time.Time, logger *log.Logger) (*Checkin, error) {
+	date := utils.DateIn(at, user.Location())
+	return s.checkin(ctx, user, habitID, createCheckinRequest{Duration: &minutes, date: &date}, logger)
+}
+
+// IsClientError reports whether err was caused by the check-in itself rather
+// than by the server.
+func IsClientError(err error) bool {
+	switch err {
+	case errNoHabitFound, access.ErrNoHabit, errOutsideHabitDates, errFutureDate, errQuantityRequired, errDurationRequired:
+		return true
+	}
+	return access.IsForbidden(err)
+}
+
+func (s *Service) list(ctx context.Context, user cx.User, q listCheckinsQuery) ([]*Checkin, error) {
+	if q.from != nil && q.to != nil && q.to.Before(*q.from) {
+		return nil, errDateRange
+	}
+
+	habit, err := s.repo.getHabit(ctx, q.habitID)
+	if err != nil {
+		return nil, err
+	}
+	if habit == nil {
+		return nil, errNoHabitFound
+	}
+
+	_, err = s.access.Require(ctx, user, q.habitID, access.ViewHabit)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.list(ctx, q)
+}
@@ -0,0 +1,10 @@
+package webauthn
+
+var (
+	ErrCeremonyType = errCeremonyType
+	ErrOrigin       = errOrigin
+	ErrRPID         = errRPID
+	ErrUserPresence = errUserPresence
+	ErrUserVerify   = errUserVerify
+	ErrBadSignature = errBadSignature
+)
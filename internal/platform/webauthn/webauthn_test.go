@@ -0,0 +1,243 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NurulloMahmud/habits/internal/platform/webauthn"
+	"github.com/NurulloMahmud/habits/internal/platform/webauthn/webauthntest"
+)
+
+const (
+	rpID   = "habits.example.com"
+	origin = "https://habits.example.com"
+)
+
+var rp = webauthn.RelyingParty{ID: rpID, Name: "Habits", Origins: []string{origin}}
+
+func newAuthenticator(t *testing.T, alg int64) *webauthntest.Authenticator {
+	return webauthntest.New(t, rpID, origin, alg)
+}
+
+func challenge(t *testing.T) []byte {
+	t.Helper()
+	c, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func register(t *testing.T, a *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+
+	c := challenge(t)
+	clientDataJSON, attestationObject := a.Create(c)
+	cred, err := rp.VerifyRegistration(c, clientDataJSON, attestationObject)
+	if err != nil {
+		t.Fatalf("registration: %v", err)
+	}
+	return cred
+}
+
+// login runs an assertion and stores the new counter like the passkey
+// service does.
+func login(t *testing.T, a *webauthntest.Authenticator, cred *webauthn.Credential) error {
+	t.Helper()
+
+	c := challenge(t)
+	clientDataJSON, authData, sig := a.Get(t, c)
+	count, err := rp.VerifyAssertion(*cred, c, clientDataJSON, authData, sig)
+	if err != nil {
+		return err
+	}
+	cred.SignCount = count
+	return nil
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	for name, alg := range map[string]int64{"ES256": webauthn.AlgES256, "EdDSA": webauthn.AlgEdDSA} {
+		t.Run(name, func(t *testing.T) {
+			a := newAuthenticator(t, alg)
+			cred := register(t, a)
+
+			if string(cred.ID) != string(a.ID) {
+				t.Errorf("credential id = %x, want %x", cred.ID, a.ID)
+			}
+			if cred.Algorithm != alg {
+				t.Errorf("algorithm = %d, want %d", cred.Algorithm, alg)
+			}
+
+			for range 2 {
+				if err := login(t, a, cred); err != nil {
+					t.Fatalf("assertion: %v", err)
+				}
+				if cred.SignCount != a.SignCount {
+					t.Errorf("sign count = %d, want %d", cred.SignCount, a.SignCount)
+				}
+			}
+		})
+	}
+}
+
+func TestClientChallenge(t *testing.T) {
+	a := newAuthenticator(t, webauthn.AlgEdDSA)
+	c := challenge(t)
+	clientDataJSON, _ := a.Create(c)
+
+	got, err := webauthn.ClientChallenge(clientDataJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(c) {
+		t.Errorf("challenge = %x, want %x", got, c)
+	}
+}
+
+func TestSignCountRegression(t *testing.T) {
+	a := newAuthenticator(t, webauthn.AlgES256)
+	cred := register(t, a)
+
+	a.SignCount = 10
+	if err := login(t, a, cred); err != nil {
+		t.Fatal(err)
+	}
+
+	// a clone of the authenticator reports an older counter
+	a.SignCount = 4
+	if err := login(t, a, cred); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("older counter: err = %v, want %v", err, webauthn.ErrSignCount)
+	}
+
+	// the same counter again is just as suspicious
+	a.SignCount = cred.SignCount - 1
+	if err := login(t, a, cred); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("equal counter: err = %v, want %v", err, webauthn.ErrSignCount)
+	}
+
+	// a counter dropping to zero is a regression too
+	a.SignCount, a.NoCounter = 0, true
+	if err := login(t, a, cred); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("zero counter: err = %v, want %v", err, webauthn.ErrSignCount)
+	}
+}
+
+func TestZeroSignCount(t *testing.T) {
+	a := newAuthenticator(t, webauthn.AlgEdDSA)
+	a.NoCounter = true
+	cred := register(t, a)
+
+	// authenticators without a counter always report zero
+	for range 2 {
+		if err := login(t, a, cred); err != nil {
+			t.Fatal(err)
+		}
+		if cred.SignCount != 0 {
+			t.Errorf("sign count = %d, want 0", cred.SignCount)
+		}
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *webauthntest.Authenticator)
+		want   error
+	}{
+		{"wrong origin", func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example.com" }, webauthn.ErrOrigin},
+		{"wrong rp id", func(a *webauthntest.Authenticator) { a.RPID = "evil.example.com" }, webauthn.ErrRPID},
+		{"no user presence", func(a *webauthntest.Authenticator) { a.Flags = 0 }, webauthn.ErrUserPresence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t, webauthn.AlgES256)
+			tt.modify(a)
+
+			c := challenge(t)
+			clientDataJSON, attestationObject := a.Create(c)
+			if _, err := rp.VerifyRegistration(c, clientDataJSON, attestationObject); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("wrong challenge", func(t *testing.T) {
+		a := newAuthenticator(t, webauthn.AlgES256)
+		clientDataJSON, attestationObject := a.Create(challenge(t))
+		if _, err := rp.VerifyRegistration(challenge(t), clientDataJSON, attestationObject); !errors.Is(err, webauthn.ErrChallenge) {
+			t.Errorf("err = %v, want %v", err, webauthn.ErrChallenge)
+		}
+	})
+
+	t.Run("assertion client data", func(t *testing.T) {
+		a := newAuthenticator(t, webauthn.AlgES256)
+		c := challenge(t)
+		_, attestationObject := a.Create(c)
+		if _, err := rp.VerifyRegistration(c, a.ClientData("webauthn.get", c), attestationObject); !errors.Is(err, webauthn.ErrCeremonyType) {
+			t.Errorf("err = %v, want %v", err, webauthn.ErrCeremonyType)
+		}
+	})
+}
+
+func TestAssertionRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *webauthntest.Authenticator)
+		want   error
+	}{
+		{"wrong origin", func(a *webauthntest.Authenticator) { a.Origin = "https://habits.example.com.evil.net" }, webauthn.ErrOrigin},
+		{"wrong rp id", func(a *webauthntest.Authenticator) { a.RPID = "example.com" }, webauthn.ErrRPID},
+		{"no user verification", func(a *webauthntest.Authenticator) { a.Flags = webauthntest.FlagUserPresent }, webauthn.ErrUserVerify},
+		{"no user presence", func(a *webauthntest.Authenticator) { a.Flags = webauthntest.FlagUserVerified }, webauthn.ErrUserPresence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t, webauthn.AlgEdDSA)
+			cred := register(t, a)
+			tt.modify(a)
+
+			if err := login(t, a, cred); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("wrong challenge", func(t *testing.T) {
+		a := newAuthenticator(t, webauthn.AlgEdDSA)
+		cred := register(t, a)
+		clientDataJSON, authData, sig := a.Get(t, challenge(t))
+		if _, err := rp.VerifyAssertion(*cred, challenge(t), clientDataJSON, authData, sig); !errors.Is(err, webauthn.ErrChallenge) {
+			t.Errorf("err = %v, want %v", err, webauthn.ErrChallenge)
+		}
+	})
+
+	t.Run("attestation client data", func(t *testing.T) {
+		a := newAuthenticator(t, webauthn.AlgEdDSA)
+		cred := register(t, a)
+		c := challenge(t)
+		_, authData, sig := a.Get(t, c)
+		if _, err := rp.VerifyAssertion(*cred, c, a.ClientData("webauthn.create", c), authData, sig); !errors.Is(err, webauthn.ErrCeremonyType) {
+			t.Errorf("err = %v, want %v", err, webauthn.ErrCeremonyType)
+		}
+	})
+
+	t.Run("other credential", func(t *testing.T) {
+		cred := register(t, newAuthenticator(t, webauthn.AlgES256))
+		other := newAuthenticator(t, webauthn.AlgES256)
+		if err := login(t, other, cred); !errors.Is(err, webauthn.ErrBadSignature) {
+			t.Errorf("err = %v, want %v", err, webauthn.ErrBadSignature)
+		}
+	})
+
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		a := newAuthenticator(t, webauthn.AlgEdDSA)
+		cred := register(t, a)
+
+		c := challenge(t)
+		clientDataJSON, authData, sig := a.Get(t, c)
+		authData[36]++
+		if _, err := rp.VerifyAssertion(*cred, c, clientDataJSON, authData, sig); !errors.Is(err, webauthn.ErrBadSignature) {
+			t.Errorf("err = %v, want %v", err, webauthn.ErrBadSignature)
+		}
+	})
+}
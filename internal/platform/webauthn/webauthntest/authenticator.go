@@ -0,0 +1,179 @@
+// Package webauthntest is a software authenticator for tests. It answers
+// registration with "none" attestation and signs assertions with an ES256 or
+// EdDSA key, keeping a sign counter like a hardware authenticator.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/NurulloMahmud/habits/internal/platform/webauthn"
+)
+
+// Authenticator data flags.
+const (
+	FlagUserPresent      = 0x01
+	FlagUserVerified     = 0x04
+	FlagAttestedCredData = 0x40
+)
+
+// Authenticator holds a single credential. Its fields can be changed between
+// ceremonies to produce responses a relying party must reject.
+type Authenticator struct {
+	RPID   string
+	Origin string
+	Flags  byte
+	ID     []byte
+	// SignCount is bumped before every assertion unless NoCounter is set, in
+	// which case it is reported as is like authenticators without a counter.
+	SignCount uint32
+	NoCounter bool
+
+	es256 *ecdsa.PrivateKey
+	eddsa ed25519.PrivateKey
+}
+
+// New returns an authenticator for rpID that answers as if running in a
+// page at origin, with a new key of the given COSE algorithm.
+func New(t testing.TB, rpID, origin string, alg int64) *Authenticator {
+	t.Helper()
+
+	a := &Authenticator{
+		RPID:   rpID,
+		Origin: origin,
+		Flags:  FlagUserPresent | FlagUserVerified,
+		ID:     make([]byte, 16),
+	}
+	if _, err := rand.Read(a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	switch alg {
+	case webauthn.AlgES256:
+		a.es256, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthn.AlgEdDSA:
+		_, a.eddsa, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("webauthntest: unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// ClientData returns the clientDataJSON a browser would send.
+func (a *Authenticator) ClientData(typ string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.Origin,
+	})
+	return data
+}
+
+// Create answers navigator.credentials.create.
+func (a *Authenticator) Create(challenge []byte) (clientDataJSON, attestationObject []byte) {
+	authData := a.authData(a.Flags | FlagAttestedCredData)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.ID)))
+	authData = append(authData, a.ID...)
+	authData = append(authData, a.coseKey()...)
+
+	attestationObject = encode([]pair{
+		{"fmt", "none"},
+		{"attStmt", []pair{}},
+		{"authData", authData},
+	})
+	return a.ClientData("webauthn.create", challenge), attestationObject
+}
+
+// Get answers navigator.credentials.get.
+func (a *Authenticator) Get(t testing.TB, challenge []byte) (clientDataJSON, authenticatorData, signature []byte) {
+	t.Helper()
+
+	if !a.NoCounter {
+		a.SignCount++
+	}
+	clientDataJSON = a.ClientData("webauthn.get", challenge)
+	authenticatorData = a.authData(a.Flags)
+
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientHash[:]...)
+
+	if a.eddsa != nil {
+		return clientDataJSON, authenticatorData, ed25519.Sign(a.eddsa, signed)
+	}
+
+	digest := sha256.Sum256(signed)
+	signature, err := ecdsa.SignASN1(rand.Reader, a.es256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientDataJSON, authenticatorData, signature
+}
+
+func (a *Authenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.SignCount)
+}
+
+func (a *Authenticator) coseKey() []byte {
+	if a.eddsa != nil {
+		pub := a.eddsa.Public().(ed25519.PublicKey)
+		return encode([]pair{{1, 1}, {3, webauthn.AlgEdDSA}, {-1, 6}, {-2, []byte(pub)}})
+	}
+	x := a.es256.X.FillBytes(make([]byte, 32))
+	y := a.es256.Y.FillBytes(make([]byte, 32))
+	return encode([]pair{{1, 2}, {3, webauthn.AlgES256}, {-1, 1}, {-2, x}, {-3, y}})
+}
+
+// pair is a CBOR map entry, maps are slices so the encoding is deterministic.
+type pair struct {
+	key, value any
+}
+
+// encode writes the CBOR subset the authenticator needs.
+func encode(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []pair:
+		out := head(5, uint64(len(v)))
+		for _, p := range v {
+			out = append(out, encode(p.key)...)
+			out = append(out, encode(p.value)...)
+		}
+		return out
+	}
+	panic("webauthntest: cannot encode value")
+}
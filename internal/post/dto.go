@@ -0,0 +1,130 @@
+package post
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	errBodyEmpty     = errors.New("body field is required and cannot be empty")
+	errBodyTooLong   = errors.New("body must not be longer than 500 characters")
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidLimit  = errors.New("limit must be between 1 and 100")
+	errInvalidParent = errors.New("parent_id must be greater than 0")
+	errManyMentions  = errors.New("a post can mention at most 20 users")
+)
+
+const maxMentions = 20
+
+// postRequest is the body of a new or edited post. Mentioned users are only
+// notified when the post is created.
+type postRequest struct {
+	Body     string  `json:"body"`
+	Mentions []int64 `json:"mentions"`
+}
+
+func (r *postRequest) validate() error {
+	r.Body = strings.TrimSpace(r.Body)
+	if r.Body == "" {
+		return errBodyEmpty
+	}
+	if utf8.RuneCountInString(r.Body) > 500 {
+		return errBodyTooLong
+	}
+	if len(r.Mentions) > maxMentions {
+		return errManyMentions
+	}
+	return nil
+}
+
+// cursor is the position of the last post of a feed page. Posts are ordered
+// by created_at and id, newest first.
+type cursor struct {
+	createdAt time.Time
+	id        int64
+}
+
+func (c cursor) encode() string {
+	raw := c.createdAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(c.id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(value string) (*cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	var c cursor
+	c.createdAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	c.id, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &c, nil
+}
+
+type feedQuery struct {
+	habitID int64
+	after   *cursor
+	limit   int
+}
+
+func (q *feedQuery) validate() error {
+	if q.limit < 1 || q.limit > 100 {
+		return errInvalidLimit
+	}
+	return nil
+}
+
+type feedPage struct {
+	Posts      []*Post
+	NextCursor *string
+}
+
+type commentRequest struct {
+	Body     string  `json:"body"`
+	ParentID *int64  `json:"parent_id"`
+	Mentions []int64 `json:"mentions"`
+}
+
+func (r *commentRequest) validate() error {
+	if r.ParentID != nil && *r.ParentID <= 0 {
+		return errInvalidParent
+	}
+	body := postRequest{Body: r.Body, Mentions: r.Mentions}
+	if err := body.validate(); err != nil {
+		return err
+	}
+	r.Body = body.Body
+	return nil
+}
+
+type commentsQuery struct {
+	postID int64
+	after  *cursor
+	limit  int
+}
+
+func (q *commentsQuery) validate() error {
+	if q.limit < 1 || q.limit > 100 {
+		return errInvalidLimit
+	}
+	return nil
+}
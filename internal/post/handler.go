@@ -0,0 +1,273 @@
+package post
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	var req postRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.create(r.Context(), *user, habitID, req, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	habitID, postID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req postRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.update(r.Context(), *user, habitID, postID, req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	habitID, postID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	err := h.service.delete(r.Context(), *user, habitID, postID)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "post deleted successfully"})
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	var q feedQuery
+
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	q.habitID = habitID
+	q.limit = utils.ReadInt(r, "limit", 20)
+
+	q.after, err = decodeCursor(utils.ReadString(r, "cursor", ""))
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = q.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	page, err := h.service.list(r.Context(), *user, q)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"data":        page.Posts,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+func (h *Handler) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+	habitID, postID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req commentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.createComment(r.Context(), *user, habitID, postID, req, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	habitID, postID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+	commentID, err := utils.ReadInt64Param(r, "commentID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	err = h.service.deleteComment(r.Context(), *user, habitID, postID, commentID)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "comment deleted successfully"})
+}
+
+func (h *Handler) HandleListComments(w http.ResponseWriter, r *http.Request) {
+	var q commentsQuery
+
+	habitID, postID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+	q.postID = postID
+	q.limit = utils.ReadInt(r, "limit", 20)
+
+	var err error
+	q.after, err = decodeCursor(utils.ReadString(r, "cursor", ""))
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = q.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, next, err := h.service.listComments(r.Context(), *user, habitID, q)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"data":        data,
+		"next_cursor": next,
+	})
+}
+
+func (h *Handler) HandleReact(w http.ResponseWriter, r *http.Request) {
+	habitID, postID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	err := h.service.react(r.Context(), *user, habitID, postID, chi.URLParam(r, "reaction"))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "reaction added"})
+}
+
+func (h *Handler) HandleUnreact(w http.ResponseWriter, r *http.Request) {
+	habitID, postID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	err := h.service.unreact(r.Context(), *user, habitID, postID, chi.URLParam(r, "reaction"))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "reaction removed"})
+}
+
+func (h *Handler) readParams(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return 0, 0, false
+	}
+	postID, err := utils.ReadInt64Param(r, "postID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return 0, 0, false
+	}
+	return habitID, postID, true
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case access.ErrNoHabit, errNoPost, errNoComment, errNoParentComment, errNestedReply, errInvalidReaction:
+		response.BadRequest(w, r, err, h.logger)
+	case errNotAuthor, errCannotDrop, errCannotDropReply:
+		response.Forbidden(w, r, err.Error())
+	default:
+		if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
+			return
+		}
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
@@ -0,0 +1,59 @@
+package post
+
+import "time"
+
+type Author struct {
+	ID        int64   `json:"user_id"`
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+}
+
+type Post struct {
+	ID           int64           `json:"id"`
+	HabitID      int64           `json:"habit_id"`
+	Author       Author          `json:"author"`
+	Body         string          `json:"body"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    *time.Time      `json:"updated_at,omitempty"`
+	CommentCount int64           `json:"comment_count"`
+	Reactions    []ReactionCount `json:"reactions"`
+}
+
+type Comment struct {
+	ID        int64      `json:"id"`
+	PostID    int64      `json:"post_id"`
+	ParentID  *int64     `json:"parent_id,omitempty"`
+	Author    Author     `json:"author"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+type ReactionCount struct {
+	Reaction string `json:"reaction"`
+	Emoji    string `json:"emoji"`
+	Count    int64  `json:"count"`
+	Reacted  bool   `json:"reacted"`
+}
+
+// reactions is the fixed set of reactions, in the order they are returned.
+var reactions = []struct {
+	name  string
+	emoji string
+}{
+	{"like", "👍"},
+	{"love", "❤️"},
+	{"fire", "🔥"},
+	{"clap", "👏"},
+	{"muscle", "💪"},
+	{"celebrate", "🎉"},
+}
+
+func validReaction(name string) bool {
+	for _, r := range reactions {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package post
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Repository interface {
+	create(ctx context.Context, habitID, authorID int64, body string) (*Post, error)
+	get(ctx context.Context, id int64) (*Post, error)
+	update(ctx context.Context, id int64, body string) (*Post, error)
+	delete(ctx context.Context, id int64) error
+	list(ctx context.Context, q feedQuery) ([]*Post, error)
+	reactionCounts(ctx context.Context, postIDs []int64, userID int64) (map[int64]map[string]ReactionCount, error)
+	addReaction(ctx context.Context, postID, userID int64, reaction string) error
+	removeReaction(ctx context.Context, postID, userID int64, reaction string) error
+	createComment(ctx context.Context, c Comment) (*Comment, error)
+	getComment(ctx context.Context, id int64) (*Comment, error)
+	deleteComment(ctx context.Context, id int64) error
+	listComments(ctx context.Context, q commentsQuery) ([]*Comment, error)
+	listReplies(ctx context.Context, parentIDs []int64) ([]*Comment, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const postColumns = `
+	p.id,
+	p.habit_id,
+	p.post,
+	p.created_at,
+	p.updated_at,
+	(SELECT COUNT(*) FROM habit_post_comments c WHERE c.post_id = p.id),
+	u.id,
+	u.first_name,
+	u.last_name`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPost(row rowScanner) (*Post, error) {
+	var p Post
+	err := row.Scan(
+		&p.ID,
+		&p.HabitID,
+		&p.Body,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.CommentCount,
+		&p.Author.ID,
+		&p.Author.FirstName,
+		&p.Author.LastName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *postgresRepository) create(ctx context.Context, habitID, authorID int64, body string) (*Post, error) {
+	query := `
+	WITH p AS (
+		INSERT INTO habit_posts (habit_id, author_id, post)
+		VALUES ($1, $2, $3)
+		RETURNING *
+	)
+	SELECT ` + postColumns + `
+	FROM p
+	JOIN users u ON u.id = p.author_id`
+
+	return scanPost(r.db.QueryRowContext(ctx, query, habitID, authorID, body))
+}
+
+func (r *postgresRepository) get(ctx context.Context, id int64) (*Post, error) {
+	query := `
+	SELECT ` + postColumns + `
+	FROM habit_posts p
+	JOIN users u ON u.id = p.author_id
+	WHERE p.id = $1`
+
+	p, err := scanPost(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (r *postgresRepository) update(ctx context.Context, id int64, body string) (*Post, error) {
+	query := `
+	WITH p AS (
+		UPDATE habit_posts
+		SET post = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING *
+	)
+	SELECT ` + postColumns + `
+	FROM p
+	JOIN users u ON u.id = p.author_id`
+
+	return scanPost(r.db.QueryRowContext(ctx, query, id, body))
+}
+
+func (r *postgresRepository) delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM habit_posts WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// list returns up to q.limit posts older than the cursor, newest first.
+func (r *postgresRepository) list(ctx context.Context, q feedQuery) ([]*Post, error) {
+	result := []*Post{}
+
+	var createdAt, id any
+	if q.after != nil {
+		createdAt, id = q.after.createdAt, q.after.id
+	}
+
+	query := `
+	SELECT ` + postColumns + `
+	FROM habit_posts p
+	JOIN users u ON u.id = p.author_id
+	WHERE
+		p.habit_id = $1 AND
+		($2::TIMESTAMPTZ IS NULL OR (p.created_at, p.id) < ($2::TIMESTAMPTZ, $3::BIGINT))
+	ORDER BY p.created_at DESC, p.id DESC
+	LIMIT $4`
+
+	rows, err := r.db.QueryContext(ctx, query, q.habitID, createdAt, id, q.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+
+	return result, rows.Err()
+}
+
+// reactionCounts groups the reactions of the posts by post and reaction.
+func (r *postgresRepository) reactionCounts(ctx context.Context, postIDs []int64, userID int64) (map[int64]map[string]ReactionCount, error) {
+	result := map[int64]map[string]ReactionCount{}
+
+	query := `
+	SELECT post_id, reaction, COUNT(*), BOOL_OR(user_id = $2)
+	FROM habit_post_reactions
+	WHERE post_id = ANY($1)
+	GROUP BY post_id, reaction`
+
+	rows, err := r.db.QueryContext(ctx, query, postIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int64
+		var rc ReactionCount
+		if err = rows.Scan(&postID, &rc.Reaction, &rc.Count, &rc.Reacted); err != nil {
+			return nil, err
+		}
+		if result[postID] == nil {
+			result[postID] = map[string]ReactionCount{}
+		}
+		result[postID][rc.Reaction] = rc
+	}
+
+	return result, rows.Err()
+}
+
+func (r *postgresRepository) addReaction(ctx context.Context, postID, userID int64, reaction string) error {
+	query := `
+	INSERT INTO habit_post_reactions (post_id, user_id, reaction)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, postID, userID, reaction)
+	return err
+}
+
+func (r *postgresRepository) removeReaction(ctx context.Context, postID, userID int64, reaction string) error {
+	query := `DELETE FROM habit_post_reactions WHERE post_id = $1 AND user_id = $2 AND reaction = $3`
+	_, err := r.db.ExecContext(ctx, query, postID, userID, reaction)
+	return err
+}
+
+const commentColumns = `
+	c.id,
+	c.post_id,
+	c.parent_id,
+	c.body,
+	c.created_at,
+	u.id,
+	u.first_name,
+	u.last_name`
+
+func scanComment(row rowScanner) (*Comment, error) {
+	var c Comment
+	err := row.Scan(
+		&c.ID,
+		&c.PostID,
+		&c.ParentID,
+		&c.Body,
+		&c.CreatedAt,
+		&c.Author.ID,
+		&c.Author.FirstName,
+		&c.Author.LastName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *postgresRepository) createComment(ctx context.Context, c Comment) (*Comment, error) {
+	query := `
+	WITH c AS (
+		INSERT INTO habit_post_comments (post_id, parent_id, author_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *
+	)
+	SELECT ` + commentColumns + `
+	FROM c
+	JOIN users u ON u.id = c.author_id`
+
+	return scanComment(r.db.QueryRowContext(ctx, query, c.PostID, c.ParentID, c.Author.ID, c.Body))
+}
+
+func (r *postgresRepository) getComment(ctx context.Context, id int64) (*Comment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM habit_post_comments c
+	JOIN users u ON u.id = c.author_id
+	WHERE c.id = $1`
+
+	c, err := scanComment(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+func (r *postgresRepository) deleteComment(ctx context.Context, id int64) error {
+	query := `DELETE FROM habit_post_comments WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// listComments returns up to q.limit top level comments after the cursor,
+// oldest first.
+func (r *postgresRepository) listComments(ctx context.Context, q commentsQuery) ([]*Comment, error) {
+	var createdAt, id any
+	if q.after != nil {
+		createdAt, id = q.after.createdAt, q.after.id
+	}
+
+	query := `
+	SELECT ` + commentColumns + `
+	FROM habit_post_comments c
+	JOIN users u ON u.id = c.author_id
+	WHERE
+		c.post_id = $1 AND
+		c.parent_id IS NULL AND
+		($2::TIMESTAMPTZ IS NULL OR (c.created_at, c.id) > ($2::TIMESTAMPTZ, $3::BIGINT))
+	ORDER BY c.created_at, c.id
+	LIMIT $4`
+
+	return r.queryComments(ctx, query, q.postID, createdAt, id, q.limit)
+}
+
+func (r *postgresRepository) listReplies(ctx context.Context, parentIDs []int64) ([]*Comment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM habit_post_comments c
+	JOIN users u ON u.id = c.author_id
+	WHERE c.parent_id = ANY($1)
+	ORDER BY c.created_at, c.id`
+
+	return r.queryComments(ctx, query, parentIDs)
+}
+
+func (r *postgresRepository) queryComments(ctx context.Context, query string, args ...any) ([]*Comment, error) {
+	result := []*Comment{}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+
+	return result, rows.Err()
+}
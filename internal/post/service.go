@@ -0,0 +1,373 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/notification"
+	"github.com/NurulloMahmud/habits/internal/realtime"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+var (
+	errNoPost     = errors.New("No post found with given id")
+	errNotAuthor  = errors.New("Only the author can edit this post")
+	errCannotDrop = errors.New("Only the author, the habit owner or a moderator can remove this post")
+
+	errNoComment       = errors.New("No comment found with given id")
+	errNoParentComment = errors.New("No parent comment found on this post")
+	errNestedReply     = errors.New("Replies can only be added to top level comments")
+	errCannotDropReply = errors.New("Only the author, the habit owner or a moderator can remove this comment")
+	errInvalidReaction = errors.New("reaction must be one of like, love, fire, clap, muscle or celebrate")
+)
+
+type Service struct {
+	repo          Repository
+	access        access.Service
+	notifications notification.Service
+	events        *realtime.Hub
+}
+
+func NewService(repo Repository, access access.Service, notifications notification.Service, events *realtime.Hub) Service {
+	return Service{
+		repo:          repo,
+		access:        access,
+		notifications: notifications,
+		events:        events,
+	}
+}
+
+// create stores a post and notifies the mentioned members. The post is saved
+// by then, so a failed notification is logged rather than returned.
+func (s *Service) create(ctx context.Context, user cx.User, habitID int64, req postRequest, logger *log.Logger) (*Post, error) {
+	_, err := s.access.Require(ctx, user, habitID, access.CreatePost)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.repo.create(ctx, habitID, user.ID, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.notifyMentions(ctx, user, notification.Payload{HabitID: &habitID, PostID: &p.ID}, req.Mentions)
+	if err != nil {
+		logger.Printf("[ERROR] post %d mentions: %v\n", p.ID, err)
+	}
+
+	p.Reactions = emptyReactions()
+	s.events.Publish(ctx, habitID, realtime.TypePost, p)
+	return p, nil
+}
+
+// notifyMentions notifies the mentioned users that are members of the habit,
+// anyone else is ignored so private habits do not leak through mentions.
+func (s *Service) notifyMentions(ctx context.Context, user cx.User, payload notification.Payload, mentions []int64) error {
+	payload.ActorID = &user.ID
+
+	var members []int64
+	for _, userID := range mentions {
+		m, err := s.access.Membership(ctx, *payload.HabitID, userID)
+		if err != nil {
+			return err
+		}
+		if m != nil && m.IsMember() && !slices.Contains(members, userID) {
+			members = append(members, userID)
+		}
+	}
+
+	return s.notifications.Notify(ctx, notification.TypeMention, payload, members...)
+}
+
+func (s *Service) update(ctx context.Context, user cx.User, habitID, postID int64, req postRequest) (*Post, error) {
+	p, err := s.habitPost(ctx, user, habitID, postID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Author.ID != user.ID {
+		return nil, errNotAuthor
+	}
+
+	p, err = s.repo.update(ctx, p.ID, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.withReactions(ctx, user, []*Post{p})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Service) delete(ctx context.Context, user cx.User, habitID, postID int64) error {
+	p, err := s.habitPost(ctx, user, habitID, postID)
+	if err != nil {
+		return err
+	}
+
+	if p.Author.ID != user.ID {
+		_, err = s.access.Require(ctx, user, habitID, access.ModeratePosts)
+		if access.IsForbidden(err) {
+			return errCannotDrop
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.repo.delete(ctx, p.ID)
+}
+
+// list returns one page of the habit's feed. A page is read with one extra
+// row to tell whether another page follows.
+func (s *Service) list(ctx context.Context, user cx.User, q feedQuery) (*feedPage, error) {
+	_, err := s.access.Require(ctx, user, q.habitID, access.ViewHabit)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := q.limit
+	q.limit++
+	posts, err := s.repo.list(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := feedPage{Posts: posts}
+	if len(posts) > limit {
+		page.Posts = posts[:limit]
+		last := page.Posts[limit-1]
+		next := cursor{createdAt: last.CreatedAt, id: last.ID}.encode()
+		page.NextCursor = &next
+	}
+
+	err = s.withReactions(ctx, user, page.Posts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// habitPost loads a post of the habit the user is allowed to see.
+func (s *Service) habitPost(ctx context.Context, user cx.User, habitID, postID int64) (*Post, error) {
+	_, err := s.access.Require(ctx, user, habitID, access.ViewHabit)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.repo.get(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || p.HabitID != habitID {
+		return nil, errNoPost
+	}
+	return p, nil
+}
+
+// withReactions fills in the reaction counts of the posts, every reaction of
+// the fixed set is listed even when nobody used it.
+func (s *Service) withReactions(ctx context.Context, user cx.User, posts []*Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	counts, err := s.repo.reactionCounts(ctx, ids, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Reactions = emptyReactions()
+		for i := range p.Reactions {
+			if rc, ok := counts[p.ID][p.Reactions[i].Reaction]; ok {
+				p.Reactions[i].Count = rc.Count
+				p.Reactions[i].Reacted = rc.Reacted
+			}
+		}
+	}
+	return nil
+}
+
+func emptyReactions() []ReactionCount {
+	result := make([]ReactionCount, len(reactions))
+	for i, r := range reactions {
+		result[i] = ReactionCount{Reaction: r.name, Emoji: r.emoji}
+	}
+	return result
+}
+
+func (s *Service) react(ctx context.Context, user cx.User, habitID, postID int64, reaction string) error {
+	p, err := s.reactablePost(ctx, user, habitID, postID, reaction)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.addReaction(ctx, p.ID, user.ID, reaction)
+}
+
+func (s *Service) unreact(ctx context.Context, user cx.User, habitID, postID int64, reaction string) error {
+	p, err := s.reactablePost(ctx, user, habitID, postID, reaction)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.removeReaction(ctx, p.ID, user.ID, reaction)
+}
+
+func (s *Service) reactablePost(ctx context.Context, user cx.User, habitID, postID int64, reaction string) (*Post, error) {
+	if !validReaction(reaction) {
+		return nil, errInvalidReaction
+	}
+
+	_, err := s.access.Require(ctx, user, habitID, access.CreatePost)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.habitPost(ctx, user, habitID, postID)
+}
+
+// createComment adds a comment to the post. Threads are one level deep, so a
+// reply must point at a top level comment.
+func (s *Service) createComment(ctx context.Context, user cx.User, habitID, postID int64, req commentRequest, logger *log.Logger) (*Comment, error) {
+	_, err := s.access.Require(ctx, user, habitID, access.CreatePost)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.habitPost(ctx, user, habitID, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the post author hears about every comment, a comment author about replies
+	recipients := []int64{p.Author.ID}
+	if req.ParentID != nil {
+		parent, err := s.repo.getComment(ctx, *req.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || parent.PostID != p.ID {
+			return nil, errNoParentComment
+		}
+		if parent.ParentID != nil {
+			return nil, errNestedReply
+		}
+		if parent.Author.ID != p.Author.ID {
+			recipients = append(recipients, parent.Author.ID)
+		}
+	}
+
+	c, err := s.repo.createComment(ctx, Comment{
+		PostID:   p.ID,
+		ParentID: req.ParentID,
+		Author:   Author{ID: user.ID},
+		Body:     req.Body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := notification.Payload{HabitID: &habitID, PostID: &p.ID, CommentID: &c.ID, ActorID: &user.ID}
+	// the comment is saved, notification failures are only logged
+	err = s.notifications.Notify(ctx, notification.TypePostComment, payload, recipients...)
+	if err != nil {
+		logger.Printf("[ERROR] comment %d notification: %v\n", c.ID, err)
+	}
+
+	var mentions []int64
+	for _, userID := range req.Mentions {
+		if !slices.Contains(recipients, userID) {
+			mentions = append(mentions, userID)
+		}
+	}
+	err = s.notifyMentions(ctx, user, payload, mentions)
+	if err != nil {
+		logger.Printf("[ERROR] comment %d mentions: %v\n", c.ID, err)
+	}
+
+	return c, nil
+}
+
+func (s *Service) deleteComment(ctx context.Context, user cx.User, habitID, postID, commentID int64) error {
+	p, err := s.habitPost(ctx, user, habitID, postID)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.repo.getComment(ctx, commentID)
+	if err != nil {
+		return err
+	}
+	if c == nil || c.PostID != p.ID {
+		return errNoComment
+	}
+
+	if c.Author.ID != user.ID {
+		_, err = s.access.Require(ctx, user, habitID, access.ModeratePosts)
+		if access.IsForbidden(err) {
+			return errCannotDropReply
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.repo.deleteComment(ctx, c.ID)
+}
+
+// listComments returns a page of top level comments with their replies.
+func (s *Service) listComments(ctx context.Context, user cx.User, habitID int64, q commentsQuery) ([]*Comment, *string, error) {
+	p, err := s.habitPost(ctx, user, habitID, q.postID)
+	if err != nil {
+		return nil, nil, err
+	}
+	q.postID = p.ID
+
+	limit := q.limit
+	q.limit++
+	comments, err := s.repo.listComments(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *string
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[limit-1]
+		encoded := cursor{createdAt: last.CreatedAt, id: last.ID}.encode()
+		next = &encoded
+	}
+	if len(comments) == 0 {
+		return comments, next, nil
+	}
+
+	ids := make([]int64, len(comments))
+	byID := make(map[int64]*Comment, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+		byID[c.ID] = c
+	}
+
+	replies, err := s.repo.listReplies(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, reply := range replies {
+		parent := byID[*reply.ParentID]
+		parent.Replies = append(parent.Replies, reply)
+	}
+
+	return comments, next, nil
+}
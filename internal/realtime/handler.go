@@ -0,0 +1,149 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/access"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+// heartbeat keeps idle streams open through proxies.
+const heartbeat = 25 * time.Second
+
+// Sessions tells whether a login session is still signed in.
+type Sessions interface {
+	Active(ctx context.Context, id int64) (bool, error)
+}
+
+type Handler struct {
+	hub      *Hub
+	access   access.Service
+	sessions Sessions
+	logger   *log.Logger
+}
+
+func NewHandler(hub *Hub, access access.Service, sessions Sessions, log *log.Logger) *Handler {
+	return &Handler{
+		hub:      hub,
+		access:   access,
+		sessions: sessions,
+		logger:   log,
+	}
+}
+
+// HandleEvents streams the habit's events as Server-Sent Events until the
+// client disconnects, stops being a member, its token expires or its session
+// is signed out. The token is only checked once at connect, so the stream
+// ends itself where a new request would be refused.
+func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := cx.GetUser(r)
+	_, err = h.access.Require(r.Context(), *user, habitID, access.WatchHabit)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	// the stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err = rc.SetWriteDeadline(time.Time{}); err != nil {
+		response.InternalServerError(w, r, err, h.logger)
+		return
+	}
+
+	events, unsubscribe := h.hub.Subscribe(habitID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	// the client reconnects with a refreshed token
+	var expired <-chan time.Time
+	if user.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(*user.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			return
+		case <-ticker.C:
+			if !h.sessionActive(r.Context(), user) {
+				return
+			}
+			fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-events:
+			if !ok {
+				// fell too far behind, the client reconnects and reloads
+				return
+			}
+
+			// the event may have removed the watcher, who then must not
+			// get it or anything after it
+			if e.isMemberEvent() {
+				_, err = h.access.Require(r.Context(), *user, habitID, access.WatchHabit)
+				if err != nil {
+					return
+				}
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, e.Data)
+		}
+
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// sessionActive reports whether the stream's login session is still signed
+// in. Tokens without a session are bounded by their expiry alone.
+func (h *Handler) sessionActive(ctx context.Context, user *cx.User) bool {
+	if user.SessionID == 0 {
+		return true
+	}
+
+	active, err := h.sessions.Active(ctx, user.SessionID)
+	if err != nil {
+		h.logger.Printf("[ERROR] habit events: session %d: %v\n", user.SessionID, err)
+		return false
+	}
+	return active
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case access.ErrNoHabit:
+		response.BadRequest(w, r, err, h.logger)
+	default:
+		if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
+			return
+		}
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
@@ -0,0 +1,151 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a slow client can fall behind before
+// it is disconnected.
+const subscriberBuffer = 32
+
+// Backend carries events between API instances. Publish hands an event to
+// the backend and Listen delivers every published event, including the
+// ones from other instances, until ctx is cancelled.
+type Backend interface {
+	Publish(ctx context.Context, e Event) error
+	Listen(ctx context.Context, deliver func(Event)) error
+}
+
+// Hub fans events out to the clients subscribed to a habit.
+type Hub struct {
+	backend Backend
+	logger  *log.Logger
+
+	mu          sync.Mutex
+	subscribers map[int64]map[chan Event]struct{}
+}
+
+func NewHub(backend Backend, logger *log.Logger) *Hub {
+	return &Hub{
+		backend:     backend,
+		logger:      logger,
+		subscribers: make(map[int64]map[chan Event]struct{}),
+	}
+}
+
+// Run listens on the backend until ctx is cancelled, reconnecting when the
+// backend fails.
+func (h *Hub) Run(ctx context.Context) {
+	for {
+		err := h.backend.Listen(ctx, h.deliver)
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Printf("[ERROR] realtime listen: %v\n", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Publish sends an event to everyone watching the habit. Failures are only
+// logged, a lost live update must not fail the change that caused it.
+func (h *Hub) Publish(ctx context.Context, habitID int64, typ string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		h.logger.Printf("[ERROR] realtime publish %s: %v\n", typ, err)
+		return
+	}
+
+	e := Event{Type: typ, HabitID: habitID, Data: raw, At: time.Now().UTC()}
+	if err = h.backend.Publish(ctx, e); err != nil {
+		h.logger.Printf("[ERROR] realtime publish %s: %v\n", typ, err)
+	}
+}
+
+// Subscribe returns a channel with the habit's events and a function that
+// ends the subscription. The channel is closed when the subscriber falls too
+// far behind.
+func (h *Hub) Subscribe(habitID int64) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[habitID] == nil {
+		h.subscribers[habitID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[habitID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(habitID, ch)
+	}
+}
+
+func (h *Hub) deliver(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[e.HabitID] {
+		select {
+		case ch <- e:
+		default:
+			h.remove(e.HabitID, ch)
+		}
+	}
+}
+
+// remove closes and drops a subscriber, h.mu must be held.
+func (h *Hub) remove(habitID int64, ch chan Event) {
+	subs := h.subscribers[habitID]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, habitID)
+	}
+}
+
+// memoryBackend delivers events within a single API instance.
+type memoryBackend struct {
+	mu      sync.RWMutex
+	deliver func(Event)
+}
+
+func NewMemoryBackend() Backend {
+	return &memoryBackend{}
+}
+
+func (b *memoryBackend) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.deliver != nil {
+		b.deliver(e)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Listen(ctx context.Context, deliver func(Event)) error {
+	b.mu.Lock()
+	b.deliver = deliver
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	b.deliver = nil
+	b.mu.Unlock()
+	return ctx.Err()
+}
@@ -0,0 +1,38 @@
+package realtime
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	TypeCheckin       = "checkin.created"
+	TypePost          = "post.created"
+	TypeMemberJoined  = "member.joined"
+	TypeMemberLeft    = "member.left"
+	TypeMemberRemoved = "member.removed"
+	TypeMemberRole    = "member.role_changed"
+)
+
+// Event is a change in a habit room, streamed to the members watching it.
+type Event struct {
+	Type    string          `json:"type"`
+	HabitID int64           `json:"habit_id"`
+	Data    json.RawMessage `json:"data"`
+	At      time.Time       `json:"at"`
+}
+
+// MemberChange is the data of the member.* events.
+type MemberChange struct {
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role,omitempty"`
+}
+
+// isMemberEvent reports whether the event changes who can watch the habit.
+func (e Event) isMemberEvent() bool {
+	switch e.Type {
+	case TypeMemberLeft, TypeMemberRemoved, TypeMemberRole:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package realtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// channel is the Postgres notification channel the events are sent on.
+const channel = "habit_events"
+
+// maxPayload is the largest payload Postgres accepts in a notification.
+const maxPayload = 8000
+
+var errEventTooLarge = errors.New("event is too large for a postgres notification")
+
+// postgresBackend fans events out across API instances with LISTEN/NOTIFY.
+type postgresBackend struct {
+	db *sql.DB
+}
+
+func NewPostgresBackend(db *sql.DB) Backend {
+	return &postgresBackend{db: db}
+}
+
+func (b *postgresBackend) Publish(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if len(payload) >= maxPayload {
+		return errEventTooLarge
+	}
+
+	_, err = b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, string(payload))
+	return err
+}
+
+// Listen holds on to one pooled connection for as long as it listens. The
+// connection is closed when Listen returns, so it never goes back to the pool
+// with the LISTEN still active.
+func (b *postgresBackend) Listen(ctx context.Context, deliver func(Event)) error {
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		defer pgConn.Close(context.Background())
+
+		if _, err := pgConn.Exec(ctx, "LISTEN "+channel); err != nil {
+			return err
+		}
+
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+
+			var e Event
+			if err = json.Unmarshal([]byte(n.Payload), &e); err != nil {
+				continue
+			}
+			deliver(e)
+		}
+	})
+}
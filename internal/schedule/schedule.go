@@ -0,0 +1,228 @@
+package schedule
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+const (
+	TypeDaily    = "daily"
+	TypeWeekdays = "weekdays"
+	TypeInterval = "interval"
+	TypeWeekly   = "weekly"
+	TypeMonthly  = "monthly"
+)
+
+var (
+	errInvalidType      = errors.New("schedule type must be one of daily, weekdays, interval, weekly or monthly")
+	errWeekdaysEmpty    = errors.New("weekdays schedule requires at least one day, e.g. [\"mon\", \"wed\", \"fri\"]")
+	errInvalidWeekday   = errors.New("weekdays must be one of mon, tue, wed, thu, fri, sat, sun")
+	errDuplicateWeekday = errors.New("weekdays must not contain duplicates")
+	errInvalidEveryDays = errors.New("interval schedule requires every_days greater than or equal to 2")
+	errInvalidWeekly    = errors.New("weekly schedule requires times between 1 and 7")
+	errInvalidMonthly   = errors.New("monthly schedule requires times between 1 and 28")
+)
+
+var validationErrors = []error{
+	errInvalidType,
+	errWeekdaysEmpty,
+	errInvalidWeekday,
+	errDuplicateWeekday,
+	errInvalidEveryDays,
+	errInvalidWeekly,
+	errInvalidMonthly,
+}
+
+// IsValidationError reports whether err was returned by Validate.
+func IsValidationError(err error) bool {
+	for _, e := range validationErrors {
+		if err == e {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule describes on which days a habit has to be completed. Every
+// schedule splits the calendar into periods: a single day for daily and
+// weekdays schedules, a block of every_days days counted from the habit's
+// start date for interval schedules, and a calendar week (Monday first) or
+// month for weekly and monthly schedules. A period is met when the member
+// reaches the daily target on Required() days within it.
+type Schedule struct {
+	Type      string   `json:"type"`
+	Weekdays  []string `json:"weekdays,omitempty"`
+	EveryDays int      `json:"every_days,omitempty"`
+	Times     int      `json:"times,omitempty"`
+}
+
+func Daily() Schedule {
+	return Schedule{Type: TypeDaily}
+}
+
+// Validate checks the schedule and drops fields the type does not use.
+func (s *Schedule) Validate() error {
+	switch s.Type {
+	case TypeDaily:
+		*s = Daily()
+	case TypeWeekdays:
+		if len(s.Weekdays) == 0 {
+			return errWeekdaysEmpty
+		}
+		seen := make(map[string]bool, len(s.Weekdays))
+		for i, day := range s.Weekdays {
+			day = strings.ToLower(strings.TrimSpace(day))
+			if _, ok := weekdayNames[day]; !ok {
+				return errInvalidWeekday
+			}
+			if seen[day] {
+				return errDuplicateWeekday
+			}
+			seen[day] = true
+			s.Weekdays[i] = day
+		}
+		*s = Schedule{Type: TypeWeekdays, Weekdays: s.Weekdays}
+	case TypeInterval:
+		if s.EveryDays < 2 {
+			return errInvalidEveryDays
+		}
+		*s = Schedule{Type: TypeInterval, EveryDays: s.EveryDays}
+	case TypeWeekly:
+		if s.Times < 1 || s.Times > 7 {
+			return errInvalidWeekly
+		}
+		*s = Schedule{Type: TypeWeekly, Times: s.Times}
+	case TypeMonthly:
+		// every month has at least 28 days, more could never be met in February
+		if s.Times < 1 || s.Times > 28 {
+			return errInvalidMonthly
+		}
+		*s = Schedule{Type: TypeMonthly, Times: s.Times}
+	default:
+		return errInvalidType
+	}
+	return nil
+}
+
+// Period returns the first day of the period containing date. The second
+// value is false when date is not a scheduled day at all, such check-ins
+// neither count nor break streaks.
+func (s Schedule) Period(date, start time.Time) (time.Time, bool) {
+	switch s.Type {
+	case TypeWeekdays:
+		return date, s.hasWeekday(date.Weekday())
+	case TypeInterval:
+		offset := daysBetween(start, date) % s.EveryDays
+		if offset < 0 {
+			offset += s.EveryDays
+		}
+		return date.AddDate(0, 0, -offset), true
+	case TypeWeekly:
+		return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7)), true
+	case TypeMonthly:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC), true
+	default:
+		return date, true
+	}
+}
+
+// Previous returns the first day of the period before the one starting at
+// period. For weekdays schedules it is the closest earlier scheduled day.
+func (s Schedule) Previous(period time.Time) time.Time {
+	switch s.Type {
+	case TypeWeekdays:
+		for i := 1; i <= 7; i++ {
+			day := period.AddDate(0, 0, -i)
+			if s.hasWeekday(day.Weekday()) {
+				return day
+			}
+		}
+		return period.AddDate(0, 0, -7)
+	case TypeInterval:
+		return period.AddDate(0, 0, -s.EveryDays)
+	case TypeWeekly:
+		return period.AddDate(0, 0, -7)
+	case TypeMonthly:
+		return period.AddDate(0, -1, 0)
+	default:
+		return period.AddDate(0, 0, -1)
+	}
+}
+
+// End returns the last day of the period starting at period.
+func (s Schedule) End(period time.Time) time.Time {
+	switch s.Type {
+	case TypeInterval:
+		return period.AddDate(0, 0, s.EveryDays-1)
+	case TypeWeekly:
+		return period.AddDate(0, 0, 6)
+	case TypeMonthly:
+		return period.AddDate(0, 1, -1)
+	default:
+		return period
+	}
+}
+
+// Required returns how many met days a period needs.
+func (s Schedule) Required() int {
+	if s.Type == TypeWeekly || s.Type == TypeMonthly {
+		return s.Times
+	}
+	return 1
+}
+
+// daysBetween counts the calendar days from start to date. Both are taken as
+// calendar days, so a DST transition in between cannot shorten the count.
+func daysBetween(start, date time.Time) int {
+	from := utils.DateIn(start, start.Location())
+	to := utils.DateIn(date, date.Location())
+	return int(to.Sub(from) / (24 * time.Hour))
+}
+
+func (s Schedule) hasWeekday(day time.Weekday) bool {
+	for _, name := range s.Weekdays {
+		if weekdayNames[name] == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Schedule) Value() (driver.Value, error) {
+	if s.Type == "" {
+		s = Daily()
+	}
+	return json.Marshal(s)
+}
+
+func (s *Schedule) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*s = Daily()
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into schedule", src)
+	}
+	return json.Unmarshal(data, s)
+}
@@ -0,0 +1,40 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestValidateMonthlyTimes(t *testing.T) {
+	for times, valid := range map[int]bool{0: false, 1: true, 28: true, 29: false, 31: false} {
+		s := Schedule{Type: TypeMonthly, Times: times}
+		if err := s.Validate(); (err == nil) != valid {
+			t.Errorf("times %d: err = %v", times, err)
+		}
+	}
+}
+
+func TestIntervalPeriodAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024-03-10 is 23 hours long in New York
+	s := Schedule{Type: TypeInterval, EveryDays: 2}
+	start := time.Date(2024, 3, 9, 0, 0, 0, 0, loc)
+	tests := []struct {
+		date, want time.Time
+	}{
+		{time.Date(2024, 3, 10, 0, 0, 0, 0, loc), time.Date(2024, 3, 9, 0, 0, 0, 0, loc)},
+		{time.Date(2024, 3, 11, 0, 0, 0, 0, loc), time.Date(2024, 3, 11, 0, 0, 0, 0, loc)},
+		{time.Date(2024, 3, 12, 0, 0, 0, 0, loc), time.Date(2024, 3, 11, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		got, scheduled := s.Period(tt.date, start)
+		if !scheduled || !got.Equal(tt.want) {
+			t.Errorf("Period(%v) = %v, %v, want %v", tt.date, got, scheduled, tt.want)
+		}
+	}
+}
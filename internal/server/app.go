@@ -1,30 +1,59 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/apitoken"
+	"github.com/NurulloMahmud/habits/internal/auth"
 	"github.com/NurulloMahmud/habits/internal/habit"
 	habitmember "github.com/NurulloMahmud/habits/internal/habit_member"
+	"github.com/NurulloMahmud/habits/internal/identity"
 	"github.com/NurulloMahmud/habits/internal/middleware"
+	"github.com/NurulloMahmud/habits/internal/notification"
+	"github.com/NurulloMahmud/habits/internal/passkey"
+	"github.com/NurulloMahmud/habits/internal/performance"
 	"github.com/NurulloMahmud/habits/internal/platform/database"
+	"github.com/NurulloMahmud/habits/internal/platform/mailer"
+	"github.com/NurulloMahmud/habits/internal/post"
+	"github.com/NurulloMahmud/habits/internal/realtime"
+	"github.com/NurulloMahmud/habits/internal/session"
+	"github.com/NurulloMahmud/habits/internal/streak"
+	"github.com/NurulloMahmud/habits/internal/timer"
 	"github.com/NurulloMahmud/habits/internal/user"
 	"github.com/NurulloMahmud/habits/migrations"
-	"github.com/NurulloMahmud/habits/pkg/context"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
 	"github.com/NurulloMahmud/habits/pkg/response"
 )
 
 type Application struct {
-	Logger             *log.Logger
-	userHandler        user.UserHandler
-	habitHandler       habit.HabitHandler
-	habitMemberHandler habitmember.Handler
-	DB                 *sql.DB
-	Cfg                config.Config
-	middleware         middleware.Middleware
+	Logger              *log.Logger
+	userHandler         user.UserHandler
+	habitHandler        habit.HabitHandler
+	habitMemberHandler  habitmember.Handler
+	performanceHandler  performance.Handler
+	timerHandler        timer.Handler
+	postHandler         post.Handler
+	notificationHandler notification.Handler
+	realtimeHandler     realtime.Handler
+	passkeyHandler      passkey.Handler
+	identityHandler     identity.Handler
+	apitokenHandler     apitoken.Handler
+	sessionHandler      session.Handler
+	DB                  *sql.DB
+	keys                *auth.KeySet
+	Cfg                 config.Config
+	middleware          middleware.Middleware
 }
 
 func NewApplication(cfg config.Config) (*Application, error) {
@@ -47,42 +76,148 @@ func NewApplication(cfg config.Config) (*Application, error) {
 		return nil, err
 	}
 
+	appMailer, err := mailer.New(cfg.Mailer)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := loadKeys(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := loadSecretBox(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// live habit events
+	eventsBackend := realtime.NewMemoryBackend()
+	if cfg.EventsBackend == "postgres" {
+		eventsBackend = realtime.NewPostgresBackend(pgDB)
+	}
+	hub := realtime.NewHub(eventsBackend, logger)
+
 	// set up repositories
 	userRepo := user.NewPostgresRepository(pgDB)
 	habitRepo := habit.NewPostgresRepository(pgDB)
 	habitMemberRepo := habitmember.NewPostgresRepository(pgDB)
+	performanceRepo := performance.NewPostgresRepository(pgDB)
+	streakRepo := streak.NewPostgresRepository(pgDB)
+	timerRepo := timer.NewPostgresRepository(pgDB)
+	accessRepo := access.NewPostgresRepository(pgDB)
+	postRepo := post.NewPostgresRepository(pgDB)
+	notificationRepo := notification.NewPostgresRepository(pgDB)
+	passkeyRepo := passkey.NewPostgresRepository(pgDB)
+	identityRepo := identity.NewPostgresRepository(pgDB)
+	apitokenRepo := apitoken.NewPostgresRepository(pgDB)
+	sessionRepo := session.NewPostgresRepository(pgDB)
 
 	// setup services
-	userService := user.NewService(userRepo, cfg)
-	habitService := habit.NewHabitService(habitRepo)
-	habitMemberService := habitmember.NewService(habitMemberRepo)
+	notificationService := notification.NewService(notificationRepo)
+	streakService := streak.NewService(streakRepo, notificationService)
+	accessService := access.NewService(accessRepo, cfg)
+	sessionService := session.NewService(sessionRepo, cfg)
+	userService := user.NewService(userRepo, keys, secrets, &sessionService, appMailer, cfg)
+	habitService := habit.NewHabitService(habitRepo, streakService, accessService, notificationService, cfg)
+	habitMemberService := habitmember.NewService(habitMemberRepo, accessService, notificationService, hub, appMailer, cfg)
+	performanceService := performance.NewService(performanceRepo, streakService, accessService, hub)
+	timerService := timer.NewService(timerRepo, performanceService, accessService, notificationService, cfg)
+	postService := post.NewService(postRepo, accessService, notificationService, hub)
+	passkeyService := passkey.NewService(passkeyRepo, &userService, cfg)
+	identityService := identity.NewService(identityRepo, &userService, cfg)
+	apitokenService := apitoken.NewService(apitokenRepo)
 
 	// setup handlers
 	userHandler := user.NewHandler(userService, logger)
 	habitHandler := habit.NewHandler(habitService, logger)
 	habitMemberHandler := habitmember.NewHandler(habitMemberService, logger)
+	performanceHandler := performance.NewHandler(performanceService, logger)
+	timerHandler := timer.NewHandler(timerService, logger)
+	postHandler := post.NewHandler(postService, logger)
+	notificationHandler := notification.NewHandler(notificationService, logger)
+	realtimeHandler := realtime.NewHandler(hub, accessService, &sessionService, logger)
+	passkeyHandler := passkey.NewHandler(passkeyService, logger)
+	identityHandler := identity.NewHandler(identityService, logger)
+	apitokenHandler := apitoken.NewHandler(apitokenService, logger)
+	sessionHandler := session.NewHandler(sessionService, logger)
 
 	// setup middlewares
-	appMiddleware := middleware.NewMiddleware(logger, userRepo, cfg)
+	appMiddleware := middleware.NewMiddleware(logger, userRepo, keys, apitokenService, sessionService, cfg)
 
 	app := &Application{
-		Logger:             logger,
-		userHandler:        *userHandler,
-		habitHandler:       *habitHandler,
-		habitMemberHandler: *habitMemberHandler,
-		middleware:         *appMiddleware,
-		DB:                 pgDB,
-		Cfg:                cfg,
+		Logger:              logger,
+		userHandler:         *userHandler,
+		habitHandler:        *habitHandler,
+		habitMemberHandler:  *habitMemberHandler,
+		performanceHandler:  *performanceHandler,
+		timerHandler:        *timerHandler,
+		postHandler:         *postHandler,
+		notificationHandler: *notificationHandler,
+		realtimeHandler:     *realtimeHandler,
+		passkeyHandler:      *passkeyHandler,
+		identityHandler:     *identityHandler,
+		apitokenHandler:     *apitokenHandler,
+		sessionHandler:      *sessionHandler,
+		middleware:          *appMiddleware,
+		DB:                  pgDB,
+		keys:                keys,
+		Cfg:                 cfg,
 	}
 
+	// background jobs
+	go hub.Run(context.Background())
+	go timerService.RunAutoStop(context.Background(), time.Minute, logger)
+	go habitService.RunPurge(context.Background(), time.Hour, logger)
+	go streakService.RunAtRiskWarnings(context.Background(), 15*time.Minute, logger)
+
 	return app, nil
 }
 
 func (a *Application) testHandler(w http.ResponseWriter, r *http.Request) {
-	user := context.GetUser(r)
+	user := cx.GetUser(r)
 	response.WriteJSON(w, http.StatusOK, response.Envelope{"user": user})
 }
 
 func (a *Application) health(w http.ResponseWriter, r *http.Request) {
 	response.WriteJSON(w, http.StatusOK, response.Envelope{"status": "available"})
 }
+
+// jwks publishes the public keys access tokens can be verified with.
+func (a *Application) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"keys": a.keys.JWKS()})
+}
+
+// loadKeys loads the JWT keys from the configured files. Development setups
+// without a key file get a temporary key instead.
+func loadKeys(cfg config.Config, logger *log.Logger) (*auth.KeySet, error) {
+	if cfg.JWT.SigningKeyFile != "" {
+		return auth.LoadKeySet(cfg.JWT.SigningKeyFile, cfg.JWT.VerifyKeyFiles)
+	}
+	if !cfg.IsDevelopment() {
+		return nil, errors.New("JWT_SIGNING_KEY_FILE is required outside development")
+	}
+
+	logger.Println("JWT_SIGNING_KEY_FILE is not set, signing tokens with a temporary key")
+	return auth.NewEphemeralKeySet()
+}
+
+// loadSecretBox sets up the encryption of stored TOTP secrets. Development
+// setups without a key use a fixed one, which must never reach production.
+func loadSecretBox(cfg config.Config, logger *log.Logger) (*auth.SecretBox, error) {
+	if cfg.TwoFactor.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.TwoFactor.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("TOTP_ENCRYPTION_KEY: %w", err)
+		}
+		return auth.NewSecretBox(key)
+	}
+	if !cfg.IsDevelopment() {
+		return nil, errors.New("TOTP_ENCRYPTION_KEY is required outside development")
+	}
+
+	logger.Println("TOTP_ENCRYPTION_KEY is not set, using the development key")
+	key := sha256.Sum256([]byte("habits development totp key"))
+	return auth.NewSecretBox(key[:])
+}
@@ -1,14 +1,19 @@
 package server
 
-import "github.com/go-chi/chi/v5"
+import (
+	"github.com/NurulloMahmud/habits/internal/auth"
+	"github.com/go-chi/chi/v5"
+)
 
 func (app *Application) Routes() *chi.Mux {
 	r := chi.NewRouter()
+	scope := app.middleware.RequireScope
 
 	r.Use(app.middleware.RateLimit)
 
 	// test & health
 	r.Get("/health", app.health)
+	r.Get("/.well-known/jwks.json", app.jwks)
 
 	r.Group(func(r chi.Router) {
 		r.Use(app.middleware.Authenticate)
@@ -18,26 +23,153 @@ func (app *Application) Routes() *chi.Mux {
 		// register & login
 		r.Post("/api/v1/register", app.userHandler.Register)
 		r.Post("/api/v1/login", app.userHandler.Login)
+		r.Post("/api/v1/login/2fa", app.userHandler.LoginTwoFactor)
+		r.Post("/api/v1/login/2fa/enroll", app.userHandler.LoginEnroll)
+		r.Post("/api/v1/login/2fa/enroll/confirm", app.userHandler.LoginEnrollConfirm)
+		r.Post("/api/v1/login/passkey/begin", app.passkeyHandler.HandleBeginLogin)
+		r.Post("/api/v1/login/passkey/finish", app.passkeyHandler.HandleFinishLogin)
+		r.Get("/api/v1/login/oidc", app.identityHandler.HandleProviders)
+		r.Post("/api/v1/login/oidc/{provider}/begin", app.identityHandler.HandleBeginLogin)
+		r.Post("/api/v1/login/oidc/{provider}/callback", app.identityHandler.HandleFinishLogin)
+		r.Post("/api/v1/token/refresh", app.userHandler.Refresh)
+		r.Post("/api/v1/logout", app.userHandler.Logout)
+		r.Post("/api/v1/email/verify", app.userHandler.VerifyEmail)
+		r.Post("/api/v1/password/forgot", app.userHandler.ForgotPassword)
+		r.Post("/api/v1/password/reset", app.userHandler.ResetPassword)
 
 		// habits (public)
-		r.Get("/api/v1/habits", app.habitHandler.HandleGetHabitList)
+		r.With(scope(auth.ScopeHabitsRead)).Get("/api/v1/habits", app.habitHandler.HandleGetHabitList)
 
-		// valid user required endpoints
+		// account settings, login sessions only
 		r.Group(func(r chi.Router) {
 			r.Use(app.middleware.RequireUser)
+			r.Use(app.middleware.RequireSession)
 
 			// users endpoints
 			r.Patch("/api/v1/users", app.userHandler.Update)
+			r.Post("/api/v1/email/verify/resend", app.userHandler.ResendVerification)
+
+			// two-factor authentication
+			r.Post("/api/v1/me/2fa/enroll", app.userHandler.EnrollTwoFactor)
+			r.Post("/api/v1/me/2fa/confirm", app.userHandler.ConfirmTwoFactor)
+			r.Post("/api/v1/me/2fa/disable", app.userHandler.DisableTwoFactor)
+			r.Post("/api/v1/me/2fa/recovery-codes", app.userHandler.RegenerateRecoveryCodes)
+
+			// passkeys
+			r.Post("/api/v1/passkeys/register/begin", app.passkeyHandler.HandleBeginRegistration)
+			r.Post("/api/v1/passkeys/register/finish", app.passkeyHandler.HandleFinishRegistration)
+			r.Get("/api/v1/me/passkeys", app.passkeyHandler.HandleList)
+			r.Patch("/api/v1/me/passkeys/{passkeyID}", app.passkeyHandler.HandleRename)
+			r.Delete("/api/v1/me/passkeys/{passkeyID}", app.passkeyHandler.HandleDelete)
+
+			// linked sign in providers
+			r.Get("/api/v1/me/identities", app.identityHandler.HandleList)
+			r.Post("/api/v1/me/identities/{provider}/begin", app.identityHandler.HandleBeginLink)
+			r.Post("/api/v1/me/identities/{provider}/callback", app.identityHandler.HandleFinishLink)
+			r.Delete("/api/v1/me/identities/{identityID}", app.identityHandler.HandleUnlink)
+
+			// personal access tokens
+			r.Post("/api/v1/me/tokens", app.apitokenHandler.HandleCreate)
+			r.Get("/api/v1/me/tokens", app.apitokenHandler.HandleList)
+			r.Delete("/api/v1/me/tokens/{tokenID}", app.apitokenHandler.HandleRevoke)
+
+			// login sessions
+			r.Get("/api/v1/me/sessions", app.sessionHandler.HandleList)
+			r.Post("/api/v1/me/sessions/revoke-others", app.sessionHandler.HandleRevokeOthers)
+			r.Delete("/api/v1/me/sessions/{sessionID}", app.sessionHandler.HandleRevoke)
+		})
+
+		// valid user required endpoints, personal access tokens need the scope
+		r.Group(func(r chi.Router) {
+			r.Use(app.middleware.RequireUser)
 
 			// habits
-			r.Post("/api/v1/habits", app.habitHandler.HandleCreate)
-			r.Patch("/api/v1/habits/{id}", app.habitHandler.HandleUpdate)
-			r.Delete("/api/v1/habits/{id}", app.habitHandler.HandleDelete)
+			r.With(scope(auth.ScopeHabitsWrite)).Post("/api/v1/habits", app.habitHandler.HandleCreate)
+			r.With(scope(auth.ScopeHabitsWrite)).Patch("/api/v1/habits/{id}", app.habitHandler.HandleUpdate)
+			r.With(scope(auth.ScopeHabitsWrite)).Delete("/api/v1/habits/{id}", app.habitHandler.HandleDelete)
+			r.With(scope(auth.ScopeHabitsWrite)).Post("/api/v1/habits/{id}/archive", app.habitHandler.HandleArchive)
+			r.With(scope(auth.ScopeHabitsWrite)).Post("/api/v1/habits/{id}/restore", app.habitHandler.HandleRestore)
+
+			// habit ownership transfers
+			r.With(scope(auth.ScopeHabitsWrite)).Post("/api/v1/habits/{id}/transfers", app.habitHandler.HandleRequestTransfer)
+			r.With(scope(auth.ScopeHabitsRead)).Get("/api/v1/habits/{id}/transfers", app.habitHandler.HandleListTransfers)
+			r.With(scope(auth.ScopeHabitsWrite)).Post("/api/v1/habits/{id}/transfers/{transferID}/accept", app.habitHandler.HandleAcceptTransfer)
+			r.With(scope(auth.ScopeHabitsWrite)).Post("/api/v1/habits/{id}/transfers/{transferID}/decline", app.habitHandler.HandleDeclineTransfer)
+			r.With(scope(auth.ScopeHabitsWrite)).Delete("/api/v1/habits/{id}/transfers/{transferID}", app.habitHandler.HandleCancelTransfer)
 
 			// habit members endpoints
-			r.Post("/api/v1/join-habit", app.habitMemberHandler.HandleJoinHabit)
+			r.With(scope(auth.ScopeMembersWrite)).Post("/api/v1/join-habit", app.habitMemberHandler.HandleJoinHabit)
+			r.With(scope(auth.ScopeMembersRead)).Get("/api/v1/habits/{id}/join-requests", app.habitMemberHandler.HandleListJoinRequests)
+			r.With(scope(auth.ScopeMembersWrite)).Post("/api/v1/habits/{id}/join-requests/{requestID}/approve", app.habitMemberHandler.HandleApproveJoinRequest)
+			r.With(scope(auth.ScopeMembersWrite)).Post("/api/v1/habits/{id}/join-requests/{requestID}/reject", app.habitMemberHandler.HandleRejectJoinRequest)
+			r.With(scope(auth.ScopeHabitsRead)).Get("/api/v1/me/habits", app.habitMemberHandler.HandleGetMyHabits)
+			r.With(scope(auth.ScopeMembersRead)).Get("/api/v1/me/join-requests", app.habitMemberHandler.HandleMyJoinRequests)
+			r.With(scope(auth.ScopeMembersWrite)).Delete("/api/v1/me/join-requests/{requestID}", app.habitMemberHandler.HandleCancelJoinRequest)
+
+			// notification inbox
+			r.With(scope(auth.ScopeNotificationsRead)).Get("/api/v1/me/notifications", app.notificationHandler.HandleList)
+			r.With(scope(auth.ScopeNotificationsRead)).Get("/api/v1/me/notifications/unread-count", app.notificationHandler.HandleUnreadCount)
+			r.With(scope(auth.ScopeNotificationsWrite)).Post("/api/v1/me/notifications/read-all", app.notificationHandler.HandleMarkAllRead)
+			r.With(scope(auth.ScopeNotificationsWrite)).Post("/api/v1/me/notifications/{notificationID}/read", app.notificationHandler.HandleMarkRead)
+
+			// habit membership
+			r.With(scope(auth.ScopeMembersRead)).Get("/api/v1/habits/{id}/members", app.habitMemberHandler.HandleListMembers)
+			r.With(scope(auth.ScopeMembersWrite)).Delete("/api/v1/habits/{id}/members/me", app.habitMemberHandler.HandleLeaveHabit)
+			r.With(scope(auth.ScopeMembersWrite)).Delete("/api/v1/habits/{id}/members/{userID}", app.habitMemberHandler.HandleRevokeMember)
+			r.With(scope(auth.ScopeMembersWrite)).Put("/api/v1/habits/{id}/members/{userID}/role", app.habitMemberHandler.HandleUpdateMemberRole)
+
+			// habit invites
+			r.With(scope(auth.ScopeMembersWrite)).Post("/api/v1/habits/{id}/invites", app.habitMemberHandler.HandleCreateInvite)
+			r.With(scope(auth.ScopeMembersWrite)).Post("/api/v1/invites/accept", app.habitMemberHandler.HandleAcceptInvite)
+
+			// habit check-ins
+			r.With(scope(auth.ScopeCheckinsWrite)).Post("/api/v1/habits/{id}/checkins", app.performanceHandler.HandleCreateCheckin)
+			r.With(scope(auth.ScopeCheckinsRead)).Get("/api/v1/habits/{id}/checkins", app.performanceHandler.HandleListCheckins)
+
+			// timer sessions for duration habits
+			r.With(scope(auth.ScopeCheckinsWrite)).Post("/api/v1/habits/{id}/sessions", app.timerHandler.HandleStart)
+			r.With(scope(auth.ScopeCheckinsRead)).Get("/api/v1/habits/{id}/sessions/current", app.timerHandler.HandleCurrent)
+			r.With(scope(auth.ScopeCheckinsWrite)).Post("/api/v1/habits/{id}/sessions/{sessionID}/pause", app.timerHandler.HandlePause)
+			r.With(scope(auth.ScopeCheckinsWrite)).Post("/api/v1/habits/{id}/sessions/{sessionID}/resume", app.timerHandler.HandleResume)
+			r.With(scope(auth.ScopeCheckinsWrite)).Post("/api/v1/habits/{id}/sessions/{sessionID}/stop", app.timerHandler.HandleStop)
+			r.With(scope(auth.ScopeCheckinsWrite)).Delete("/api/v1/habits/{id}/sessions/{sessionID}", app.timerHandler.HandleDiscard)
+
+			// habit posts feed
+			r.With(scope(auth.ScopePostsRead)).Get("/api/v1/habits/{id}/posts", app.postHandler.HandleList)
+			r.With(scope(auth.ScopePostsWrite)).Post("/api/v1/habits/{id}/posts", app.postHandler.HandleCreate)
+			r.With(scope(auth.ScopePostsWrite)).Patch("/api/v1/habits/{id}/posts/{postID}", app.postHandler.HandleUpdate)
+			r.With(scope(auth.ScopePostsWrite)).Delete("/api/v1/habits/{id}/posts/{postID}", app.postHandler.HandleDelete)
+			r.With(scope(auth.ScopePostsWrite)).Put("/api/v1/habits/{id}/posts/{postID}/reactions/{reaction}", app.postHandler.HandleReact)
+			r.With(scope(auth.ScopePostsWrite)).Delete("/api/v1/habits/{id}/posts/{postID}/reactions/{reaction}", app.postHandler.HandleUnreact)
+
+			// post comments
+			r.With(scope(auth.ScopePostsRead)).Get("/api/v1/habits/{id}/posts/{postID}/comments", app.postHandler.HandleListComments)
+			r.With(scope(auth.ScopePostsWrite), app.middleware.UserRateLimit(app.Cfg.CommentLimiter)).
+				Post("/api/v1/habits/{id}/posts/{postID}/comments", app.postHandler.HandleCreateComment)
+			r.With(scope(auth.ScopePostsWrite)).Delete("/api/v1/habits/{id}/posts/{postID}/comments/{commentID}", app.postHandler.HandleDeleteComment)
+		})
+
+		// admin only endpoints
+		r.Group(func(r chi.Router) {
+			r.Use(app.middleware.RequireAdminUser)
+			r.Use(app.middleware.RequireSession)
+
+			r.Get("/api/v1/admin/habits/archived", app.habitHandler.HandleListArchived)
+			r.Post("/api/v1/admin/habits/{id}/transfer", app.habitHandler.HandleForceTransfer)
+			r.Get("/api/v1/admin/role-policies", app.userHandler.ListRolePolicies)
+			r.Put("/api/v1/admin/role-policies/{role}", app.userHandler.SetRolePolicy)
 		})
 	})
 
+	// live habit updates, EventSource clients pass the token in the query
+	r.Group(func(r chi.Router) {
+		r.Use(app.middleware.QueryToken)
+		r.Use(app.middleware.Authenticate)
+		r.Use(app.middleware.ActivityLogger)
+		r.Use(app.middleware.RequireUser)
+
+		r.With(scope(auth.ScopeHabitsRead)).Get("/api/v1/habits/{id}/events", app.realtimeHandler.HandleEvents)
+	})
+
 	return r
 }
@@ -0,0 +1,60 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the cache, expired entries are swept once it is
+// reached.
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	active    bool
+	expiresAt time.Time
+}
+
+// cache remembers for a short while whether a session is active, so
+// authenticating a request rarely needs the database.
+type cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[int64]cacheEntry
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{ttl: ttl, entries: map[int64]cacheEntry{}}
+}
+
+func (c *cache) get(id int64) (active, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.active, true
+}
+
+func (c *cache) set(id int64, active bool) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		for key, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		return
+	}
+	c.entries[id] = cacheEntry{active: active, expiresAt: now.Add(c.ttl)}
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	data, err := h.service.list(r.Context(), *user)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := utils.ReadInt64Param(r, "sessionID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	if err = h.service.revoke(r.Context(), *user, sessionID); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "session signed out"})
+}
+
+func (h *Handler) HandleRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r)
+	count, err := h.service.revokeOthers(r.Context(), *user)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"revoked": count})
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errNoSessionFound, errNoSession:
+		response.BadRequest(w, r, err, h.logger)
+	default:
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
@@ -0,0 +1,187 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Repository interface {
+	create(ctx context.Context, s Session) (*Session, error)
+	get(ctx context.Context, id int64) (*Session, error)
+	listActive(ctx context.Context, userID int64) ([]*Session, error)
+	touch(ctx context.Context, id int64) (bool, error)
+	revoke(ctx context.Context, id int64) error
+	revokeOthers(ctx context.Context, userID, keepID int64) ([]int64, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const sessionColumns = `
+	id,
+	user_id,
+	ip,
+	user_agent,
+	device,
+	last_seen_at,
+	created_at`
+
+func scanSession(row interface{ Scan(...any) error }, s *Session) error {
+	return row.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.IP,
+		&s.UserAgent,
+		&s.Device,
+		&s.LastSeenAt,
+		&s.CreatedAt,
+	)
+}
+
+func (r *postgresRepository) create(ctx context.Context, s Session) (*Session, error) {
+	query := `
+	INSERT INTO sessions (user_id, ip, user_agent, device)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, last_seen_at, created_at`
+
+	err := r.db.QueryRowContext(ctx, query, s.UserID, s.IP, s.UserAgent, s.Device).Scan(&s.ID, &s.LastSeenAt, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// get returns an active session.
+func (r *postgresRepository) get(ctx context.Context, id int64) (*Session, error) {
+	var s Session
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1 AND revoked_at IS NULL`
+
+	err := scanSession(r.db.QueryRowContext(ctx, query, id), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *postgresRepository) listActive(ctx context.Context, userID int64) ([]*Session, error) {
+	query := `
+	SELECT ` + sessionColumns + `
+	FROM sessions
+	WHERE user_id = $1 AND revoked_at IS NULL
+	ORDER BY last_seen_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var s Session
+		if err = scanSession(rows, &s); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// touch bumps last_seen_at of an active session and reports whether it is
+// still active.
+func (r *postgresRepository) touch(ctx context.Context, id int64) (bool, error) {
+	query := `
+	UPDATE sessions
+	SET last_seen_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND revoked_at IS NULL`
+
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// revoke ends the session together with its refresh tokens.
+func (r *postgresRepository) revoke(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE session_id = $1 AND revoked_at IS NULL`
+
+	if _, err = tx.ExecContext(ctx, query, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeOthers ends every session of the user but keepID and returns the ids
+// of the revoked sessions.
+func (r *postgresRepository) revokeOthers(ctx context.Context, userID, keepID int64) ([]int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE sessions
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	RETURNING id`
+
+	rows, err := tx.QueryContext(ctx, query, userID, keepID)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// refresh tokens from before sessions were recorded have no session and
+	// are revoked as well
+	query = `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND (session_id IS NULL OR session_id <> $2) AND revoked_at IS NULL`
+
+	if _, err = tx.ExecContext(ctx, query, userID, keepID); err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit()
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NurulloMahmud/habits/config"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+var (
+	errNoSessionFound = errors.New("No active session found with given id")
+	errNoSession      = errors.New("This login has no session, log in again to manage sessions")
+)
+
+type Service struct {
+	repo  Repository
+	cache *cache
+}
+
+func NewService(repo Repository, cfg config.Config) Service {
+	return Service{
+		repo:  repo,
+		cache: newCache(cfg.SessionCacheTTL),
+	}
+}
+
+// Start records a new login of the user, from the client stored in ctx.
+func (s *Service) Start(ctx context.Context, userID int64) (int64, error) {
+	client := cx.GetClient(ctx)
+	session, err := s.repo.create(ctx, Session{
+		UserID:    userID,
+		IP:        truncate(client.IP, 45),
+		UserAgent: truncate(client.UserAgent, 512),
+		Device:    deviceLabel(client.UserAgent),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.cache.set(session.ID, true)
+	return session.ID, nil
+}
+
+// Active reports whether the session was not revoked. Answers are cached,
+// so a session revoked on another instance keeps working for up to the
+// cache TTL. Cache misses also bump the session's last seen time.
+func (s *Service) Active(ctx context.Context, id int64) (bool, error) {
+	if active, ok := s.cache.get(id); ok {
+		return active, nil
+	}
+
+	active, err := s.repo.touch(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	s.cache.set(id, active)
+	return active, nil
+}
+
+func (s *Service) list(ctx context.Context, u cx.User) ([]*Session, error) {
+	sessions, err := s.repo.listActive(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == u.SessionID
+	}
+	return sessions, nil
+}
+
+func (s *Service) revoke(ctx context.Context, u cx.User, id int64) error {
+	session, err := s.repo.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != u.ID {
+		return errNoSessionFound
+	}
+
+	if err = s.repo.revoke(ctx, id); err != nil {
+		return err
+	}
+
+	s.cache.set(id, false)
+	return nil
+}
+
+// revokeOthers signs the user out everywhere but the current session.
+func (s *Service) revokeOthers(ctx context.Context, u cx.User) (int, error) {
+	if u.SessionID == 0 {
+		return 0, errNoSession
+	}
+
+	ids, err := s.repo.revokeOthers(ctx, u.ID, u.SessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		s.cache.set(id, false)
+	}
+	return len(ids), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
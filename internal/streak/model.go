@@ -0,0 +1,90 @@
+package streak
+
+import (
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/schedule"
+)
+
+// Streak is the materialized streak state of a member in a habit, counted in
+// schedule periods. LastMetDate is the first day of the last met period and
+// Current is stored as of that period, call Resolve to get today's values.
+type Streak struct {
+	HabitID     int64      `json:"-"`
+	UserID      int64      `json:"-"`
+	Current     int64      `json:"current_streak"`
+	Longest     int64      `json:"longest_streak"`
+	AtRisk      bool       `json:"at_risk_today"`
+	LastMetDate *time.Time `json:"last_met_date"`
+}
+
+// Resolve adjusts the stored values to the given day. A streak whose last met
+// period is before the previous one is broken, one met in the previous period
+// but not yet in the current one is at risk. Days outside a weekdays schedule
+// are not due, so they never put a streak at risk.
+func (s *Streak) Resolve(today time.Time, sched schedule.Schedule, start time.Time) {
+	s.AtRisk = false
+	if s.LastMetDate == nil {
+		s.Current = 0
+		return
+	}
+
+	current, scheduled := sched.Period(today, start)
+	if !scheduled {
+		if s.LastMetDate.Before(sched.Previous(today)) {
+			s.Current = 0
+		}
+		return
+	}
+
+	previous := sched.Previous(current)
+	switch {
+	case s.LastMetDate.Before(previous):
+		s.Current = 0
+	case s.LastMetDate.Equal(previous):
+		s.AtRisk = s.Current > 0
+	}
+}
+
+// compute builds streak values from an ascending list of met periods.
+func compute(periods []time.Time, sched schedule.Schedule) (current, longest int64, lastMet *time.Time) {
+	for i, period := range periods {
+		if i > 0 && periods[i-1].Equal(sched.Previous(period)) {
+			current++
+		} else {
+			current = 1
+		}
+		if current > longest {
+			longest = current
+		}
+		lastMet = &periods[i]
+	}
+	return current, longest, lastMet
+}
+
+// metPeriods groups ascending met days into periods and keeps the ones that
+// reached the schedule's required number of days.
+func metPeriods(days []time.Time, sched schedule.Schedule, start time.Time) []time.Time {
+	var (
+		result  []time.Time
+		current time.Time
+		count   int
+	)
+
+	for _, day := range days {
+		period, ok := sched.Period(day, start)
+		if !ok {
+			continue
+		}
+		if !period.Equal(current) {
+			current = period
+			count = 0
+		}
+
+		count++
+		if count == sched.Required() {
+			result = append(result, period)
+		}
+	}
+	return result
+}
@@ -0,0 +1,241 @@
+package streak
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/schedule"
+)
+
+type habitSchedule struct {
+	schedule  schedule.Schedule
+	startDate time.Time
+}
+
+// memberStreak is a running streak with what is needed to check it against
+// the member's local day.
+type memberStreak struct {
+	Streak
+	habitName string
+	schedule  schedule.Schedule
+	startDate time.Time
+	endDate   time.Time
+	timezone  string
+}
+
+type Repository interface {
+	get(ctx context.Context, habitID, userID int64) (*Streak, error)
+	upsert(ctx context.Context, s Streak) error
+	record(ctx context.Context, habitID, userID int64, period, previous time.Time) (bool, error)
+	getHabitSchedule(ctx context.Context, habitID int64) (*habitSchedule, error)
+	metDates(ctx context.Context, habitID, userID int64, from, to *time.Time) ([]time.Time, error)
+	habitMembers(ctx context.Context, habitID int64) ([]int64, error)
+	activeStreaks(ctx context.Context) ([]*memberStreak, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) get(ctx context.Context, habitID, userID int64) (*Streak, error) {
+	s := Streak{HabitID: habitID, UserID: userID}
+
+	query := `
+	SELECT current_streak, longest_streak, last_met_date
+	FROM habit_streaks
+	WHERE habit_id = $1 AND user_id = $2`
+
+	err := r.db.QueryRowContext(ctx, query, habitID, userID).Scan(
+		&s.Current,
+		&s.Longest,
+		&s.LastMetDate,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *postgresRepository) upsert(ctx context.Context, s Streak) error {
+	query := `
+	INSERT INTO habit_streaks (habit_id, user_id, current_streak, longest_streak, last_met_date, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (habit_id, user_id) DO UPDATE
+	SET current_streak = EXCLUDED.current_streak,
+		longest_streak = EXCLUDED.longest_streak,
+		last_met_date = EXCLUDED.last_met_date,
+		updated_at = EXCLUDED.updated_at`
+
+	_, err := r.db.ExecContext(
+		ctx, query,
+		s.HabitID,
+		s.UserID,
+		s.Current,
+		s.Longest,
+		s.LastMetDate,
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// record marks period as met in a single statement, so concurrent check-ins
+// cannot both read the same streak and overwrite each other. The streak grows
+// when previous was the last met period and restarts otherwise. It reports
+// false and changes nothing when period is not after the last met period.
+func (r *postgresRepository) record(ctx context.Context, habitID, userID int64, period, previous time.Time) (bool, error) {
+	query := `
+	INSERT INTO habit_streaks (habit_id, user_id, current_streak, longest_streak, last_met_date, updated_at)
+	VALUES ($1, $2, 1, 1, $3, $5)
+	ON CONFLICT (habit_id, user_id) DO UPDATE
+	SET current_streak = CASE WHEN habit_streaks.last_met_date = $4 THEN habit_streaks.current_streak + 1 ELSE 1 END,
+		longest_streak = GREATEST(
+			habit_streaks.longest_streak,
+			CASE WHEN habit_streaks.last_met_date = $4 THEN habit_streaks.current_streak + 1 ELSE 1 END
+		),
+		last_met_date = EXCLUDED.last_met_date,
+		updated_at = EXCLUDED.updated_at
+	WHERE habit_streaks.last_met_date IS NULL OR habit_streaks.last_met_date < EXCLUDED.last_met_date`
+
+	res, err := r.db.ExecContext(ctx, query, habitID, userID, period, previous, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *postgresRepository) getHabitSchedule(ctx context.Context, habitID int64) (*habitSchedule, error) {
+	var h habitSchedule
+
+	query := `SELECT schedule, start_date FROM habits WHERE id = $1`
+	err := r.db.QueryRowContext(ctx, query, habitID).Scan(&h.schedule, &h.startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+// metDates returns the days on which a member reached the habit's daily target.
+func (r *postgresRepository) metDates(ctx context.Context, habitID, userID int64, from, to *time.Time) ([]time.Time, error) {
+	var result []time.Time
+
+	query := `
+	SELECT p.date
+	FROM habit_performance p
+	JOIN habits h ON h.id = p.habit_id
+	WHERE
+		p.habit_id = $1 AND
+		p.user_id = $2 AND
+		(p.date >= $3 OR $3 IS NULL) AND
+		(p.date <= $4 OR $4 IS NULL)
+	GROUP BY p.date, h.daily_count, h.daily_duration
+	HAVING
+		(h.daily_count IS NOT NULL AND COALESCE(SUM(p.quantity), 0) >= h.daily_count) OR
+		(h.daily_duration IS NOT NULL AND COALESCE(SUM(p.duration), INTERVAL '0') >= h.daily_duration * INTERVAL '1 minute')
+	ORDER BY p.date`
+
+	rows, err := r.db.QueryContext(ctx, query, habitID, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date time.Time
+		if err = rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		result = append(result, date)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *postgresRepository) habitMembers(ctx context.Context, habitID int64) ([]int64, error) {
+	var result []int64
+
+	query := `SELECT user_id FROM habit_members WHERE habit_id = $1`
+	rows, err := r.db.QueryContext(ctx, query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		if err = rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		result = append(result, userID)
+	}
+
+	return result, rows.Err()
+}
+
+// activeStreaks returns running streaks of current members in live habits.
+func (r *postgresRepository) activeStreaks(ctx context.Context) ([]*memberStreak, error) {
+	var result []*memberStreak
+
+	query := `
+	SELECT
+		s.habit_id,
+		s.user_id,
+		s.current_streak,
+		s.longest_streak,
+		s.last_met_date,
+		h.name,
+		h.schedule,
+		h.start_date,
+		h.end_date,
+		u.timezone
+	FROM habit_streaks s
+	JOIN habits h ON h.id = s.habit_id
+	JOIN habit_members hm ON hm.habit_id = s.habit_id AND hm.user_id = s.user_id
+	JOIN users u ON u.id = s.user_id
+	WHERE
+		s.current_streak > 0 AND
+		h.archived_at IS NULL AND
+		h.deleted_at IS NULL`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m memberStreak
+		err = rows.Scan(
+			&m.HabitID,
+			&m.UserID,
+			&m.Current,
+			&m.Longest,
+			&m.LastMetDate,
+			&m.habitName,
+			&m.schedule,
+			&m.startDate,
+			&m.endDate,
+			&m.timezone,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &m)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,168 @@
+package streak
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/notification"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+// warnFromHour is the local hour from which members get a warning about a
+// streak that breaks at the end of the day.
+const warnFromHour = 18
+
+type Service struct {
+	repo          Repository
+	notifications notification.Service
+}
+
+func NewService(repo Repository, notifications notification.Service) Service {
+	return Service{
+		repo:          repo,
+		notifications: notifications,
+	}
+}
+
+// Record updates the member's streak after a check-in on the given day.
+// Check-ins in the latest met period or later are applied incrementally with
+// an atomic upsert, a back-filled period rebuilds the streak from history.
+func (s *Service) Record(ctx context.Context, habitID, userID int64, date time.Time) error {
+	habit, err := s.repo.getHabitSchedule(ctx, habitID)
+	if err != nil {
+		return err
+	}
+
+	period, scheduled := habit.schedule.Period(date, habit.startDate)
+	if !scheduled {
+		return nil
+	}
+
+	end := habit.schedule.End(period)
+	days, err := s.repo.metDates(ctx, habitID, userID, &period, &end)
+	if err != nil {
+		return err
+	}
+	if len(metPeriods(days, habit.schedule, habit.startDate)) == 0 {
+		return nil
+	}
+
+	applied, err := s.repo.record(ctx, habitID, userID, period, habit.schedule.Previous(period))
+	if err != nil || applied {
+		return err
+	}
+
+	// the period was already met or lies before the last met one
+	st, err := s.repo.get(ctx, habitID, userID)
+	if err != nil {
+		return err
+	}
+	if st != nil && st.LastMetDate != nil && st.LastMetDate.After(period) {
+		return s.Rebuild(ctx, habitID, userID)
+	}
+	return nil
+}
+
+// Rebuild recomputes the member's streak from the full check-in history.
+func (s *Service) Rebuild(ctx context.Context, habitID, userID int64) error {
+	habit, err := s.repo.getHabitSchedule(ctx, habitID)
+	if err != nil {
+		return err
+	}
+
+	days, err := s.repo.metDates(ctx, habitID, userID, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	periods := metPeriods(days, habit.schedule, habit.startDate)
+	current, longest, lastMet := compute(periods, habit.schedule)
+	return s.repo.upsert(ctx, Streak{
+		HabitID:     habitID,
+		UserID:      userID,
+		Current:     current,
+		Longest:     longest,
+		LastMetDate: lastMet,
+	})
+}
+
+// RebuildHabit recomputes streaks of every member, used when the habit's
+// daily target or schedule changes.
+func (s *Service) RebuildHabit(ctx context.Context, habitID int64) error {
+	members, err := s.repo.habitMembers(ctx, habitID)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range members {
+		if err = s.Rebuild(ctx, habitID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WarnAtRisk notifies members whose streak breaks at the end of their local
+// day unless they check in. Each period is warned about once.
+func (s *Service) WarnAtRisk(ctx context.Context, now time.Time) (int, error) {
+	streaks, err := s.repo.activeStreaks(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	warned := 0
+	for _, st := range streaks {
+		loc, err := utils.LoadLocation(st.timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		if now.In(loc).Hour() < warnFromHour {
+			continue
+		}
+
+		today := utils.DateIn(now, loc)
+		if today.Before(st.startDate) || today.After(st.endDate) {
+			continue
+		}
+
+		st.Resolve(today, st.schedule, st.startDate)
+		period, _ := st.schedule.Period(today, st.startDate)
+		if !st.AtRisk || !st.schedule.End(period).Equal(today) {
+			continue
+		}
+
+		habitID := st.HabitID
+		key := fmt.Sprintf("streak_at_risk:%d:%s", habitID, period.Format(time.DateOnly))
+		err = s.notifications.NotifyOnce(ctx, st.UserID, notification.TypeStreakAtRisk, key, notification.Payload{
+			HabitID:   &habitID,
+			HabitName: st.habitName,
+			Streak:    st.Current,
+			PeriodEnd: &today,
+		})
+		if err != nil {
+			return warned, err
+		}
+		warned++
+	}
+
+	return warned, nil
+}
+
+// RunAtRiskWarnings calls WarnAtRisk every interval until ctx is cancelled.
+func (s *Service) RunAtRiskWarnings(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := s.WarnAtRisk(ctx, now.UTC()); err != nil {
+				logger.Printf("[ERROR] streak warnings: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package timer
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/performance"
+	"github.com/NurulloMahmud/habits/pkg/context"
+	"github.com/NurulloMahmud/habits/pkg/response"
+	"github.com/NurulloMahmud/habits/pkg/utils"
+)
+
+type Handler struct {
+	service Service
+	logger  *log.Logger
+}
+
+func NewHandler(s Service, log *log.Logger) *Handler {
+	return &Handler{
+		service: s,
+		logger:  log,
+	}
+}
+
+func (h *Handler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.start(r.Context(), *user, habitID, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleCurrent(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.current(r.Context(), *user, habitID, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandlePause(w http.ResponseWriter, r *http.Request) {
+	habitID, sessionID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.pause(r.Context(), *user, habitID, sessionID, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleResume(w http.ResponseWriter, r *http.Request) {
+	habitID, sessionID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	data, err := h.service.resume(r.Context(), *user, habitID, sessionID, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *Handler) HandleStop(w http.ResponseWriter, r *http.Request) {
+	habitID, sessionID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	data, checkin, err := h.service.stop(r.Context(), *user, habitID, sessionID, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data, "checkin": checkin})
+}
+
+func (h *Handler) HandleDiscard(w http.ResponseWriter, r *http.Request) {
+	habitID, sessionID, ok := h.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.GetUser(r)
+	err := h.service.discard(r.Context(), *user, habitID, sessionID, h.logger)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "timer session discarded"})
+}
+
+func (h *Handler) readParams(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return 0, 0, false
+	}
+	sessionID, err := utils.ReadInt64Param(r, "sessionID")
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return 0, 0, false
+	}
+	return habitID, sessionID, true
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errNoHabitFound, errNotDurationHabit, errSessionOpen, errNoSession, errNotRunning, errNotPaused, errSessionClosed:
+		response.BadRequest(w, r, err, h.logger)
+	default:
+		if access.IsForbidden(err) {
+			response.Forbidden(w, r, err.Error())
+			return
+		}
+		if performance.IsClientError(err) {
+			response.BadRequest(w, r, err, h.logger)
+			return
+		}
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
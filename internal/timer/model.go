@@ -0,0 +1,58 @@
+package timer
+
+import "time"
+
+const (
+	statusRunning   = "running"
+	statusPaused    = "paused"
+	statusStopped   = "stopped"
+	statusDiscarded = "discarded"
+)
+
+// Session is a server side timer for a duration habit. Time is accumulated
+// per running segment: AccumulatedSeconds holds finished segments and
+// ResumedAt marks the start of the current one while the timer is running.
+type Session struct {
+	ID                 int64      `json:"id"`
+	HabitID            int64      `json:"habit_id"`
+	UserID             int64      `json:"user_id"`
+	Status             string     `json:"status"`
+	StartedAt          time.Time  `json:"started_at"`
+	ResumedAt          *time.Time `json:"resumed_at"`
+	AccumulatedSeconds int64      `json:"accumulated_seconds"`
+	ElapsedSeconds     int64      `json:"elapsed_seconds"`
+	StoppedAt          *time.Time `json:"stopped_at,omitempty"`
+	AutoStopped        bool       `json:"auto_stopped"`
+	CheckinID          *int64     `json:"checkin_id,omitempty"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+func (s *Session) isOpen() bool {
+	return s.Status == statusRunning || s.Status == statusPaused
+}
+
+// elapsed returns the total timed duration as of now.
+func (s *Session) elapsed(now time.Time) time.Duration {
+	total := time.Duration(s.AccumulatedSeconds) * time.Second
+	if s.Status == statusRunning && s.ResumedAt != nil {
+		total += now.Sub(*s.ResumedAt)
+	}
+	return total
+}
+
+// expired reports whether the session is due to be stopped automatically,
+// because it ran for max or sat paused for as long.
+func (s *Session) expired(now time.Time, max time.Duration) bool {
+	switch s.Status {
+	case statusRunning:
+		return s.elapsed(now) >= max
+	case statusPaused:
+		return now.Sub(s.UpdatedAt) >= max
+	}
+	return false
+}
+
+type timerHabit struct {
+	ID            int64
+	DailyDuration *int64
+}
@@ -0,0 +1,191 @@
+package timer
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Repository interface {
+	create(ctx context.Context, s Session) (*Session, error)
+	get(ctx context.Context, id int64) (*Session, error)
+	getOpen(ctx context.Context, habitID, userID int64) (*Session, error)
+	update(ctx context.Context, s Session, from string) (bool, error)
+	getHabit(ctx context.Context, habitID int64) (*timerHabit, error)
+	listExpired(ctx context.Context, maxDuration time.Duration, now time.Time) ([]*Session, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const sessionColumns = `
+	id,
+	habit_id,
+	user_id,
+	status,
+	started_at,
+	resumed_at,
+	accumulated_seconds,
+	stopped_at,
+	auto_stopped,
+	checkin_id,
+	updated_at`
+
+func scanSession(row interface{ Scan(...any) error }, s *Session) error {
+	return row.Scan(
+		&s.ID,
+		&s.HabitID,
+		&s.UserID,
+		&s.Status,
+		&s.StartedAt,
+		&s.ResumedAt,
+		&s.AccumulatedSeconds,
+		&s.StoppedAt,
+		&s.AutoStopped,
+		&s.CheckinID,
+		&s.UpdatedAt,
+	)
+}
+
+// create returns nil when the member already has an open session for the
+// habit, the unique index allows only one.
+func (r *postgresRepository) create(ctx context.Context, s Session) (*Session, error) {
+	query := `
+	INSERT INTO habit_timer_sessions (habit_id, user_id, status, started_at, resumed_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT DO NOTHING
+	RETURNING id`
+
+	err := r.db.QueryRowContext(
+		ctx, query,
+		s.HabitID,
+		s.UserID,
+		s.Status,
+		s.StartedAt,
+		s.ResumedAt,
+		s.UpdatedAt,
+	).Scan(&s.ID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *postgresRepository) get(ctx context.Context, id int64) (*Session, error) {
+	var s Session
+
+	query := `SELECT ` + sessionColumns + ` FROM habit_timer_sessions WHERE id = $1`
+	err := scanSession(r.db.QueryRowContext(ctx, query, id), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *postgresRepository) getOpen(ctx context.Context, habitID, userID int64) (*Session, error) {
+	var s Session
+
+	query := `
+	SELECT ` + sessionColumns + `
+	FROM habit_timer_sessions
+	WHERE habit_id = $1 AND user_id = $2 AND status IN ('running', 'paused')`
+
+	err := scanSession(r.db.QueryRowContext(ctx, query, habitID, userID), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// update writes s if the session still has status from. It reports false
+// when another request changed the session first, so two devices cannot both
+// pause or stop it.
+func (r *postgresRepository) update(ctx context.Context, s Session, from string) (bool, error) {
+	query := `
+	UPDATE habit_timer_sessions
+	SET status = $1,
+		resumed_at = $2,
+		accumulated_seconds = $3,
+		stopped_at = $4,
+		auto_stopped = $5,
+		checkin_id = $6,
+		updated_at = $7
+	WHERE id = $8 AND status = $9`
+
+	res, err := r.db.ExecContext(
+		ctx, query,
+		s.Status,
+		s.ResumedAt,
+		s.AccumulatedSeconds,
+		s.StoppedAt,
+		s.AutoStopped,
+		s.CheckinID,
+		s.UpdatedAt,
+		s.ID,
+		from,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *postgresRepository) getHabit(ctx context.Context, habitID int64) (*timerHabit, error) {
+	var h timerHabit
+
+	query := `SELECT id, daily_duration FROM habits WHERE id = $1 AND archived_at IS NULL AND deleted_at IS NULL`
+	err := r.db.QueryRowContext(ctx, query, habitID).Scan(&h.ID, &h.DailyDuration)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+func (r *postgresRepository) listExpired(ctx context.Context, maxDuration time.Duration, now time.Time) ([]*Session, error) {
+	var result []*Session
+
+	query := `
+	SELECT ` + sessionColumns + `
+	FROM habit_timer_sessions
+	WHERE
+		(status = 'running' AND accumulated_seconds + EXTRACT(EPOCH FROM ($1 - resumed_at)) >= $2) OR
+		(status = 'paused' AND updated_at <= $3)`
+
+	rows, err := r.db.QueryContext(ctx, query, now, int64(maxDuration.Seconds()), now.Add(-maxDuration))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Session
+		if err = scanSession(rows, &s); err != nil {
+			return nil, err
+		}
+		result = append(result, &s)
+	}
+
+	return result, rows.Err()
+}
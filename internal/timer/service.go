@@ -0,0 +1,358 @@
+package timer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/access"
+	"github.com/NurulloMahmud/habits/internal/notification"
+	"github.com/NurulloMahmud/habits/internal/performance"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+var (
+	errNoHabitFound     = errors.New("No habit data found with given id")
+	errNotDurationHabit = errors.New("Timer sessions are only available for duration based habits")
+	errSessionOpen      = errors.New("You already have a running or paused session for this habit")
+	errNoSession        = errors.New("No timer session found with given id")
+	errNotRunning       = errors.New("Timer session is not running")
+	errNotPaused        = errors.New("Timer session is not paused")
+	errSessionClosed    = errors.New("Timer session is already stopped")
+)
+
+type Service struct {
+	repo          Repository
+	checkins      performance.Service
+	access        access.Service
+	notifications notification.Service
+	maxDuration   time.Duration
+}
+
+func NewService(repo Repository, checkins performance.Service, access access.Service, notifications notification.Service, cfg config.Config) Service {
+	return Service{
+		repo:          repo,
+		checkins:      checkins,
+		access:        access,
+		notifications: notifications,
+		maxDuration:   cfg.Timer.MaxDuration,
+	}
+}
+
+func (s *Service) start(ctx context.Context, user cx.User, habitID int64, logger *log.Logger) (*Session, error) {
+	habit, err := s.repo.getHabit(ctx, habitID)
+	if err != nil {
+		return nil, err
+	}
+	if habit == nil {
+		return nil, errNoHabitFound
+	}
+	if habit.DailyDuration == nil {
+		return nil, errNotDurationHabit
+	}
+
+	_, err = s.access.Require(ctx, user, habitID, access.CheckIn)
+	if err != nil {
+		return nil, err
+	}
+
+	open, err := s.openSession(ctx, user, habitID, logger)
+	if err != nil {
+		return nil, err
+	}
+	if open != nil {
+		return nil, errSessionOpen
+	}
+
+	now := time.Now().UTC()
+	session, err := s.repo.create(ctx, Session{
+		HabitID:   habitID,
+		UserID:    user.ID,
+		Status:    statusRunning,
+		StartedAt: now,
+		ResumedAt: &now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		// another device started one since the check above
+		return nil, errSessionOpen
+	}
+	return session, nil
+}
+
+func (s *Service) current(ctx context.Context, user cx.User, habitID int64, logger *log.Logger) (*Session, error) {
+	session, err := s.openSession(ctx, user, habitID, logger)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, errNoSession
+	}
+
+	session.ElapsedSeconds = int64(session.elapsed(time.Now().UTC()).Seconds())
+	return session, nil
+}
+
+func (s *Service) pause(ctx context.Context, user cx.User, habitID, sessionID int64, logger *log.Logger) (*Session, error) {
+	session, err := s.ownSession(ctx, user, habitID, sessionID, logger)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != statusRunning {
+		return nil, errNotRunning
+	}
+
+	now := time.Now().UTC()
+	session.AccumulatedSeconds = int64(session.elapsed(now).Seconds())
+	session.ElapsedSeconds = session.AccumulatedSeconds
+	session.Status = statusPaused
+	session.ResumedAt = nil
+	session.UpdatedAt = now
+
+	updated, err := s.repo.update(ctx, *session, statusRunning)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, errNotRunning
+	}
+	return session, nil
+}
+
+func (s *Service) resume(ctx context.Context, user cx.User, habitID, sessionID int64, logger *log.Logger) (*Session, error) {
+	session, err := s.ownSession(ctx, user, habitID, sessionID, logger)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != statusPaused {
+		return nil, errNotPaused
+	}
+
+	now := time.Now().UTC()
+	session.Status = statusRunning
+	session.ResumedAt = &now
+	session.ElapsedSeconds = session.AccumulatedSeconds
+	session.UpdatedAt = now
+
+	updated, err := s.repo.update(ctx, *session, statusPaused)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, errNotPaused
+	}
+	return session, nil
+}
+
+func (s *Service) stop(ctx context.Context, user cx.User, habitID, sessionID int64, logger *log.Logger) (*Session, *performance.Checkin, error) {
+	session, err := s.ownSession(ctx, user, habitID, sessionID, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checkin, err := s.finish(ctx, user, session, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return session, checkin, nil
+}
+
+// discard closes a session without writing a check-in.
+func (s *Service) discard(ctx context.Context, user cx.User, habitID, sessionID int64, logger *log.Logger) error {
+	session, err := s.ownSession(ctx, user, habitID, sessionID, logger)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	from := session.Status
+	session.Status = statusDiscarded
+	session.ResumedAt = nil
+	session.StoppedAt = &now
+	session.UpdatedAt = now
+
+	closed, err := s.repo.update(ctx, *session, from)
+	if err != nil {
+		return err
+	}
+	if !closed {
+		return errSessionClosed
+	}
+	return nil
+}
+
+// finish stops the session and writes the timed minutes into habit_performance.
+// The duration is capped at the configured maximum. The session is closed
+// first, so of two concurrent stops only one records the minutes, the other
+// gets errSessionClosed. When the check-in fails the session is reopened so
+// the stop can be retried.
+func (s *Service) finish(ctx context.Context, user cx.User, session *Session, logger *log.Logger) (*performance.Checkin, error) {
+	now := time.Now().UTC()
+	total := min(session.elapsed(now), s.maxDuration)
+	previous := *session
+
+	session.Status = statusStopped
+	session.AccumulatedSeconds = int64(total.Seconds())
+	session.ElapsedSeconds = session.AccumulatedSeconds
+	session.ResumedAt = nil
+	session.StoppedAt = &now
+	session.UpdatedAt = now
+
+	closed, err := s.repo.update(ctx, *session, previous.Status)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, errSessionClosed
+	}
+
+	minutes := int64(total.Minutes())
+	if minutes < 1 {
+		return nil, nil
+	}
+
+	checkin, err := s.checkins.RecordDuration(ctx, user, session.HabitID, minutes, session.StartedAt, logger)
+	if err != nil {
+		if _, reopenErr := s.repo.update(ctx, previous, statusStopped); reopenErr != nil {
+			return nil, errors.Join(err, reopenErr)
+		}
+		return nil, err
+	}
+
+	session.CheckinID = &checkin.ID
+	if _, err = s.repo.update(ctx, *session, statusStopped); err != nil {
+		return nil, err
+	}
+	return checkin, nil
+}
+
+// expire stops a session that ran or sat paused past the maximum duration.
+// Such a timer was most likely forgotten, so its time is not credited as a
+// check-in. The owner is notified instead and can log the real duration by
+// hand. A failed notification is logged, the session stays stopped.
+func (s *Service) expire(ctx context.Context, session *Session, logger *log.Logger) error {
+	now := time.Now().UTC()
+	previous := session.Status
+
+	session.Status = statusStopped
+	session.AccumulatedSeconds = int64(min(session.elapsed(now), s.maxDuration).Seconds())
+	session.ElapsedSeconds = session.AccumulatedSeconds
+	session.ResumedAt = nil
+	session.StoppedAt = &now
+	session.AutoStopped = true
+	session.UpdatedAt = now
+
+	closed, err := s.repo.update(ctx, *session, previous)
+	if err != nil {
+		return err
+	}
+	if !closed {
+		return errSessionClosed
+	}
+
+	habitID, sessionID := session.HabitID, session.ID
+	key := fmt.Sprintf("timer_auto_stopped:%d", sessionID)
+	err = s.notifications.NotifyOnce(ctx, session.UserID, notification.TypeTimerAutoStopped, key, notification.Payload{
+		HabitID:   &habitID,
+		SessionID: &sessionID,
+	})
+	if err != nil {
+		logger.Printf("[ERROR] timer auto-stop: session %d notification: %v\n", sessionID, err)
+	}
+	return nil
+}
+
+// ownSession loads an open session of the user, auto stopping it first when
+// it ran or sat paused past the maximum duration.
+func (s *Service) ownSession(ctx context.Context, user cx.User, habitID, sessionID int64, logger *log.Logger) (*Session, error) {
+	session, err := s.repo.get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.UserID != user.ID || session.HabitID != habitID {
+		return nil, errNoSession
+	}
+	if !session.isOpen() {
+		return nil, errSessionClosed
+	}
+
+	if session.expired(time.Now().UTC(), s.maxDuration) {
+		if err = s.expire(ctx, session, logger); err != nil {
+			return nil, err
+		}
+		return nil, errSessionClosed
+	}
+
+	return session, nil
+}
+
+func (s *Service) openSession(ctx context.Context, user cx.User, habitID int64, logger *log.Logger) (*Session, error) {
+	session, err := s.repo.getOpen(ctx, habitID, user.ID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	if session.expired(time.Now().UTC(), s.maxDuration) {
+		err = s.expire(ctx, session, logger)
+		if err != nil && !errors.Is(err, errSessionClosed) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	return session, nil
+}
+
+// AutoStop stops every session that ran or sat paused for the maximum
+// duration, without crediting its time. A session that fails to stop is
+// logged and retried on the next run, it does not hold up the others.
+func (s *Service) AutoStop(ctx context.Context, logger *log.Logger) (int, error) {
+	sessions, err := s.repo.listExpired(ctx, s.maxDuration, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	stopped := 0
+	for _, session := range sessions {
+		err = s.expire(ctx, session, logger)
+		switch {
+		case err == nil:
+			stopped++
+		case errors.Is(err, errSessionClosed):
+			// stopped by its owner in the meantime
+		default:
+			logger.Printf("[ERROR] timer auto-stop: session %d: %v\n", session.ID, err)
+		}
+	}
+
+	return stopped, nil
+}
+
+// RunAutoStop calls AutoStop every interval until ctx is cancelled.
+func (s *Service) RunAutoStop(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stopped, err := s.AutoStop(ctx, logger)
+			if err != nil {
+				logger.Printf("[ERROR] timer auto-stop: %v\n", err)
+				continue
+			}
+			if stopped > 0 {
+				logger.Printf("timer auto-stop: stopped %d session(s)\n", stopped)
+			}
+		}
+	}
+}
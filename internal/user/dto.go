@@ -4,6 +4,7 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/NurulloMahmud/habits/pkg/utils"
 )
@@ -17,6 +18,12 @@ var (
 	errPasswordsNotMatch          = errors.New("Passwords do not match")
 	errFirstNameEmpty             = errors.New("you can omit first_name but cannot send empty string or space")
 	errLastNameEmpty              = errors.New("you can omit last_name but cannot send empty string or space")
+	errInvalidTimezone            = errors.New("timezone must be a valid IANA time zone name, e.g. Asia/Tashkent")
+	errRefreshRequired            = errors.New("refresh_token is required")
+	errTokenRequired              = errors.New("token is required")
+	errChallengeRequired          = errors.New("challenge_token is required")
+	errCodeRequired               = errors.New("code or recovery_code is required")
+	errRequireTwoFactor           = errors.New("require_two_factor is required")
 )
 
 type registerUserRequest struct {
@@ -96,6 +103,7 @@ type updateUserRequest struct {
 	OldPassword        *string `json:"old_password"`
 	NewPassword        *string `json:"new_password"`
 	NewPasswordConfirm *string `json:"new_password_confirm"`
+	Timezone           *string `json:"timezone"`
 }
 
 func (r *updateUserRequest) validateUpdateUserRequest() error {
@@ -105,9 +113,27 @@ func (r *updateUserRequest) validateUpdateUserRequest() error {
 			return errEmailFormat
 		}
 	}
+	if r.Timezone != nil {
+		if _, err := utils.LoadLocation(*r.Timezone); err != nil {
+			return errInvalidTimezone
+		}
+	}
 	return nil
 }
 
+// requiresPassword reports whether the update must be confirmed with
+// old_password. Only changing the time zone alone is exempt, so clients can
+// follow the device's zone without asking for the password.
+func (r *updateUserRequest) requiresPassword() bool {
+	timezoneOnly := r.Timezone != nil &&
+		r.Email == nil &&
+		r.FirstName == nil &&
+		r.LastName == nil &&
+		r.NewPassword == nil &&
+		r.NewPasswordConfirm == nil
+	return !timezoneOnly
+}
+
 func (r *updateUserRequest) validatePasswordUpdate() error {
 	if r.OldPassword == nil {
 		return errPasswordRequired
@@ -135,3 +161,138 @@ func (u *ListUserInput) ValidateInput() error {
 	err := u.Filter.Validate()
 	return err
 }
+
+// TokenPair is what a successful login returns.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	// All is only used on logout, to sign out of every session.
+	All bool `json:"all"`
+}
+
+func (r *refreshRequest) validate() error {
+	if r.RefreshToken == "" {
+		return errRefreshRequired
+	}
+	return nil
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (r *verifyEmailRequest) validate() error {
+	if r.Token == "" {
+		return errTokenRequired
+	}
+	return nil
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (r *forgotPasswordRequest) validate() error {
+	return validateEmailFormat(r.Email)
+}
+
+type resetPasswordRequest struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	PasswordConfirm string `json:"password_confirm"`
+}
+
+func (r *resetPasswordRequest) validate() error {
+	if r.Token == "" {
+		return errTokenRequired
+	}
+	if r.Password == "" || r.PasswordConfirm == "" {
+		return errPasswordAndConfirmRequired
+	}
+	if len(r.Password) < 6 || len(r.Password) > 32 {
+		return errPasswordLen
+	}
+	if r.Password != r.PasswordConfirm {
+		return errPasswordsNotMatch
+	}
+	return nil
+}
+
+// LoginResult is either a token pair or, with two-factor authentication, a
+// challenge for the second step.
+type LoginResult struct {
+	User      *User
+	Tokens    *TokenPair
+	Challenge *ChallengeStep
+}
+
+// ChallengeStep is handed out when a login still needs a second factor.
+type ChallengeStep struct {
+	Token              string    `json:"challenge_token"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+}
+
+type totpEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+func (r *twoFactorLoginRequest) validate() error {
+	if r.ChallengeToken == "" {
+		return errChallengeRequired
+	}
+	if r.Code == "" && r.RecoveryCode == "" {
+		return errCodeRequired
+	}
+	return nil
+}
+
+type totpCodeRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+func (r *totpCodeRequest) validate() error {
+	if r.Code == "" {
+		return errCodeRequired
+	}
+	return nil
+}
+
+type disableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (r *disableTwoFactorRequest) validate() error {
+	if r.Password == "" {
+		return errPasswordRequired
+	}
+	if r.Code == "" && r.RecoveryCode == "" {
+		return errCodeRequired
+	}
+	return nil
+}
+
+type rolePolicyRequest struct {
+	RequireTwoFactor *bool `json:"require_two_factor"`
+}
+
+func (r *rolePolicyRequest) validate() error {
+	if r.RequireTwoFactor == nil {
+		return errRequireTwoFactor
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package user
+
+import (
+	"testing"
+	_ "time/tzdata"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestUpdateRequiresPassword(t *testing.T) {
+	tests := []struct {
+		name string
+		req  updateUserRequest
+		want bool
+	}{
+		{"timezone only", updateUserRequest{Timezone: ptr("Asia/Tashkent")}, false},
+		{"timezone with old password", updateUserRequest{Timezone: ptr("Asia/Tashkent"), OldPassword: ptr("secret")}, false},
+		{"first name", updateUserRequest{FirstName: ptr("Ada")}, true},
+		{"last name", updateUserRequest{LastName: ptr("Lovelace")}, true},
+		{"timezone and first name", updateUserRequest{Timezone: ptr("Asia/Tashkent"), FirstName: ptr("Ada")}, true},
+		{"email", updateUserRequest{Email: ptr("ada@example.com")}, true},
+		{"new password", updateUserRequest{NewPassword: ptr("secret2"), NewPasswordConfirm: ptr("secret2")}, true},
+		{"nothing", updateUserRequest{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.requiresPassword(); got != tt.want {
+				t.Errorf("requiresPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateTimezoneValidation(t *testing.T) {
+	for _, tz := range []string{"Asia/Tashkent", "America/New_York", "UTC"} {
+		req := updateUserRequest{Timezone: ptr(tz)}
+		if err := req.validateUpdateUserRequest(); err != nil {
+			t.Errorf("timezone %q: %v", tz, err)
+		}
+	}
+	for _, tz := range []string{"", "Local", "Nowhere/City"} {
+		req := updateUserRequest{Timezone: ptr(tz)}
+		if err := req.validateUpdateUserRequest(); err != errInvalidTimezone {
+			t.Errorf("timezone %q: err = %v, want %v", tz, err, errInvalidTimezone)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	cx "github.com/NurulloMahmud/habits/pkg/context"
 	"github.com/NurulloMahmud/habits/pkg/response"
 	"github.com/NurulloMahmud/habits/pkg/utils"
+	"github.com/go-chi/chi/v5"
 )
 
 var (
@@ -42,7 +43,7 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := h.service.register(r.Context(), req)
+	data, err := h.service.register(r.Context(), req, h.logger)
 	if err != nil {
 		if errors.Is(err, errEmailTaken) {
 			response.BadRequest(w, r, err, h.logger)
@@ -63,7 +64,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, token, err := h.service.login(r.Context(), *req.Email, *req.Password)
+	result, err := h.service.login(r.Context(), *req.Email, *req.Password)
 	if err != nil {
 		switch err {
 		case errInvalidCredentials:
@@ -84,12 +85,399 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if result.Challenge != nil {
+		response.WriteJSON(w, http.StatusOK, response.Envelope{
+			"two_factor_required": true,
+			"challenge":           result.Challenge,
+		})
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"access_token":  result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"user":          result.User,
+	})
+}
+
+func (h *UserHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorLoginRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user, tokens, err := h.service.verifyLogin(r.Context(), req)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
+	})
+}
+
+// LoginEnroll starts the two-factor enrollment a role policy requires, with
+// the challenge of the password step instead of an access token.
+func (h *UserHandler) LoginEnroll(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if req.ChallengeToken == "" {
+		response.BadRequest(w, r, errChallengeRequired, h.logger)
+		return
+	}
+
+	data, err := h.service.enrollWithChallenge(r.Context(), req.ChallengeToken)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *UserHandler) LoginEnrollConfirm(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if req.ChallengeToken == "" {
+		response.BadRequest(w, r, errChallengeRequired, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user, tokens, codes, err := h.service.confirmWithChallenge(r.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{
+		"access_token":   tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+		"recovery_codes": codes,
+		"user":           user,
+	})
+}
+
+func (h *UserHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := h.service.beginEnrollment(r.Context(), *user)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *UserHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.confirmEnrollment(r.Context(), *user, req.Code)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"recovery_codes": codes})
+}
+
+func (h *UserHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req disableTwoFactorRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.service.disableTwoFactor(r.Context(), *user, req)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "two-factor authentication disabled"})
+}
+
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.regenerateRecoveryCodes(r.Context(), *user, req.Code)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"recovery_codes": codes})
+}
+
+func (h *UserHandler) ListRolePolicies(w http.ResponseWriter, r *http.Request) {
+	data, err := h.service.listRolePolicies(r.Context())
+	if err != nil {
+		response.InternalServerError(w, r, err, h.logger)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+func (h *UserHandler) SetRolePolicy(w http.ResponseWriter, r *http.Request) {
+	var req rolePolicyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	admin := cx.GetUser(r)
+	data, err := h.service.setRolePolicy(r.Context(), admin.ID, chi.URLParam(r, "role"), *req.RequireTwoFactor)
+	if err != nil {
+		switch err {
+		case errInvalidRole:
+			response.BadRequest(w, r, err, h.logger)
+		default:
+			response.InternalServerError(w, r, err, h.logger)
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": data})
+}
+
+// currentUser loads the signed in user with their two-factor state, which
+// the request context does not carry.
+func (h *UserHandler) currentUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	user, err := h.service.getUser(r.Context(), cx.GetUser(r).ID)
+	if err != nil {
+		response.InternalServerError(w, r, err, h.logger)
+		return nil, false
+	}
+	if user == nil {
+		response.Unauthorized(w, r, "Unauthorized")
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *UserHandler) handleTwoFactorError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errInvalidChallenge:
+		response.Unauthorized(w, r, err.Error())
+	case errInvalidCode, errInvalidCredentials, errTwoFactorEnabled, errTwoFactorDisabled, errNoPendingTwoFactor,
+		errEnrollmentRequired:
+		response.BadRequest(w, r, err, h.logger)
+	case errTwoFactorRequired:
+		response.Forbidden(w, r, err.Error())
+	default:
+		response.InternalServerError(w, r, err, h.logger)
+	}
+}
+
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	tokens, err := h.service.refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch err {
+		case errInvalidRefresh, errRefreshReused:
+			response.Unauthorized(w, r, err.Error())
+		default:
+			response.InternalServerError(w, r, err, h.logger)
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"data": tokens})
+}
+
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = h.service.logout(r.Context(), req.RefreshToken, req.All)
+	if err != nil {
+		switch err {
+		case errInvalidRefresh:
+			response.Unauthorized(w, r, err.Error())
+		default:
+			response.InternalServerError(w, r, err, h.logger)
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "logged out successfully"})
+}
+
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = h.service.verifyEmail(r.Context(), req.Token)
+	if err != nil {
+		switch err {
+		case errInvalidVerifyToken:
+			response.BadRequest(w, r, err, h.logger)
+		default:
+			response.InternalServerError(w, r, err, h.logger)
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "email verified successfully"})
+}
+
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user := cx.GetUser(r)
+	err := h.service.resendVerification(r.Context(), user.ID)
+	if err != nil {
+		switch err {
+		case errAlreadyVerified:
+			response.BadRequest(w, r, err, h.logger)
+		case errVerifyThrottled:
+			response.WriteJSON(w, http.StatusTooManyRequests, response.Envelope{"error": err.Error()})
+		default:
+			response.InternalServerError(w, r, err, h.logger)
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "verification email sent"})
+}
+
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	h.service.requestPasswordReset(r.Context(), req.Email, h.logger)
+
 	response.WriteJSON(w, http.StatusOK, response.Envelope{
-		"access_token": token,
-		"user":         user,
+		"message": "if an account exists for this email, a password reset link has been sent",
 	})
 }
 
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+	if err = req.validate(); err != nil {
+		response.BadRequest(w, r, err, h.logger)
+		return
+	}
+
+	err = h.service.resetPassword(r.Context(), req.Token, req.Password)
+	if err != nil {
+		switch err {
+		case errInvalidResetToken:
+			response.BadRequest(w, r, err, h.logger)
+		default:
+			response.InternalServerError(w, r, err, h.logger)
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "password has been reset, please log in again"})
+}
+
 func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 	var req updateUserRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -105,11 +493,11 @@ func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := cx.GetUser(r)
-	err = h.service.update(r.Context(), user.ID, req)
+	updated, err := h.service.update(r.Context(), user.ID, req, h.logger)
 
 	if err != nil {
 		switch err {
-		case errInvalidCredentials:
+		case errInvalidCredentials, errPasswordRequired:
 			response.BadRequest(w, r, err, h.logger)
 			return
 		case errEmailTaken:
@@ -121,7 +509,7 @@ func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "user updated successfully"})
+	response.WriteJSON(w, http.StatusOK, response.Envelope{"message": "user updated successfully", "user": updated})
 }
 
 func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,117 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/platform/mailer"
+	cx "github.com/NurulloMahmud/habits/pkg/context"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	return errors.New("smtp: connection refused")
+}
+
+// logWriter hands every log line to a channel.
+type logWriter chan string
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestForgotPasswordAnswersTheSameForEveryEmail(t *testing.T) {
+	s, repo, _ := newTestService(t, &User{ID: 1, Email: "ada@example.com", IsActive: true})
+	s.mailer = failingMailer{}
+	lines := make(logWriter, 10)
+	h := NewHandler(*s, log.New(lines, "", 0))
+
+	forgot := func(email string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		body := strings.NewReader(`{"email": "` + email + `"}`)
+		h.ForgotPassword(rec, httptest.NewRequest(http.MethodPost, "/api/v1/password/forgot", body))
+		return rec
+	}
+
+	known := forgot("ada@example.com")
+	unknown := forgot("nobody@example.com")
+	if known.Code != http.StatusOK || unknown.Code != http.StatusOK {
+		t.Fatalf("status = %d for a known email, %d for an unknown one", known.Code, unknown.Code)
+	}
+	if !bytes.Equal(known.Body.Bytes(), unknown.Body.Bytes()) {
+		t.Fatalf("bodies differ:\n%s\n%s", known.Body, unknown.Body)
+	}
+
+	// the failed email to the known address is only logged
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, "connection refused") {
+			t.Fatalf("unexpected log line %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mailer error was not logged")
+	}
+	if len(repo.resets) != 1 || repo.resets[0].UserID != 1 {
+		t.Fatalf("password resets = %+v", repo.resets)
+	}
+}
+
+func TestRegisterSurvivesMailerFailure(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	s.mailer = failingMailer{}
+	lines := make(logWriter, 10)
+	h := NewHandler(*s, log.New(lines, "", 0))
+
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"email": "ada@example.com", "password": "Correct-horse-42", "password_confirm": "Correct-horse-42"}`)
+	h.Register(rec, httptest.NewRequest(http.MethodPost, "/api/v1/register", body))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if len(repo.users) != 1 || len(repo.verifications) != 1 {
+		t.Fatalf("%d users, %d verifications", len(repo.users), len(repo.verifications))
+	}
+	if line := <-lines; !strings.Contains(line, "connection refused") {
+		t.Fatalf("unexpected log line %q", line)
+	}
+}
+
+func TestUpdateEmailSurvivesMailerFailure(t *testing.T) {
+	verified := time.Now()
+	ada := &User{ID: 1, Email: "ada@example.com", IsActive: true, EmailVerifiedAt: &verified}
+	if err := ada.PasswordHash.Set("Correct-horse-42"); err != nil {
+		t.Fatal(err)
+	}
+	s, repo, _ := newTestService(t, ada)
+	s.mailer = failingMailer{}
+	lines := make(logWriter, 10)
+	h := NewHandler(*s, log.New(lines, "", 0))
+
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"email": "ada@example.org", "old_password": "Correct-horse-42"}`)
+	r := cx.SetUser(httptest.NewRequest(http.MethodPatch, "/api/v1/users/me", body), &cx.User{ID: 1})
+	h.Update(rec, r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if u := repo.users[1]; u.Email != "ada@example.org" || u.EmailVerifiedAt != nil {
+		t.Fatalf("user = %+v", u)
+	}
+	if !strings.Contains(rec.Body.String(), "ada@example.org") {
+		t.Fatalf("body %s does not hold the updated user", rec.Body)
+	}
+	if line := <-lines; !strings.Contains(line, "connection refused") {
+		t.Fatalf("unexpected log line %q", line)
+	}
+}
@@ -16,11 +16,73 @@ type User struct {
 	UserRole        string       `json:"user_role"`
 	IsActive        bool         `json:"is_active"`
 	IsLocked        bool         `json:"is_locked"`
+	Timezone        string       `json:"timezone"`
+	EmailVerifiedAt *time.Time   `json:"email_verified_at"`
 	LastFailedLogin sql.NullTime `json:"-"`
 	FailedAttempts  int64        `json:"-"`
 	PasswordHash    password     `json:"-"`
-	CreatedAt       time.Time    `json:"created_at"`
-	UpdatedAt       time.Time    `json:"updated_at"`
+	// TOTPSecret is encrypted, it only counts once TOTPEnabledAt is set.
+	TOTPSecret    []byte     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	// TokensRevokedBefore rejects every access token issued before it.
+	TokensRevokedBefore sql.NullTime `json:"-"`
+	CreatedAt           time.Time    `json:"created_at"`
+	UpdatedAt           time.Time    `json:"updated_at"`
+}
+
+// EmailVerification is a link sent to confirm that the user owns Email. Only
+// the hash of its token is stored.
+type EmailVerification struct {
+	ID        int64
+	UserID    int64
+	Email     string
+	TokenHash []byte
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// PasswordReset is a single use link to set a new password, sent to Email.
+type PasswordReset struct {
+	ID        int64
+	UserID    int64
+	Email     string
+	TokenHash []byte
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// LoginChallenge is the proof of a passed password check, waiting for the
+// second factor.
+type LoginChallenge struct {
+	ID        int64
+	UserID    int64
+	TokenHash []byte
+	Attempts  int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type RolePolicy struct {
+	UserRole         string    `json:"user_role"`
+	RequireTwoFactor bool      `json:"require_two_factor"`
+	UpdatedBy        *int64    `json:"updated_by"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// RefreshToken is a stored refresh token, only its hash is kept. Using a
+// token marks it as used and issues the next one in the same family.
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	FamilyID  string
+	SessionID *int64
+	Hash      []byte
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
 }
 
 var AnonymousUser = &User{}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/NurulloMahmud/habits/pkg/utils"
 )
@@ -16,6 +17,32 @@ type Repository interface {
 	Update(ctx context.Context, user User) error
 	Delete()
 	Unlock(ctx context.Context, id int64) error
+	createRefreshToken(ctx context.Context, t RefreshToken) error
+	getRefreshToken(ctx context.Context, hash []byte) (*RefreshToken, error)
+	rotateRefreshToken(ctx context.Context, usedID int64, next RefreshToken) (bool, error)
+	revokeTokenFamily(ctx context.Context, familyID string) error
+	revokeUserTokens(ctx context.Context, userID int64) error
+	createEmailVerification(ctx context.Context, v EmailVerification) error
+	getEmailVerification(ctx context.Context, hash []byte) (*EmailVerification, error)
+	lastEmailVerification(ctx context.Context, userID int64) (*time.Time, error)
+	confirmEmail(ctx context.Context, v EmailVerification) (bool, error)
+	createPasswordReset(ctx context.Context, pr PasswordReset) error
+	getPasswordReset(ctx context.Context, hash []byte) (*PasswordReset, error)
+	lastPasswordReset(ctx context.Context, userID int64) (*time.Time, error)
+	resetPassword(ctx context.Context, pr PasswordReset, passwordHash []byte) (bool, error)
+	setTOTPSecret(ctx context.Context, userID int64, secret []byte) error
+	enableTOTP(ctx context.Context, userID, step int64, codeHashes [][]byte) (bool, error)
+	disableTOTP(ctx context.Context, userID int64) error
+	useTOTPStep(ctx context.Context, userID, step int64) (bool, error)
+	useRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error)
+	replaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error
+	createLoginChallenge(ctx context.Context, c LoginChallenge) error
+	getLoginChallenge(ctx context.Context, hash []byte) (*LoginChallenge, error)
+	failLoginChallenge(ctx context.Context, id int64) error
+	useLoginChallenge(ctx context.Context, id int64) (bool, error)
+	requiresTwoFactor(ctx context.Context, role string) (bool, error)
+	listRolePolicies(ctx context.Context) ([]*RolePolicy, error)
+	setRolePolicy(ctx context.Context, p RolePolicy) (*RolePolicy, error)
 }
 
 type postgresRepo struct {
@@ -30,9 +57,9 @@ func (r *postgresRepo) Create(ctx context.Context, u User) (*User, error) {
 	query := `
 	INSERT INTO users (email, password_hash, first_name, last_name, user_role)
 	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id, user_role`
+	RETURNING id, user_role, timezone`
 
-	err := r.db.QueryRowContext(ctx, query, u.Email, u.PasswordHash.hash, u.FirstName, u.LastName, u.UserRole).Scan(&u.ID, &u.UserRole)
+	err := r.db.QueryRowContext(ctx, query, u.Email, u.PasswordHash.hash, u.FirstName, u.LastName, u.UserRole).Scan(&u.ID, &u.UserRole, &u.Timezone)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +80,11 @@ func (r *postgresRepo) Get(ctx context.Context, id int64, email string) (*User,
 		is_locked, 
 		failed_attempts, 
 		last_failed_login, 
+		timezone,
+		email_verified_at,
+		totp_secret,
+		totp_enabled_at,
+		tokens_revoked_before,
 		created_at
 	FROM users
 	WHERE id = $1 OR email = $2`
@@ -69,6 +101,11 @@ func (r *postgresRepo) Get(ctx context.Context, id int64, email string) (*User,
 		&user.IsLocked,
 		&user.FailedAttempts,
 		&user.LastFailedLogin,
+		&user.Timezone,
+		&user.EmailVerifiedAt,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.TokensRevokedBefore,
 		&user.CreatedAt,
 	)
 
@@ -88,7 +125,7 @@ func (r *postgresRepo) List(ctx context.Context, q ListUserInput) ([]*User, *uti
 	totalRecords := 0
 
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, email, first_name, last_name, user_role, is_active, is_locked, last_failed_login, failed_attempts, created_at
+		SELECT COUNT(*) OVER(), id, email, first_name, last_name, user_role, is_active, is_locked, last_failed_login, failed_attempts, timezone, created_at
 		FROM users
 		WHERE (
 			$1 = '' OR
@@ -134,6 +171,7 @@ func (r *postgresRepo) List(ctx context.Context, q ListUserInput) ([]*User, *uti
 			&user.IsLocked,
 			&user.LastFailedLogin,
 			&user.FailedAttempts,
+			&user.Timezone,
 			&user.CreatedAt,
 		)
 
@@ -159,8 +197,10 @@ func (r *postgresRepo) Update(ctx context.Context, user User) error {
 		last_failed_login = $6,
 		failed_attempts = $7,
 		user_role = $8,
-		password_hash = $9
-	WHERE id = $10`
+		password_hash = $9,
+		timezone = $10,
+		email_verified_at = $11
+	WHERE id = $12`
 	_, err := r.db.ExecContext(
 		ctx, query,
 		user.Email,
@@ -172,6 +212,8 @@ func (r *postgresRepo) Update(ctx context.Context, user User) error {
 		user.FailedAttempts,
 		user.UserRole,
 		user.PasswordHash.hash,
+		user.Timezone,
+		user.EmailVerifiedAt,
 		user.ID,
 	)
 	return err
@@ -186,3 +228,557 @@ func (r *postgresRepo) Unlock(ctx context.Context, id int64) error {
 	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
+
+// createRefreshToken stores a token, starting a new family when FamilyID is
+// empty.
+func (r *postgresRepo) createRefreshToken(ctx context.Context, t RefreshToken) error {
+	query := `
+	INSERT INTO refresh_tokens (user_id, family_id, session_id, token_hash, expires_at)
+	VALUES ($1, COALESCE($2::uuid, gen_random_uuid()), $3, $4, $5)`
+
+	familyID := sql.NullString{String: t.FamilyID, Valid: t.FamilyID != ""}
+	_, err := r.db.ExecContext(ctx, query, t.UserID, familyID, t.SessionID, t.Hash, t.ExpiresAt)
+	return err
+}
+
+func (r *postgresRepo) getRefreshToken(ctx context.Context, hash []byte) (*RefreshToken, error) {
+	query := `
+	SELECT id, user_id, family_id, session_id, token_hash, expires_at, used_at, revoked_at, created_at
+	FROM refresh_tokens
+	WHERE token_hash = $1`
+
+	var t RefreshToken
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.FamilyID,
+		&t.SessionID,
+		&t.Hash,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.RevokedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// rotateRefreshToken marks a token as used and stores its successor. It
+// returns false when the token was used or revoked in the meantime.
+func (r *postgresRepo) rotateRefreshToken(ctx context.Context, usedID int64, next RefreshToken) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE refresh_tokens
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL`
+
+	res, err := tx.ExecContext(ctx, query, usedID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	query = `
+	INSERT INTO refresh_tokens (user_id, family_id, session_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.ExecContext(ctx, query, next.UserID, next.FamilyID, next.SessionID, next.Hash, next.ExpiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// revokeTokenFamily revokes the refresh tokens of one login and ends its
+// session.
+func (r *postgresRepo) revokeTokenFamily(ctx context.Context, familyID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE sessions
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE revoked_at IS NULL AND id IN (SELECT session_id FROM refresh_tokens WHERE family_id = $1)`
+
+	_, err = tx.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE family_id = $1 AND revoked_at IS NULL`
+
+	_, err = tx.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeUserTokens revokes every refresh token of the user and rejects the
+// access tokens issued so far.
+func (r *postgresRepo) revokeUserTokens(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND revoked_at IS NULL`
+
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE users SET tokens_revoked_before = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepo) createEmailVerification(ctx context.Context, v EmailVerification) error {
+	query := `
+	INSERT INTO email_verifications (user_id, email, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4)`
+
+	_, err := r.db.ExecContext(ctx, query, v.UserID, v.Email, v.TokenHash, v.ExpiresAt)
+	return err
+}
+
+func (r *postgresRepo) getEmailVerification(ctx context.Context, hash []byte) (*EmailVerification, error) {
+	query := `
+	SELECT id, user_id, email, token_hash, expires_at, used_at, created_at
+	FROM email_verifications
+	WHERE token_hash = $1`
+
+	var v EmailVerification
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(
+		&v.ID,
+		&v.UserID,
+		&v.Email,
+		&v.TokenHash,
+		&v.ExpiresAt,
+		&v.UsedAt,
+		&v.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// lastEmailVerification returns when the user was last sent a verification
+// link, nil if never.
+func (r *postgresRepo) lastEmailVerification(ctx context.Context, userID int64) (*time.Time, error) {
+	query := `SELECT MAX(created_at) FROM email_verifications WHERE user_id = $1`
+
+	var last *time.Time
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&last)
+	return last, err
+}
+
+// confirmEmail uses the verification and marks the user's email as verified,
+// as long as it is still the address the link was sent to. It returns false
+// when the link was used in the meantime or the email has changed.
+func (r *postgresRepo) confirmEmail(ctx context.Context, v EmailVerification) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE email_verifications SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL`
+	res, err := tx.ExecContext(ctx, query, v.ID)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	query = `
+	UPDATE users
+	SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+	WHERE id = $1 AND email = $2`
+	res, err = tx.ExecContext(ctx, query, v.UserID, v.Email)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *postgresRepo) createPasswordReset(ctx context.Context, pr PasswordReset) error {
+	query := `
+	INSERT INTO password_resets (user_id, email, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4)`
+
+	_, err := r.db.ExecContext(ctx, query, pr.UserID, pr.Email, pr.TokenHash, pr.ExpiresAt)
+	return err
+}
+
+func (r *postgresRepo) getPasswordReset(ctx context.Context, hash []byte) (*PasswordReset, error) {
+	query := `
+	SELECT id, user_id, email, token_hash, expires_at, used_at, created_at
+	FROM password_resets
+	WHERE token_hash = $1`
+
+	var pr PasswordReset
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(
+		&pr.ID,
+		&pr.UserID,
+		&pr.Email,
+		&pr.TokenHash,
+		&pr.ExpiresAt,
+		&pr.UsedAt,
+		&pr.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &pr, nil
+}
+
+func (r *postgresRepo) lastPasswordReset(ctx context.Context, userID int64) (*time.Time, error) {
+	query := `SELECT MAX(created_at) FROM password_resets WHERE user_id = $1`
+
+	var last *time.Time
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&last)
+	return last, err
+}
+
+// resetPassword sets the new password, unlocks the account and signs the
+// user out everywhere. Every open reset link of the user is used up with it.
+// It returns false when the link was used in the meantime or the user's
+// email no longer matches the one the link was sent to.
+func (r *postgresRepo) resetPassword(ctx context.Context, pr PasswordReset, passwordHash []byte) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE password_resets
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND used_at IS NULL
+	RETURNING id`
+
+	rows, err := tx.QueryContext(ctx, query, pr.UserID)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, err
+		}
+		found = found || id == pr.ID
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || !found {
+		return false, err
+	}
+
+	// the link proves the address, so it counts as verified as well
+	query = `
+	UPDATE users
+	SET password_hash = $1,
+		failed_attempts = 0,
+		is_locked = false,
+		email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP),
+		tokens_revoked_before = CURRENT_TIMESTAMP
+	WHERE id = $2 AND email = $3`
+
+	res, err := tx.ExecContext(ctx, query, passwordHash, pr.UserID, pr.Email)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	query = `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND revoked_at IS NULL`
+
+	_, err = tx.ExecContext(ctx, query, pr.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	query = `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err = tx.ExecContext(ctx, query, pr.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// setTOTPSecret stores a new secret for an enrollment in progress, it never
+// replaces the secret of an enabled second factor.
+func (r *postgresRepo) setTOTPSecret(ctx context.Context, userID int64, secret []byte) error {
+	query := `UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_enabled_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, secret, userID)
+	return err
+}
+
+// enableTOTP turns the enrolled secret on and replaces the recovery codes.
+// It returns false when the user has no pending secret.
+func (r *postgresRepo) enableTOTP(ctx context.Context, userID, step int64, codeHashes [][]byte) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE users
+	SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = $1
+	WHERE id = $2 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`
+
+	res, err := tx.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	if err = insertRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *postgresRepo) disableTOTP(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE users
+	SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+	WHERE id = $1`
+
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// useTOTPStep records the time step of an accepted code. It returns false for
+// a step that was already used, so a code works only once.
+func (r *postgresRepo) useTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	res, err := r.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *postgresRepo) useRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error) {
+	query := `
+	UPDATE recovery_codes
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	res, err := r.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *postgresRepo) replaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertRecoveryCodes replaces the user's recovery codes inside tx.
+func insertRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, codeHashes [][]byte) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, hash := range codeHashes {
+		if _, err = tx.ExecContext(ctx, query, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresRepo) createLoginChallenge(ctx context.Context, c LoginChallenge) error {
+	query := `
+	INSERT INTO login_challenges (user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3)`
+
+	_, err := r.db.ExecContext(ctx, query, c.UserID, c.TokenHash, c.ExpiresAt)
+	return err
+}
+
+func (r *postgresRepo) getLoginChallenge(ctx context.Context, hash []byte) (*LoginChallenge, error) {
+	query := `
+	SELECT id, user_id, token_hash, attempts, expires_at, used_at
+	FROM login_challenges
+	WHERE token_hash = $1`
+
+	var c LoginChallenge
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.TokenHash,
+		&c.Attempts,
+		&c.ExpiresAt,
+		&c.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (r *postgresRepo) failLoginChallenge(ctx context.Context, id int64) error {
+	query := `UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *postgresRepo) useLoginChallenge(ctx context.Context, id int64) (bool, error) {
+	query := `UPDATE login_challenges SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL`
+
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *postgresRepo) requiresTwoFactor(ctx context.Context, role string) (bool, error) {
+	query := `SELECT require_two_factor FROM role_policies WHERE user_role = $1`
+
+	var required bool
+	err := r.db.QueryRowContext(ctx, query, role).Scan(&required)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return required, err
+}
+
+func (r *postgresRepo) listRolePolicies(ctx context.Context) ([]*RolePolicy, error) {
+	result := []*RolePolicy{}
+
+	query := `
+	SELECT user_role, require_two_factor, updated_by, updated_at
+	FROM role_policies
+	ORDER BY user_role`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p RolePolicy
+		if err = rows.Scan(&p.UserRole, &p.RequireTwoFactor, &p.UpdatedBy, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &p)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *postgresRepo) setRolePolicy(ctx context.Context, p RolePolicy) (*RolePolicy, error) {
+	query := `
+	INSERT INTO role_policies (user_role, require_two_factor, updated_by)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_role) DO UPDATE
+	SET require_two_factor = EXCLUDED.require_two_factor,
+		updated_by = EXCLUDED.updated_by,
+		updated_at = CURRENT_TIMESTAMP
+	RETURNING updated_at`
+
+	err := r.db.QueryRowContext(ctx, query, p.UserRole, p.RequireTwoFactor, p.UpdatedBy).Scan(&p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/NurulloMahmud/habits/config"
 	"github.com/NurulloMahmud/habits/internal/auth"
+	"github.com/NurulloMahmud/habits/internal/platform/mailer"
 	"github.com/NurulloMahmud/habits/pkg/utils"
 )
 
@@ -17,21 +22,51 @@ var (
 	errUserInactive       = errors.New("inactive user")
 	errUserLocked         = errors.New("user is locked temporarily")
 	errMatchingPassword   = errors.New("error matching password")
+	errInvalidRefresh     = errors.New("invalid refresh token")
+	errRefreshReused      = errors.New("refresh token has already been used")
+	errInvalidVerifyToken = errors.New("Invalid or expired verification link")
+	errAlreadyVerified    = errors.New("Your email address is already verified")
+	errVerifyThrottled    = errors.New("A verification email was sent recently, please wait before requesting another one")
+	errInvalidResetToken  = errors.New("Invalid or expired password reset link")
 )
 
+// resetResendInterval is the least time between two password reset emails to
+// the same user.
+const resetResendInterval = time.Minute
+
+// forgotPasswordTimeout bounds the background work of a forgot password
+// request.
+const forgotPasswordTimeout = 30 * time.Second
+
+// Sessions starts the session a login belongs to.
+type Sessions interface {
+	Start(ctx context.Context, userID int64) (int64, error)
+}
+
 type UserService struct {
-	repo Repository
-	cfg  config.Config
+	repo     Repository
+	keys     *auth.KeySet
+	secrets  *auth.SecretBox
+	sessions Sessions
+	mailer   mailer.Mailer
+	cfg      config.Config
 }
 
-func NewService(repo Repository, cfg config.Config) UserService {
+func NewService(repo Repository, keys *auth.KeySet, secrets *auth.SecretBox, sessions Sessions, m mailer.Mailer, cfg config.Config) UserService {
 	return UserService{
-		repo: repo,
-		cfg:  cfg,
+		repo:     repo,
+		keys:     keys,
+		secrets:  secrets,
+		sessions: sessions,
+		mailer:   m,
+		cfg:      cfg,
 	}
 }
 
-func (s *UserService) register(ctx context.Context, req registerUserRequest) (*User, error) {
+// register creates a user and emails them a verification link. The user
+// exists once created, so a failed email is only logged, they can ask for a
+// new link after logging in.
+func (s *UserService) register(ctx context.Context, req registerUserRequest, logger *log.Logger) (*User, error) {
 	existingUser, err := s.repo.Get(ctx, 0, req.Email)
 	if err != nil {
 		return nil, err
@@ -59,99 +94,406 @@ func (s *UserService) register(ctx context.Context, req registerUserRequest) (*U
 		return nil, err
 	}
 
+	if err = s.sendVerification(ctx, *user); err != nil {
+		logger.Printf("[ERROR] verification email to user %d: %v\n", user.ID, err)
+	}
+
 	return user, nil
 }
 
-func (s *UserService) login(ctx context.Context, email, password string) (*User, string, error) {
+// sendVerification emails the user a link that confirms their current email
+// address.
+func (s *UserService) sendVerification(ctx context.Context, user User) error {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(s.cfg.EmailVerification.TTL)
+	err = s.repo.createEmailVerification(ctx, EmailVerification{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.cfg.AppBaseURL, url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(
+			"Confirm your email address for Habits here: %s\n\nThe link expires on %s. If you did not sign up, ignore this email.\n",
+			link, expiresAt.Format(time.RFC1123),
+		),
+	})
+}
+
+func (s *UserService) verifyEmail(ctx context.Context, token string) error {
+	v, err := s.repo.getEmailVerification(ctx, auth.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if v == nil || v.UsedAt != nil || time.Now().UTC().After(v.ExpiresAt) {
+		return errInvalidVerifyToken
+	}
+
+	confirmed, err := s.repo.confirmEmail(ctx, *v)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return errInvalidVerifyToken
+	}
+	return nil
+}
+
+// resendVerification sends a new link, at most once per resend interval.
+func (s *UserService) resendVerification(ctx context.Context, userID int64) error {
+	user, err := s.repo.Get(ctx, userID, "")
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return errAlreadyVerified
+	}
+
+	last, err := s.repo.lastEmailVerification(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if last != nil && time.Since(*last) < s.cfg.EmailVerification.ResendInterval {
+		return errVerifyThrottled
+	}
+
+	return s.sendVerification(ctx, *user)
+}
+
+func (s *UserService) login(ctx context.Context, email, password string) (*LoginResult, error) {
 	user, err := s.repo.Get(ctx, 0, email)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	if user == nil {
-		return nil, "", errInvalidCredentials
+		return nil, errInvalidCredentials
 	}
 
 	if !user.IsActive {
-		return nil, "", errUserInactive
+		return nil, errUserInactive
 	}
 
 	if user.IsLocked {
 		if time.Since(user.LastFailedLogin.Time) < time.Hour*24 {
-			return nil, "", errUserLocked
+			return nil, errUserLocked
 		}
 		if err := s.repo.Unlock(ctx, user.ID); err != nil {
-			return nil, "", err
+			return nil, err
 		}
+		user.IsLocked = false
+		user.FailedAttempts = 0
 	}
 
 	matched, err := user.PasswordHash.Matches(password)
 	if err != nil {
-		return nil, "", errMatchingPassword
+		return nil, errMatchingPassword
 	}
 
 	if !matched {
-		user.FailedAttempts += 1
-		user.LastFailedLogin = sql.NullTime{
-			Time:  time.Now().UTC(),
-			Valid: true,
+		if err = s.recordFailedLogin(ctx, user); err != nil {
+			return nil, err
 		}
+		return nil, errInvalidCredentials
+	}
 
-		if user.FailedAttempts >= 5 {
-			user.IsLocked = true
-		}
+	return s.secondFactorOrTokens(ctx, user)
+}
 
-		err = s.repo.Update(ctx, *user)
+// secondFactorOrTokens finishes the first login step. With a second factor
+// it only earns a challenge, the failed attempts are kept until the second
+// step passes as well.
+func (s *UserService) secondFactorOrTokens(ctx context.Context, user *User) (*LoginResult, error) {
+	required, err := s.repo.requiresTwoFactor(ctx, user.UserRole)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil || required {
+		challenge, err := s.newChallenge(ctx, *user)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
+		return &LoginResult{User: user, Challenge: challenge}, nil
+	}
 
-		return nil, "", errInvalidCredentials
+	tokens, err := s.completeLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{User: user, Tokens: tokens}, nil
+}
+
+// PasswordlessLogin logs in a user with a passkey. The authenticator verified
+// the user with a PIN or biometric on a device they own, which is two factors
+// already, so neither enabled TOTP nor a role policy requiring two-factor
+// authentication asks for a code. Callers must only use it after user
+// verification passed. It returns a nil user for accounts that cannot log in.
+func (s *UserService) PasswordlessLogin(ctx context.Context, userID int64) (*User, *TokenPair, error) {
+	user, err := s.loginUser(ctx, userID)
+	if err != nil || user == nil {
+		return nil, nil, err
 	}
 
+	tokens, err := s.completeLogin(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// ExternalLogin logs in a user who signed in with an external identity
+// provider. The provider only stands in for the password, so a second factor
+// is still asked for. It returns nil for accounts that cannot log in.
+func (s *UserService) ExternalLogin(ctx context.Context, userID int64) (*LoginResult, error) {
+	user, err := s.loginUser(ctx, userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return s.secondFactorOrTokens(ctx, user)
+}
+
+// loginUser loads a user logging in without a password, nil if the account
+// is inactive or still locked.
+func (s *UserService) loginUser(ctx context.Context, userID int64) (*User, error) {
+	user, err := s.repo.Get(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, nil
+	}
+	if user.IsLocked && time.Since(user.LastFailedLogin.Time) < time.Hour*24 {
+		return nil, nil
+	}
+	user.IsLocked = false
+	return user, nil
+}
+
+// RegisterExternal creates a user for someone signing up with an external
+// identity provider that vouched for the email. The user gets a random
+// password, they can set one with the forgot password flow.
+func (s *UserService) RegisterExternal(ctx context.Context, email string, firstName, lastName *string) (*User, error) {
+	existingUser, err := s.repo.Get(ctx, 0, email)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser != nil {
+		return nil, errEmailTaken
+	}
+
+	newUser := User{Email: email, UserRole: "user", FirstName: firstName, LastName: lastName}
+	password, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if err = newUser.PasswordHash.Set(password); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.Create(ctx, newUser)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	user.IsActive = true
+	user.EmailVerifiedAt = &now
+	if err = s.repo.Update(ctx, *user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// recordFailedLogin counts a wrong password or second factor, locking the
+// account after five in a row.
+func (s *UserService) recordFailedLogin(ctx context.Context, user *User) error {
+	user.FailedAttempts += 1
+	user.LastFailedLogin = sql.NullTime{
+		Time:  time.Now().UTC(),
+		Valid: true,
+	}
+
+	if user.FailedAttempts >= 5 {
+		user.IsLocked = true
+	}
+
+	return s.repo.Update(ctx, *user)
+}
+
+// completeLogin resets the failed attempts, starts a session and issues a new
+// token pair for it.
+func (s *UserService) completeLogin(ctx context.Context, user *User) (*TokenPair, error) {
 	user.FailedAttempts = 0
-	err = s.repo.Update(ctx, *user)
+	err := s.repo.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := s.sessions.Start(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.accessToken(*user, &sessionID)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+
+	refreshToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.createRefreshToken(ctx, RefreshToken{
+		UserID:    user.ID,
+		SessionID: &sessionID,
+		Hash:      hash,
+		ExpiresAt: time.Now().UTC().Add(s.cfg.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	return &TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (s *UserService) accessToken(user User, sessionID *int64) (string, error) {
 	claims := auth.TokenClaims{
 		ID:       user.ID,
 		Email:    user.Email,
 		UserRole: user.UserRole,
 	}
+	if sessionID != nil {
+		claims.SessionID = *sessionID
+	}
+
+	return auth.GenerateAccessToken(claims, s.keys, s.cfg.AccessTokenTTL)
+}
 
-	token, err := auth.GenerateAccessToken(claims, s.cfg.JWTSecret)
+// refresh swaps a refresh token for a new token pair. A token is good for
+// one use only, presenting it again means it leaked, so its whole family is
+// revoked.
+func (s *UserService) refresh(ctx context.Context, token string) (*TokenPair, error) {
+	t, err := s.repo.getRefreshToken(ctx, auth.HashToken(token))
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	if t == nil || t.RevokedAt != nil {
+		return nil, errInvalidRefresh
+	}
+	if t.UsedAt != nil {
+		return nil, s.revokeReused(ctx, t.FamilyID)
+	}
+	if time.Now().UTC().After(t.ExpiresAt) {
+		return nil, errInvalidRefresh
 	}
 
-	return user, token, nil
-}
+	user, err := s.repo.Get(ctx, t.UserID, "")
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive || user.IsLocked {
+		return nil, errInvalidRefresh
+	}
 
-func (s *UserService) update(ctx context.Context, id int64, req updateUserRequest) error {
-	user, err := s.repo.Get(ctx, id, "")
+	refreshToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := s.repo.rotateRefreshToken(ctx, t.ID, RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  t.FamilyID,
+		SessionID: t.SessionID,
+		Hash:      hash,
+		ExpiresAt: time.Now().UTC().Add(s.cfg.RefreshTokenTTL),
+	})
 	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// lost a race against another use of the same token
+		return nil, s.revokeReused(ctx, t.FamilyID)
+	}
+
+	accessToken, err := s.accessToken(*user, t.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (s *UserService) revokeReused(ctx context.Context, familyID string) error {
+	if err := s.repo.revokeTokenFamily(ctx, familyID); err != nil {
 		return err
 	}
+	return errRefreshReused
+}
 
-	matched, err := user.PasswordHash.Matches(*req.OldPassword)
+// logout revokes the refresh token's family, or with all every token of the
+// user including the access tokens already issued.
+func (s *UserService) logout(ctx context.Context, token string, all bool) error {
+	t, err := s.repo.getRefreshToken(ctx, auth.HashToken(token))
 	if err != nil {
 		return err
 	}
+	if t == nil {
+		return errInvalidRefresh
+	}
 
-	if !matched {
-		return errInvalidCredentials
+	if all {
+		return s.repo.revokeUserTokens(ctx, t.UserID)
+	}
+	return s.repo.revokeTokenFamily(ctx, t.FamilyID)
+}
+
+// update applies the changes and returns the updated user. A new email
+// address has to be confirmed again, failing to send the verification is
+// logged since the change itself is saved.
+func (s *UserService) update(ctx context.Context, id int64, req updateUserRequest, logger *log.Logger) (*User, error) {
+	user, err := s.repo.Get(ctx, id, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if req.requiresPassword() {
+		if req.OldPassword == nil {
+			return nil, errPasswordRequired
+		}
+
+		matched, err := user.PasswordHash.Matches(*req.OldPassword)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matched {
+			return nil, errInvalidCredentials
+		}
 	}
 
 	if req.Email != nil {
 		existingUser, err := s.repo.Get(ctx, 0, *req.Email)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if existingUser != nil && existingUser.ID != user.ID {
-			return errEmailTaken
+			return nil, errEmailTaken
+		}
+		if !strings.EqualFold(user.Email, *req.Email) {
+			user.EmailVerifiedAt = nil
 		}
 		user.Email = *req.Email
 	}
@@ -162,21 +504,123 @@ func (s *UserService) update(ctx context.Context, id int64, req updateUserReques
 	if req.LastName != nil {
 		user.LastName = req.LastName
 	}
+	if req.Timezone != nil {
+		user.Timezone = *req.Timezone
+	}
 	if req.NewPassword != nil {
 		err = user.PasswordHash.Set(*req.NewPassword)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	err = s.repo.Update(ctx, *user)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	if user.EmailVerifiedAt == nil && req.Email != nil {
+		if err = s.sendVerification(ctx, *user); err != nil {
+			logger.Printf("[ERROR] verification email to user %d: %v\n", user.ID, err)
+		}
+	}
+
+	// a new password signs out every other session
+	if req.NewPassword != nil {
+		if err = s.repo.revokeUserTokens(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
 }
 
 func (s *UserService) list(ctx context.Context, q ListUserInput) ([]*User, *utils.Metadata, error) {
 	return s.repo.List(ctx, q)
 }
+
+// requestPasswordReset runs forgotPassword after the caller has answered, so
+// neither the status nor the response time tells whether the email is
+// registered. Failures can only be logged.
+func (s *UserService) requestPasswordReset(ctx context.Context, email string, logger *log.Logger) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, forgotPasswordTimeout)
+		defer cancel()
+
+		if err := s.forgotPassword(ctx, email); err != nil {
+			logger.Printf("[ERROR] forgot password: %v\n", err)
+		}
+	}()
+}
+
+// forgotPassword emails a password reset link. Unknown, inactive and recently
+// mailed addresses are skipped silently, so the caller cannot tell which
+// emails are registered.
+func (s *UserService) forgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.Get(ctx, 0, email)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.IsActive {
+		return nil
+	}
+
+	last, err := s.repo.lastPasswordReset(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if last != nil && time.Since(*last) < resetResendInterval {
+		return nil
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(s.cfg.PasswordResetTTL)
+	err = s.repo.createPasswordReset(ctx, PasswordReset{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.cfg.AppBaseURL, url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Set a new password for Habits here: %s\n\nThe link expires on %s and works once. If you did not ask for it, ignore this email.\n",
+			link, expiresAt.Format(time.RFC1123),
+		),
+	})
+}
+
+func (s *UserService) resetPassword(ctx context.Context, token, newPassword string) error {
+	pr, err := s.repo.getPasswordReset(ctx, auth.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if pr == nil || pr.UsedAt != nil || time.Now().UTC().After(pr.ExpiresAt) {
+		return errInvalidResetToken
+	}
+
+	var pw password
+	if err = pw.Set(newPassword); err != nil {
+		return err
+	}
+
+	done, err := s.repo.resetPassword(ctx, *pr, pw.hash)
+	if err != nil {
+		return err
+	}
+	if !done {
+		return errInvalidResetToken
+	}
+	return nil
+}
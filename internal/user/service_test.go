@@ -0,0 +1,161 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NurulloMahmud/habits/config"
+	"github.com/NurulloMahmud/habits/internal/auth"
+)
+
+// memoryRepository keeps users in memory. It implements what the tests
+// need, other methods panic through the nil embedded interface.
+type memoryRepository struct {
+	Repository
+	users      map[int64]*User
+	policies   map[string]bool
+	challenges []LoginChallenge
+	tokens     []RefreshToken
+	resets     []PasswordReset
+
+	verifications []EmailVerification
+}
+
+func (r *memoryRepository) Get(ctx context.Context, id int64, email string) (*User, error) {
+	for _, u := range r.users {
+		if u.ID == id || (email != "" && u.Email == email) {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) Create(ctx context.Context, u User) (*User, error) {
+	u.ID = int64(len(r.users) + 1)
+	r.users[u.ID] = &u
+	copied := u
+	return &copied, nil
+}
+
+func (r *memoryRepository) Update(ctx context.Context, u User) error {
+	r.users[u.ID] = &u
+	return nil
+}
+
+func (r *memoryRepository) requiresTwoFactor(ctx context.Context, role string) (bool, error) {
+	return r.policies[role], nil
+}
+
+func (r *memoryRepository) createLoginChallenge(ctx context.Context, c LoginChallenge) error {
+	r.challenges = append(r.challenges, c)
+	return nil
+}
+
+func (r *memoryRepository) createRefreshToken(ctx context.Context, t RefreshToken) error {
+	r.tokens = append(r.tokens, t)
+	return nil
+}
+
+func (r *memoryRepository) createEmailVerification(ctx context.Context, v EmailVerification) error {
+	r.verifications = append(r.verifications, v)
+	return nil
+}
+
+func (r *memoryRepository) lastPasswordReset(ctx context.Context, userID int64) (*time.Time, error) {
+	return nil, nil
+}
+
+func (r *memoryRepository) createPasswordReset(ctx context.Context, pr PasswordReset) error {
+	r.resets = append(r.resets, pr)
+	return nil
+}
+
+type fakeSessions struct {
+	started []int64
+}
+
+func (f *fakeSessions) Start(ctx context.Context, userID int64) (int64, error) {
+	f.started = append(f.started, userID)
+	return int64(len(f.started)), nil
+}
+
+func newTestService(t *testing.T, users ...*User) (*UserService, *memoryRepository, *fakeSessions) {
+	t.Helper()
+
+	keys, err := auth.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memoryRepository{users: map[int64]*User{}, policies: map[string]bool{}}
+	for _, u := range users {
+		repo.users[u.ID] = u
+	}
+	sessions := &fakeSessions{}
+	cfg := config.Config{
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		TwoFactor:       config.TwoFactor{ChallengeTTL: time.Minute},
+	}
+
+	s := NewService(repo, keys, nil, sessions, nil, cfg)
+	return &s, repo, sessions
+}
+
+func TestPasskeySatisfiesTwoFactorPolicy(t *testing.T) {
+	enabled := time.Now()
+	tests := []struct {
+		name     string
+		user     *User
+		required bool
+	}{
+		{"totp enabled", &User{ID: 1, UserRole: "user", IsActive: true, TOTPEnabledAt: &enabled}, false},
+		{"role requires two factor", &User{ID: 1, UserRole: "admin", IsActive: true}, true},
+		{"both", &User{ID: 1, UserRole: "admin", IsActive: true, TOTPEnabledAt: &enabled}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, sessions := newTestService(t, tt.user)
+			repo.policies[tt.user.UserRole] = tt.required
+
+			// a password or an identity provider only earns a challenge
+			result, err := s.ExternalLogin(context.Background(), tt.user.ID)
+			if err != nil {
+				t.Fatalf("ExternalLogin: %v", err)
+			}
+			if result.Challenge == nil || result.Tokens != nil {
+				t.Fatalf("ExternalLogin skipped the second factor: %+v", result)
+			}
+
+			// a verified passkey covers both factors
+			u, tokens, err := s.PasswordlessLogin(context.Background(), tt.user.ID)
+			if err != nil {
+				t.Fatalf("PasswordlessLogin: %v", err)
+			}
+			if u == nil || tokens == nil || tokens.AccessToken == "" {
+				t.Fatalf("PasswordlessLogin = %v, %v", u, tokens)
+			}
+			if len(sessions.started) != 1 || len(repo.tokens) != 1 {
+				t.Fatalf("started %d sessions and %d refresh tokens", len(sessions.started), len(repo.tokens))
+			}
+		})
+	}
+}
+
+func TestPasswordlessLoginRefusesUnusableAccounts(t *testing.T) {
+	inactive := &User{ID: 1, UserRole: "user"}
+	locked := &User{ID: 2, UserRole: "user", IsActive: true, IsLocked: true}
+	locked.LastFailedLogin.Time, locked.LastFailedLogin.Valid = time.Now(), true
+
+	s, _, sessions := newTestService(t, inactive, locked)
+	for _, id := range []int64{inactive.ID, locked.ID, 99} {
+		u, tokens, err := s.PasswordlessLogin(context.Background(), id)
+		if err != nil || u != nil || tokens != nil {
+			t.Fatalf("user %d: PasswordlessLogin = %v, %v, %v", id, u, tokens, err)
+		}
+	}
+	if len(sessions.started) != 0 {
+		t.Fatal("a session was started for an unusable account")
+	}
+}
@@ -0,0 +1,345 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/NurulloMahmud/habits/internal/auth"
+)
+
+// maxChallengeAttempts is how many wrong codes a login challenge takes
+// before it is used up.
+const maxChallengeAttempts = 5
+
+// recoveryCodeCount is how many one-time recovery codes a user gets.
+const recoveryCodeCount = 10
+
+var (
+	errInvalidChallenge   = errors.New("Invalid or expired login challenge, please log in again")
+	errInvalidCode        = errors.New("Invalid two-factor code")
+	errTwoFactorEnabled   = errors.New("Two-factor authentication is already enabled")
+	errTwoFactorDisabled  = errors.New("Two-factor authentication is not enabled")
+	errNoPendingTwoFactor = errors.New("Start the two-factor enrollment first")
+	errEnrollmentRequired = errors.New("Your role requires two-factor authentication, enroll first")
+	errTwoFactorRequired  = errors.New("Your role requires two-factor authentication, it cannot be turned off")
+	errInvalidRole        = errors.New("role must be one of user, admin")
+)
+
+// validRoles are the user roles a policy can be set for.
+var validRoles = []string{"user", "admin"}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newChallenge issues the short lived token the second login step is made
+// with.
+func (s *UserService) newChallenge(ctx context.Context, user User) (*ChallengeStep, error) {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().UTC().Add(s.cfg.TwoFactor.ChallengeTTL)
+	err = s.repo.createLoginChallenge(ctx, LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChallengeStep{
+		Token:              token,
+		ExpiresAt:          expiresAt,
+		EnrollmentRequired: user.TOTPEnabledAt == nil,
+	}, nil
+}
+
+// challengeUser loads the user behind a login challenge that can still be
+// answered.
+func (s *UserService) challengeUser(ctx context.Context, token string) (*LoginChallenge, *User, error) {
+	c, err := s.repo.getLoginChallenge(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	if c == nil || c.UsedAt != nil || c.Attempts >= maxChallengeAttempts || time.Now().UTC().After(c.ExpiresAt) {
+		return nil, nil, errInvalidChallenge
+	}
+
+	user, err := s.repo.Get(ctx, c.UserID, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || !user.IsActive || user.IsLocked {
+		return nil, nil, errInvalidChallenge
+	}
+
+	return c, user, nil
+}
+
+// failChallenge counts a wrong code against both the challenge and the
+// account lockout.
+func (s *UserService) failChallenge(ctx context.Context, c *LoginChallenge, user *User) error {
+	if err := s.repo.failLoginChallenge(ctx, c.ID); err != nil {
+		return err
+	}
+	if err := s.recordFailedLogin(ctx, user); err != nil {
+		return err
+	}
+	return errInvalidCode
+}
+
+// finishChallenge uses up the challenge and logs the user in.
+func (s *UserService) finishChallenge(ctx context.Context, c *LoginChallenge, user *User) (*TokenPair, error) {
+	used, err := s.repo.useLoginChallenge(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, errInvalidChallenge
+	}
+	return s.completeLogin(ctx, user)
+}
+
+// verifyLogin is the second login step, answering the challenge with a TOTP
+// or a recovery code.
+func (s *UserService) verifyLogin(ctx context.Context, req twoFactorLoginRequest) (*User, *TokenPair, error) {
+	c, user, err := s.challengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, nil, errEnrollmentRequired
+	}
+
+	ok, err := s.checkSecondFactor(ctx, *user, req.Code, req.RecoveryCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, s.failChallenge(ctx, c, user)
+	}
+
+	tokens, err := s.finishChallenge(ctx, c, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// enrollWithChallenge starts the enrollment of a user whose role requires
+// two-factor authentication but who has not set it up yet.
+func (s *UserService) enrollWithChallenge(ctx context.Context, token string) (*totpEnrollment, error) {
+	_, user, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.beginEnrollment(ctx, *user)
+}
+
+// confirmWithChallenge finishes such an enrollment and logs the user in.
+func (s *UserService) confirmWithChallenge(ctx context.Context, token, code string) (*User, *TokenPair, []string, error) {
+	c, user, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	codes, err := s.confirmEnrollment(ctx, *user, code)
+	if err == errInvalidCode {
+		return nil, nil, nil, s.failChallenge(ctx, c, user)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	tokens, err := s.finishChallenge(ctx, c, user)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return user, tokens, codes, nil
+}
+
+// beginEnrollment stores a new pending secret and returns it with the
+// provisioning URI for the QR code.
+func (s *UserService) beginEnrollment(ctx context.Context, user User) (*totpEnrollment, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, errTwoFactorEnabled
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.secrets.Seal([]byte(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.setTOTPSecret(ctx, user.ID, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &totpEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(s.cfg.TwoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+// confirmEnrollment turns two-factor authentication on once the user proves
+// their app produces valid codes, and returns the recovery codes.
+func (s *UserService) confirmEnrollment(ctx context.Context, user User, code string) ([]string, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, errTwoFactorEnabled
+	}
+	if user.TOTPSecret == nil {
+		return nil, errNoPendingTwoFactor
+	}
+
+	secret, err := s.secrets.Open(user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := auth.ValidateTOTP(string(secret), code, time.Now())
+	if !ok {
+		return nil, errInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.repo.enableTOTP(ctx, user.ID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, errNoPendingTwoFactor
+	}
+	return codes, nil
+}
+
+// disableTwoFactor turns two-factor authentication off after checking both
+// the password and a second factor.
+func (s *UserService) disableTwoFactor(ctx context.Context, user User, req disableTwoFactorRequest) error {
+	if user.TOTPEnabledAt == nil {
+		return errTwoFactorDisabled
+	}
+
+	required, err := s.repo.requiresTwoFactor(ctx, user.UserRole)
+	if err != nil {
+		return err
+	}
+	if required {
+		return errTwoFactorRequired
+	}
+
+	matched, err := user.PasswordHash.Matches(req.Password)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return errInvalidCredentials
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidCode
+	}
+
+	return s.repo.disableTOTP(ctx, user.ID)
+}
+
+// regenerateRecoveryCodes replaces the recovery codes, the old ones stop
+// working.
+func (s *UserService) regenerateRecoveryCodes(ctx context.Context, user User, code string) ([]string, error) {
+	if user.TOTPEnabledAt == nil {
+		return nil, errTwoFactorDisabled
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, code, "")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return codes, s.repo.replaceRecoveryCodes(ctx, user.ID, hashes)
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery code,
+// each of them once.
+func (s *UserService) checkSecondFactor(ctx context.Context, user User, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return s.repo.useRecoveryCode(ctx, user.ID, auth.HashToken(normalizeRecoveryCode(recoveryCode)))
+	}
+
+	secret, err := s.secrets.Open(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := auth.ValidateTOTP(string(secret), code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.repo.useTOTPStep(ctx, user.ID, step)
+}
+
+func (s *UserService) getUser(ctx context.Context, id int64) (*User, error) {
+	return s.repo.Get(ctx, id, "")
+}
+
+func (s *UserService) listRolePolicies(ctx context.Context) ([]*RolePolicy, error) {
+	return s.repo.listRolePolicies(ctx)
+}
+
+func (s *UserService) setRolePolicy(ctx context.Context, adminID int64, role string, requireTwoFactor bool) (*RolePolicy, error) {
+	valid := false
+	for _, r := range validRoles {
+		valid = valid || r == role
+	}
+	if !valid {
+		return nil, errInvalidRole
+	}
+
+	return s.repo.setRolePolicy(ctx, RolePolicy{
+		UserRole:         role,
+		RequireTwoFactor: requireTwoFactor,
+		UpdatedBy:        &adminID,
+	})
+}
+
+// newRecoveryCodes returns fresh recovery codes, formatted as xxxxx-xxxxx, and
+// their hashes for storage.
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = auth.HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,58 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habit_performance
+    ADD COLUMN IF NOT EXISTS habit_id BIGINT REFERENCES habits(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- Earlier rows were not tied to a habit. Attribute each one to the only habit
+-- of the user that ran on that date.
+UPDATE habit_performance hp
+SET habit_id = m.habit_id
+FROM (
+    SELECT hp.id, MIN(hm.habit_id) AS habit_id
+    FROM habit_performance hp
+    JOIN habit_members hm ON hm.user_id = hp.user_id
+    JOIN habits h ON h.id = hm.habit_id
+    WHERE hp.habit_id IS NULL AND hp.date BETWEEN h.start_date AND h.end_date
+    GROUP BY hp.id
+    HAVING COUNT(*) = 1
+) m
+WHERE hp.id = m.id;
+
+-- Rows that match no habit or several cannot be attributed. They are kept
+-- aside until someone assigns them to a habit.
+CREATE TABLE IF NOT EXISTS habit_performance_unassigned (
+    id BIGINT PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    quantity INT,
+    duration INTERVAL,
+    date DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+WITH moved AS (
+    DELETE FROM habit_performance WHERE habit_id IS NULL
+    RETURNING id, user_id, quantity, duration, date, created_at
+)
+INSERT INTO habit_performance_unassigned (id, user_id, quantity, duration, date, created_at)
+SELECT id, user_id, quantity, duration, date, created_at FROM moved;
+
+ALTER TABLE habit_performance ALTER COLUMN habit_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_habit_performance_habit_user_date
+    ON habit_performance (habit_id, user_id, date);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_habit_performance_habit_user_date;
+
+ALTER TABLE habit_performance
+    DROP COLUMN IF EXISTS habit_id,
+    DROP COLUMN IF EXISTS created_at;
+
+INSERT INTO habit_performance (id, user_id, quantity, duration, date)
+SELECT id, user_id, quantity, duration, date FROM habit_performance_unassigned;
+
+DROP TABLE IF EXISTS habit_performance_unassigned;
+-- +goose StatementEnd
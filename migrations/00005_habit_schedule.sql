@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habits ADD COLUMN IF NOT EXISTS schedule JSONB NOT NULL DEFAULT '{"type": "daily"}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habits DROP COLUMN IF EXISTS schedule;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS habit_timer_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    habit_id BIGINT NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resumed_at TIMESTAMP WITH TIME ZONE,
+    accumulated_seconds BIGINT NOT NULL DEFAULT 0,
+    stopped_at TIMESTAMP WITH TIME ZONE,
+    auto_stopped BOOLEAN NOT NULL DEFAULT FALSE,
+    checkin_id BIGINT REFERENCES habit_performance(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_timer_status CHECK (status IN ('running', 'paused', 'stopped', 'discarded'))
+);
+
+-- one open timer per member and habit, shared by all of the member's devices
+CREATE UNIQUE INDEX IF NOT EXISTS idx_habit_timer_sessions_open
+    ON habit_timer_sessions (habit_id, user_id)
+    WHERE status IN ('running', 'paused');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS habit_timer_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habit_follow_requests RENAME COLUMN habt_id TO habit_id;
+
+ALTER TABLE habit_follow_requests
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    ADD COLUMN IF NOT EXISTS reason VARCHAR(500),
+    ADD COLUMN IF NOT EXISTS decided_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS decided_at TIMESTAMP WITH TIME ZONE,
+    ADD CONSTRAINT valid_follow_request_status CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled'));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_habit_follow_requests_pending
+    ON habit_follow_requests (habit_id, user_id)
+    WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_habit_follow_requests_pending;
+
+ALTER TABLE habit_follow_requests
+    DROP CONSTRAINT IF EXISTS valid_follow_request_status,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS reason,
+    DROP COLUMN IF EXISTS decided_by,
+    DROP COLUMN IF EXISTS decided_at;
+
+ALTER TABLE habit_follow_requests RENAME COLUMN habit_id TO habt_id;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS habit_invites (
+    id BIGSERIAL PRIMARY KEY,
+    habit_id BIGINT NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    token_hash BYTEA UNIQUE NOT NULL,
+    invited_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    used_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS habit_invites;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habit_members
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'member',
+    ADD CONSTRAINT habit_members_role_check CHECK (role IN ('owner', 'moderator', 'member', 'viewer'));
+
+UPDATE habit_members hm
+SET role = 'owner'
+FROM habits h
+WHERE h.id = hm.habit_id AND h.created_by = hm.user_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habit_members
+    DROP CONSTRAINT IF EXISTS habit_members_role_check,
+    DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
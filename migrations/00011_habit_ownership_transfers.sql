@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS habit_ownership_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    habit_id BIGINT NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+    from_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    to_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    forced BOOLEAN NOT NULL DEFAULT FALSE,
+    initiated_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT valid_transfer_status CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS habit_ownership_transfers_pending_idx
+    ON habit_ownership_transfers (habit_id)
+    WHERE status = 'pending';
+
+-- owners have to hand their habits over before the user can be removed
+ALTER TABLE habits
+    DROP CONSTRAINT IF EXISTS habits_created_by_fkey,
+    ADD CONSTRAINT habits_created_by_fkey FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE RESTRICT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habits
+    DROP CONSTRAINT IF EXISTS habits_created_by_fkey,
+    ADD CONSTRAINT habits_created_by_fkey FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE;
+
+DROP TABLE IF EXISTS habit_ownership_transfers;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habits
+    ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS habits_deleted_at_idx ON habits (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS habits_deleted_at_idx;
+
+ALTER TABLE habits
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
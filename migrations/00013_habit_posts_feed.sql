@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE habit_posts SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+
+ALTER TABLE habit_posts
+    ALTER COLUMN created_at SET NOT NULL,
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS habit_posts_feed_idx ON habit_posts (habit_id, created_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS habit_posts_feed_idx;
+
+ALTER TABLE habit_posts
+    DROP COLUMN IF EXISTS updated_at,
+    ALTER COLUMN created_at DROP NOT NULL;
+-- +goose StatementEnd
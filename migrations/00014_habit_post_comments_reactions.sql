@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS habit_post_comments (
+    id BIGSERIAL PRIMARY KEY,
+    post_id BIGINT NOT NULL REFERENCES habit_posts(id) ON DELETE CASCADE,
+    parent_id BIGINT REFERENCES habit_post_comments(id) ON DELETE CASCADE,
+    author_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS habit_post_comments_post_idx ON habit_post_comments (post_id, created_at, id);
+CREATE INDEX IF NOT EXISTS habit_post_comments_parent_idx ON habit_post_comments (parent_id) WHERE parent_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS habit_post_reactions (
+    post_id BIGINT NOT NULL REFERENCES habit_posts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, user_id, reaction),
+    CONSTRAINT valid_post_reaction CHECK (reaction IN ('like', 'love', 'fire', 'clap', 'muscle', 'celebrate'))
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS habit_post_reactions;
+DROP TABLE IF EXISTS habit_post_comments;
+-- +goose StatementEnd
@@ -4,12 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"net/http"
+	"slices"
 	"time"
+
+	"github.com/NurulloMahmud/habits/pkg/utils"
 )
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey   = contextKey("user")
+	clientContextKey = contextKey("client")
+)
 
 type User struct {
 	ID              int64        `json:"id"`
@@ -19,10 +25,21 @@ type User struct {
 	UserRole        string       `json:"user_role"`
 	IsActive        bool         `json:"is_active"`
 	IsLocked        bool         `json:"is_locked"`
+	Timezone        string       `json:"timezone"`
+	EmailVerified   bool         `json:"email_verified"`
 	LastFailedLogin sql.NullTime `json:"-"`
 	FailedAttempts  int64        `json:"-"`
-	CreatedAt       time.Time    `json:"created_at"`
-	UpdatedAt       time.Time    `json:"updated_at"`
+	// Scopes is set when the request came with a personal access token, nil
+	// means a login session that may do everything the user can.
+	Scopes []string `json:"-"`
+	// SessionID is the login session of the access token, zero for tokens
+	// without one.
+	SessionID int64 `json:"-"`
+	// ExpiresAt is when the token of the request stops being valid, nil for
+	// personal access tokens without an expiry.
+	ExpiresAt *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 var AnonymousUser = &User{}
@@ -31,6 +48,24 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// Location returns the user's time zone, falling back to UTC for anonymous
+// users and unknown zone names.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := utils.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// HasScope reports whether the credential of the request grants the scope.
+func (u *User) HasScope(scope string) bool {
+	return u.Scopes == nil || slices.Contains(u.Scopes, scope)
+}
+
 func SetUser(r *http.Request, user *User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
@@ -43,3 +78,21 @@ func GetUser(r *http.Request) *User {
 	}
 	return user
 }
+
+// Client describes where a request came from.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+func SetClient(r *http.Request, client Client) *http.Request {
+	ctx := context.WithValue(r.Context(), clientContextKey, client)
+	return r.WithContext(ctx)
+}
+
+// GetClient returns the client of the request ctx belongs to, empty when it
+// was not recorded.
+func GetClient(ctx context.Context) Client {
+	client, _ := ctx.Value(clientContextKey).(Client)
+	return client
+}
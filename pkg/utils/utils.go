@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -23,6 +24,19 @@ func ReadIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+func ReadInt64Param(r *http.Request, key string) (int64, error) {
+	param := chi.URLParam(r, key)
+	if param == "" {
+		return 0, errors.New("invalid " + key + " parameter")
+	}
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid " + key + " parameter type")
+	}
+
+	return id, nil
+}
+
 func ReadIdentifierParam(r *http.Request) (string, error) {
 	idParam := chi.URLParam(r, "identifier")
 	if idParam == "" {
@@ -88,3 +102,39 @@ func ConvertStrToDate(value string) (*time.Time, error) {
 	}
 	return &t, nil
 }
+
+// locations caches time zones by name, time.LoadLocation reads and parses the
+// zone file on every call.
+var locations sync.Map
+
+// LoadLocation is time.LoadLocation with a cache. The empty name and "Local"
+// are refused, they stand for UTC and the server's own zone rather than
+// where a user lives.
+func LoadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, errors.New("unknown time zone " + name)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// DateIn returns the calendar day of t in loc as midnight UTC, the form DATE
+// columns are scanned into. Going through the calendar fields keeps it correct
+// across DST transitions where a day is not 24 hours long.
+func DateIn(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Today returns the current calendar day in loc.
+func Today(loc *time.Location) time.Time {
+	return DateIn(time.Now(), loc)
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDateInAcrossDST(t *testing.T) {
+	tests := []struct {
+		name string
+		zone string
+		at   string
+		want time.Time
+	}{
+		// New York springs forward at 02:00 on 2024-03-10, the day has 23 hours
+		{"before spring forward", "America/New_York", "2024-03-10T06:59:00Z", date(2024, 3, 10)},
+		{"evening before spring forward", "America/New_York", "2024-03-10T04:59:00Z", date(2024, 3, 9)},
+		{"last minute of the short day", "America/New_York", "2024-03-11T03:59:00Z", date(2024, 3, 10)},
+		{"midnight after the short day", "America/New_York", "2024-03-11T04:00:00Z", date(2024, 3, 11)},
+
+		// and falls back at 02:00 on 2024-11-03, the day has 25 hours
+		{"first 01:30 of fall back", "America/New_York", "2024-11-03T05:30:00Z", date(2024, 11, 3)},
+		{"second 01:30 of fall back", "America/New_York", "2024-11-03T06:30:00Z", date(2024, 11, 3)},
+		{"last minute of the long day", "America/New_York", "2024-11-04T04:59:00Z", date(2024, 11, 3)},
+		{"midnight after the long day", "America/New_York", "2024-11-04T05:00:00Z", date(2024, 11, 4)},
+
+		// Samoa skipped 2011-12-30 when it moved across the date line
+		{"day before the skipped day", "Pacific/Apia", "2011-12-30T09:59:00Z", date(2011, 12, 29)},
+		{"day after the skipped day", "Pacific/Apia", "2011-12-30T10:00:00Z", date(2011, 12, 31)},
+
+		{"ahead of UTC", "Asia/Tashkent", "2024-06-30T19:00:00Z", date(2024, 7, 1)},
+		{"UTC", "UTC", "2024-06-30T23:59:59Z", date(2024, 6, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := DateIn(at, mustLoad(t, tt.zone))
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("DateIn(%s, %s) = %v, want %v", tt.at, tt.zone, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateInDaysAreWholeAcrossDST(t *testing.T) {
+	loc := mustLoad(t, "Europe/Berlin")
+
+	// noon to noon across both of Berlin's 2024 transitions
+	for _, start := range []time.Time{
+		time.Date(2024, 3, 30, 12, 0, 0, 0, loc),
+		time.Date(2024, 10, 26, 12, 0, 0, 0, loc),
+	} {
+		for days := 0; days <= 3; days++ {
+			got := DateIn(start.AddDate(0, 0, days), loc)
+			want := DateIn(start, loc).AddDate(0, 0, days)
+			if !got.Equal(want) {
+				t.Errorf("%d day(s) after %v: got %v, want %v", days, start, got, want)
+			}
+			if hours := got.Sub(DateIn(start, loc)).Hours(); hours != float64(24*days) {
+				t.Errorf("%d day(s) after %v are %v hours apart", days, start, hours)
+			}
+		}
+	}
+}
+
+func TestToday(t *testing.T) {
+	for _, zone := range []string{"UTC", "America/New_York", "Pacific/Kiritimati", "Pacific/Pago_Pago"} {
+		loc := mustLoad(t, zone)
+
+		before := DateIn(time.Now(), loc)
+		got := Today(loc)
+		after := DateIn(time.Now(), loc)
+
+		// a day may start between the calls
+		if !got.Equal(before) && !got.Equal(after) {
+			t.Errorf("Today(%s) = %v, want %v", zone, got, before)
+		}
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	first := mustLoad(t, "Asia/Tashkent")
+	if second := mustLoad(t, "Asia/Tashkent"); first != second {
+		t.Error("location was loaded again instead of cached")
+	}
+
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons", "../etc/passwd"} {
+		if _, err := LoadLocation(name); err == nil {
+			t.Errorf("LoadLocation(%q) succeeded", name)
+		}
+	}
+}